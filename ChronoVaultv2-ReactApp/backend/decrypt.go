@@ -39,7 +39,7 @@ func DecryptAndRestore(filename string) {
 			continue
 		}
 
-		chunkPath := filepath.Join(StoreFolder, hash)
+		chunkPath := filepath.Join(cfg.StoreFolder, hash)
 		chunkData, err := os.ReadFile(chunkPath)
 		if err != nil {
 			panic("Data Loss! Chunk not found: " + hash)
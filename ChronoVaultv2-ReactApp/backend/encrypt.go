@@ -36,8 +36,9 @@ func EncryptAndStore(originalData []byte, filename string) {
 
 	// 4. Shred and Store Chunks
 	var chunkHashes []string
-	for i := 0; i < len(encryptedData); i += ChunkSize {
-		end := i + ChunkSize
+	chunkSize := int(cfg.ChunkSize)
+	for i := 0; i < len(encryptedData); i += chunkSize {
+		end := i + chunkSize
 		if end > len(encryptedData) {
 			end = len(encryptedData)
 		}
@@ -47,7 +48,7 @@ func EncryptAndStore(originalData []byte, filename string) {
 		hash := HashData(chunk)
 
 		// Write to "Network" (Disk)
-		path := filepath.Join(StoreFolder, hash)
+		path := filepath.Join(cfg.StoreFolder, hash)
 		err := os.WriteFile(path, chunk, 0644)
 		Check(err)
 
@@ -7,12 +7,10 @@ import (
 	"os"
 )
 
-// --- Shared Configuration & Structs ---
-
-const (
-	ChunkSize   = 256 * 1024 // 256KB chunks
-	StoreFolder = "shredded_store"
-)
+// --- Shared Structs ---
+//
+// Settings such as the chunk size and the store folder live in cfg
+// (see config.go).
 
 // MerkleNode is used by both encrypt and decrypt
 type MerkleNode struct {
@@ -23,21 +21,37 @@ type MerkleNode struct {
 // --- Main Entry Point ---
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "server" || os.Args[1] == "web") {
+	args := initConfig(os.Args[1:], printUsage)
+	if len(args) > 0 && (args[0] == "server" || args[0] == "web") {
 		startServer()
 		return
 	}
+	if len(args) > 0 && args[0] == "config" {
+		printConfig(os.Stdout)
+		return
+	}
 
 	runSimulation()
 }
 
+func printUsage() {
+	fmt.Println("Usage: chronovault [-config file] [-profile name] [-<setting> value ...] [command]")
+	fmt.Println()
+	fmt.Println("  (none)            run the local encrypt/restore simulation")
+	fmt.Println("  server | web      start the HTTP server")
+	fmt.Println("  config            print the effective configuration")
+	fmt.Println()
+	fmt.Println("Any setting can be given as a flag before the command, e.g. -chunk-size 512KB;")
+	fmt.Println("`chronovault config` lists them.")
+}
+
 func runSimulation() {
 	// Define the file to work on
 	inputFile := "original.txt"
 
 	// 1. Prepare Environment
-	os.RemoveAll(StoreFolder)
-	os.Mkdir(StoreFolder, 0755)
+	os.RemoveAll(cfg.StoreFolder)
+	os.Mkdir(cfg.StoreFolder, 0755)
 
 	// Create a dummy file if it doesn't exist
 	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
@@ -35,8 +35,10 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func startServer() {
+	printConfig(os.Stdout)
+
 	// Ensure directories exist
-	os.Mkdir(StoreFolder, 0755)
+	os.Mkdir(cfg.StoreFolder, 0755)
 
 	http.Handle("/", http.FileServer(http.Dir("public")))
 
@@ -44,9 +46,9 @@ func startServer() {
 	http.HandleFunc("/upload", enableCORS(uploadHandler))
 	http.HandleFunc("/retrieve", enableCORS(retrieveHandler))
 
-	fmt.Println("🌐 DSN Web Server Bundle started on http://localhost:8080")
+	fmt.Printf("🌐 DSN Web Server Bundle started on %s\n", cfg.HTTPAddr)
 	fmt.Println("📂 Serving ./public")
-	err := http.ListenAndServe(":8080", nil)
+	err := http.ListenAndServe(cfg.HTTPAddr, nil)
 	if err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
 	}
@@ -68,8 +70,8 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 10MB max upload
-	r.ParseMultipartForm(10 << 20)
+	// Max upload held in memory (max_upload_size, 10MB by default)
+	r.ParseMultipartForm(int64(cfg.MaxUploadSize))
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -104,8 +106,9 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 4. Shred & Store
 	var chunkHashes []string
-	for i := 0; i < len(encryptedData); i += ChunkSize {
-		end := i + ChunkSize
+	chunkSize := int(cfg.ChunkSize)
+	for i := 0; i < len(encryptedData); i += chunkSize {
+		end := i + chunkSize
 		if end > len(encryptedData) {
 			end = len(encryptedData)
 		}
@@ -113,7 +116,7 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		hash := HashData(chunk)
 
 		// Store chunk
-		path := filepath.Join(StoreFolder, hash)
+		path := filepath.Join(cfg.StoreFolder, hash)
 		os.WriteFile(path, chunk, 0644)
 		chunkHashes = append(chunkHashes, hash)
 	}
@@ -148,7 +151,7 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.ParseMultipartForm(10 << 20)
+	r.ParseMultipartForm(int64(cfg.MaxUploadSize))
 
 	// Get Root Hash
 	rootFile, _, err := r.FormFile("roothash_file")
@@ -222,7 +225,7 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 		if hash == "" {
 			continue
 		}
-		chunkPath := filepath.Join(StoreFolder, hash)
+		chunkPath := filepath.Join(cfg.StoreFolder, hash)
 		chunkData, err := os.ReadFile(chunkPath)
 		if err != nil {
 			http.Error(w, "Data corrupted/missing chunks", http.StatusServiceUnavailable)
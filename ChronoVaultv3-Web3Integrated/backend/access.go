@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// --- Ownership and Sharing ---
+//
+// A vault belongs to the user who uploaded it: VaultRecord.Owner is the JWT
+// sub of the upload. Holding a vault's artifacts is not enough to use it.
+// /retrieve and /delete check the caller's sub against the owner, so a leaked
+// manifest can't be used from another account to decrypt the vault or purge
+// its pins. The owner can share a vault with explicit grants. Each grant
+// names a Supabase user ID or email, as beneficiaries do, and the actions it
+// allows:
+//
+//	retrieve  decrypt the vault through /retrieve
+//	delete    delete it through /delete or DELETE /v1/vaults/{id}
+//
+// A grant may expire. Only the owner manages grants, at
+// /v1/vaults/{id}/grants. Two kinds of recipient may retrieve without a
+// grant, because the vault was meant to reach them: dead man's switch
+// beneficiaries once the switch has released, and delivery recipients who
+// have redeemed their link.
+//
+// /retrieve finds the vault by root hash when the manifest has no Vault-ID,
+// so removing the header doesn't skip the check. /delete refuses to purge a
+// chunk of a registered vault unless the whole vault is being deleted with
+// its own manifest.
+
+const (
+	accessRetrieve = "retrieve"
+	accessDelete   = "delete"
+
+	maxGrants = 50
+)
+
+var (
+	errGrantNotFound = errors.New("grant not found")
+	errTooManyGrants = fmt.Errorf("a vault can have at most %d grants", maxGrants)
+)
+
+// Grant shares a vault with another user.
+type Grant struct {
+	Grantee   string     `json:"grantee"` // user ID or email
+	Actions   []string   `json:"actions"`
+	GrantedAt time.Time  `json:"granted_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// GrantList is the response of GET /v1/vaults/{id}/grants.
+type GrantList struct {
+	VaultID string  `json:"vault_id"`
+	Grants  []Grant `json:"grants"`
+}
+
+func (g Grant) matches(userID, email string) bool {
+	return (userID != "" && g.Grantee == userID) || (email != "" && strings.EqualFold(g.Grantee, email))
+}
+
+func (g Grant) allows(action string, now time.Time) bool {
+	return slices.Contains(g.Actions, action) && (g.ExpiresAt == nil || now.Before(*g.ExpiresAt))
+}
+
+// accessVia reports why the caller may perform action on rec: "owner",
+// "grant", "beneficiary" or "delivery". It returns "" when they may not.
+func (rec *VaultRecord) accessVia(action, userID, email string, now time.Time) string {
+	if userID != "" && rec.Owner == userID {
+		return "owner"
+	}
+	for _, g := range rec.Grants {
+		if g.matches(userID, email) && g.allows(action, now) {
+			return "grant"
+		}
+	}
+	if action != accessRetrieve {
+		return ""
+	}
+	if rec.DeadMan != nil && rec.DeadMan.ReleasedAt != nil && rec.DeadMan.isBeneficiary(userID, email) {
+		return "beneficiary"
+	}
+	if rec.Delivery != nil && email != "" {
+		for _, rc := range rec.Delivery.Recipients {
+			if rc.RedeemedAt != nil && strings.EqualFold(rc.Email, email) {
+				return "delivery"
+			}
+		}
+	}
+	return ""
+}
+
+// verifiedEmail is the caller's email for matching grants, beneficiaries and
+// delivery recipients, or "" unless the token marks it verified: anyone can
+// sign up with someone else's address.
+func verifiedEmail(r *http.Request) string {
+	if r.Header.Get("X-User-Email-Verified") != "true" {
+		return ""
+	}
+	return r.Header.Get("X-User-Email")
+}
+
+// checkAccess writes a 403 and returns false unless the caller may perform
+// action on rec.
+func checkAccess(w http.ResponseWriter, r *http.Request, rec *VaultRecord, action string) bool {
+	userID, email := r.Header.Get("X-User-ID"), verifiedEmail(r)
+	via := rec.accessVia(action, userID, email, time.Now())
+	if via == "" {
+		fmt.Printf("[Access] Refused %s of vault %s for %s (owner %s)\n", action, rec.ID, userID, rec.Owner)
+		auditEvent(r, action, rec.ID, auditOutcomeDenied, "not the owner or a grantee")
+		writeJSON(w, http.StatusForbidden, map[string]string{
+			"error":    fmt.Sprintf("Only the vault owner or a grantee may %s this vault", action),
+			"code":     "NOT_AUTHORIZED",
+			"vault_id": rec.ID,
+		})
+		return false
+	}
+	if via != "owner" {
+		fmt.Printf("[Access] %s of vault %s by %s allowed (%s)\n", action, rec.ID, userID, via)
+	}
+	return true
+}
+
+// registeredCIDs maps the chunks of every live vault to its record.
+func registeredCIDs() map[string]*VaultRecord {
+	owned := map[string]*VaultRecord{}
+	for _, rec := range vaults.List() {
+		if rec.Deletion != nil {
+			continue
+		}
+		for _, cid := range rec.CIDs {
+			owned[cid] = rec
+		}
+	}
+	return owned
+}
+
+// parseGrant reads the form of POST /v1/vaults/{id}/grants.
+func parseGrant(r *http.Request, now time.Time) (*Grant, error) {
+	g := &Grant{Grantee: strings.TrimSpace(r.FormValue("grantee")), GrantedAt: now}
+	if g.Grantee == "" || len(g.Grantee) > 254 {
+		return nil, fmt.Errorf("grantee must be a user ID or email")
+	}
+	actions := r.FormValue("actions")
+	if actions == "" {
+		actions = accessRetrieve
+	}
+	for _, a := range strings.Split(actions, ",") {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if a != accessRetrieve && a != accessDelete {
+			return nil, fmt.Errorf("unknown action %q (want retrieve or delete)", a)
+		}
+		if !slices.Contains(g.Actions, a) {
+			g.Actions = append(g.Actions, a)
+		}
+	}
+	if v := r.FormValue("expires_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("expires_at must be RFC 3339")
+		}
+		if !t.After(now) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		t = t.UTC()
+		g.ExpiresAt = &t
+	}
+	return g, nil
+}
+
+// --- Handlers ---
+
+func listGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	rec := ownedVault(w, r)
+	if rec == nil {
+		return
+	}
+	out := GrantList{VaultID: rec.ID, Grants: rec.Grants}
+	if out.Grants == nil {
+		out.Grants = []Grant{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// createGrantHandler adds a grant, replacing any earlier grant to the same
+// grantee.
+func createGrantHandler(w http.ResponseWriter, r *http.Request) {
+	rec := ownedVault(w, r)
+	if rec == nil {
+		return
+	}
+	if rec.Deletion != nil {
+		writeError(w, http.StatusGone, "Vault has been deleted")
+		return
+	}
+	g, err := parseGrant(r, time.Now().UTC())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if g.Grantee == rec.Owner || strings.EqualFold(g.Grantee, rec.OwnerEmail) {
+		writeError(w, http.StatusBadRequest, "The owner needs no grant")
+		return
+	}
+	err = vaults.Update(rec.ID, func(v *VaultRecord) error {
+		grants := slices.DeleteFunc(slices.Clone(v.Grants), func(old Grant) bool {
+			return strings.EqualFold(old.Grantee, g.Grantee)
+		})
+		if len(grants) >= maxGrants {
+			return errTooManyGrants
+		}
+		v.Grants = append(grants, *g)
+		return nil
+	})
+	if errors.Is(err, errTooManyGrants) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update vault")
+		return
+	}
+	fmt.Printf("[Access] Vault %s shared with %s (%s)\n", rec.ID, g.Grantee, strings.Join(g.Actions, ", "))
+	auditEvent(r, "grant", rec.ID, auditOutcomeSuccess, fmt.Sprintf("%s: %s", g.Grantee, strings.Join(g.Actions, ", ")))
+	writeJSON(w, http.StatusCreated, g)
+}
+
+func revokeGrantHandler(w http.ResponseWriter, r *http.Request) {
+	rec := ownedVault(w, r)
+	if rec == nil {
+		return
+	}
+	grantee := r.PathValue("grantee")
+	err := vaults.Update(rec.ID, func(v *VaultRecord) error {
+		n := len(v.Grants)
+		v.Grants = slices.DeleteFunc(slices.Clone(v.Grants), func(g Grant) bool {
+			return strings.EqualFold(g.Grantee, grantee)
+		})
+		if len(v.Grants) == n {
+			return errGrantNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, errGrantNotFound) {
+		writeError(w, http.StatusNotFound, "Grant not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update vault")
+		return
+	}
+	fmt.Printf("[Access] Vault %s no longer shared with %s\n", rec.ID, grantee)
+	auditEvent(r, "revoke", rec.ID, auditOutcomeSuccess, grantee)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- REST API (v1) ---
+//
+// /v1/vaults exposes the vault registry as resources:
+//
+//	GET    /v1/vaults                 list the caller's vaults, newest first
+//	POST   /v1/vaults                 create a vault (the /upload form)
+//	GET    /v1/vaults/{id}            vault metadata
+//	DELETE /v1/vaults/{id}            crypto-shred the vault and unpin its chunks
+//	GET    /v1/vaults/{id}/manifest   the manifest, as text
+//	GET    /v1/vaults/{id}/grants     who the vault is shared with
+//	POST   /v1/vaults/{id}/grants     share it (see access.go)
+//	DELETE /v1/vaults/{id}/grants/{grantee}
+//	                                  stop sharing it
+//	GET    /v1/audit                  audit log entries about the caller's
+//	                                  vaults (see audit.go)
+//	GET    /v1/jobs/{id}              an async upload job (see jobs.go)
+//	GET    /v1/jobs/{id}/events       its progress, as Server-Sent Events
+//	DELETE /v1/jobs/{id}              discard a finished job
+//	GET    /v1/openapi.json           the OpenAPI document (no auth)
+//
+// The routes are declared once, in v1Routes. The same table registers the
+// handlers and generates the OpenAPI document (openapi.go), so the two can't
+// drift apart. Vaults belong to their owner: to anyone else they answer 404,
+// except that a grantee with the delete action may DELETE the vault.
+//
+// The action endpoints (/upload, /delete, ...) remain as compatibility shims.
+// /upload is POST /v1/vaults with a 200 status, and /delete of a registered
+// vault goes through the same shred path as DELETE /v1/vaults/{id}.
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// apiRoute is one operation of the v1 API.
+type apiRoute struct {
+	method, path string
+	handler      http.HandlerFunc
+	public       bool // served without authentication
+
+	// Documentation, rendered by openapi.go.
+	summary   string
+	query     []apiParam
+	form      []apiParam // multipart/form-data request fields
+	status    int
+	response  interface{} // zero value of the JSON response, or a string for text/plain
+	mediaType string      // of a string response, if not text/plain
+	errors    []int
+}
+
+// apiParam documents a query parameter or form field.
+type apiParam struct {
+	name, typ, desc string
+	required        bool
+}
+
+var v1Routes = []apiRoute{
+	{
+		method: http.MethodGet, path: "/v1/vaults", handler: listVaultsHandler,
+		summary: "List the caller's vaults, newest first",
+		query: []apiParam{
+			{name: "limit", typ: "integer", desc: "Page size, 1-200 (default 50)"},
+			{name: "cursor", typ: "string", desc: "next_cursor from the previous page"},
+			{name: "include_deleted", typ: "boolean", desc: "Also list shredded vaults"},
+		},
+		status: http.StatusOK, response: VaultList{}, errors: []int{400, 401},
+	},
+	{
+		method: http.MethodPost, path: "/v1/vaults", handler: createVaultHandler,
+		summary: "Shred, encrypt and pin a file as a new vault",
+		form:    uploadFields,
+		status:  http.StatusCreated, response: UploadResponse{}, errors: []int{400, 401, 413, 503},
+	},
+	{
+		method: http.MethodGet, path: "/v1/vaults/{id}", handler: getVaultHandler,
+		summary: "Get a vault's metadata",
+		status:  http.StatusOK, response: VaultMetadata{}, errors: []int{401, 404},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/vaults/{id}", handler: deleteVaultHandler,
+		summary: "Crypto-shred a vault and queue its chunks for unpinning",
+		status:  http.StatusAccepted, response: VaultMetadata{}, errors: []int{401, 404, 410, 423},
+	},
+	{
+		method: http.MethodGet, path: "/v1/vaults/{id}/manifest", handler: getManifestHandler,
+		summary: "Download a vault's manifest",
+		status:  http.StatusOK, response: "", errors: []int{401, 404, 410},
+	},
+	{
+		method: http.MethodGet, path: "/v1/audit", handler: listAuditHandler,
+		summary: "Audit log entries about the caller's vaults, newest first",
+		query: []apiParam{
+			{name: "vault_id", typ: "string", desc: "Only entries about this vault"},
+			{name: "limit", typ: "integer", desc: "Page size, 1-200 (default 50)"},
+			{name: "before", typ: "integer", desc: "next_before from the previous page"},
+		},
+		status: http.StatusOK, response: AuditPage{}, errors: []int{400, 401, 404, 503},
+	},
+	{
+		method: http.MethodGet, path: "/v1/vaults/{id}/grants", handler: listGrantsHandler,
+		summary: "List who a vault is shared with",
+		status:  http.StatusOK, response: GrantList{}, errors: []int{401, 404},
+	},
+	{
+		method: http.MethodPost, path: "/v1/vaults/{id}/grants", handler: createGrantHandler,
+		summary: "Share a vault, replacing any earlier grant to the same grantee",
+		form: []apiParam{
+			{name: "grantee", typ: "string", desc: "User ID or email to share with", required: true},
+			{name: "actions", typ: "string", desc: "Comma-separated: retrieve, delete (default retrieve)"},
+			{name: "expires_at", typ: "string", desc: "RFC 3339 time the grant lapses"},
+		},
+		status: http.StatusCreated, response: Grant{}, errors: []int{400, 401, 404, 410},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/vaults/{id}/grants/{grantee}", handler: revokeGrantHandler,
+		summary: "Stop sharing a vault with a grantee",
+		status:  http.StatusNoContent, errors: []int{401, 404},
+	},
+	{
+		method: http.MethodGet, path: "/v1/jobs/{id}", handler: getJobHandler,
+		summary: "Get an async upload job, with its result once done",
+		status:  http.StatusOK, response: JobStatus{}, errors: []int{401, 404},
+	},
+	{
+		method: http.MethodDelete, path: "/v1/jobs/{id}", handler: deleteJobHandler,
+		summary: "Discard a finished upload job and its result",
+		status:  http.StatusNoContent, errors: []int{401, 404, 409},
+	},
+	{
+		method: http.MethodGet, path: "/v1/jobs/{id}/events", handler: jobEventsHandler,
+		summary: "Stream an upload job's progress as Server-Sent Events, resuming after Last-Event-ID",
+		status:  http.StatusOK, response: "", mediaType: "text/event-stream", errors: []int{400, 401, 404},
+	},
+}
+
+// uploadFields are the form fields of POST /v1/vaults and /upload.
+var uploadFields = []apiParam{
+	{name: "file", typ: "binary", desc: "The file to vault (at most max_upload_size, 10MB by default)", required: true},
+	{name: "kem_public_key", typ: "string", desc: "Hybrid X25519+ML-KEM-768 public key; the data key is returned wrapped in the manifest"},
+	{name: "unlock_at", typ: "string", desc: "Time lock, RFC 3339 or Unix seconds"},
+	{name: "schedule", typ: "string", desc: "Cron expression for recurring unlock windows"},
+	{name: "schedule_window", typ: "string", desc: "Length of each window, as a Go duration"},
+	{name: "schedule_tz", typ: "string", desc: "IANA time zone of schedule (default UTC)"},
+	{name: "geofence", typ: "string", desc: "Geofence JSON"},
+	{name: "deadman_checkin_days", typ: "integer", desc: "Dead man's switch check-in interval, in days"},
+	{name: "deadman_grace_days", typ: "integer", desc: "Dead man's switch grace period, in days (default 7)"},
+	{name: "beneficiaries", typ: "string", desc: "Comma-separated beneficiary user IDs or emails"},
+	{name: "chain_after", typ: "string", desc: "Comma-separated vault IDs that must unlock first"},
+	{name: "approvers", typ: "string", desc: "Comma-separated approver user IDs"},
+	{name: "approver_keys", typ: "string", desc: "JSON object of approver user ID to base64 P-256 public key"},
+	{name: "approval_threshold", typ: "integer", desc: "Approvals needed (default: all)"},
+	{name: "approval_window", typ: "string", desc: "Maximum spread of counted approvals (default 72h)"},
+	{name: "policy", typ: "string", desc: "Unlock policy JSON"},
+	{name: "retention_days", typ: "integer", desc: "Expire after this many days"},
+	{name: "expires_at", typ: "string", desc: "Expire at this RFC 3339 time"},
+	{name: "one_time", typ: "boolean", desc: "Burn after the first retrieve"},
+	{name: "deliver_at", typ: "string", desc: "Scheduled delivery time, RFC 3339 or Unix seconds"},
+	{name: "deliver_to", typ: "string", desc: "Comma-separated delivery email addresses"},
+	{name: "puzzle_delay", typ: "string", desc: "Seal the key in a time-lock puzzle of about this duration"},
+	{name: "async", typ: "boolean", desc: "Answer 202 with a JobStatus at once and upload in the background (see /v1/jobs/{id})"},
+}
+
+// registerAPI mounts v1Routes on the default mux. Operations on the same path
+// share a handler that dispatches on the method.
+func registerAPI() {
+	type op struct {
+		method  string
+		handler http.HandlerFunc
+	}
+	byPath := map[string][]op{}
+	var paths []string
+	for _, rt := range v1Routes {
+		h := protect(rt.handler)
+		if rt.public {
+			h = public(rt.handler)
+		}
+		if _, ok := byPath[rt.path]; !ok {
+			paths = append(paths, rt.path)
+		}
+		byPath[rt.path] = append(byPath[rt.path], op{rt.method, h})
+	}
+	for _, path := range paths {
+		ops := byPath[path]
+		var allow []string
+		for _, o := range ops {
+			allow = append(allow, o.method)
+		}
+		http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				ops[0].handler(w, r) // CORS preflight
+				return
+			}
+			for _, o := range ops {
+				if r.Method == o.method {
+					o.handler(w, r)
+					return
+				}
+			}
+			w.Header().Set("Allow", strings.Join(allow, ", "))
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		})
+	}
+}
+
+// --- Resources ---
+
+// VaultMetadata is the public view of a vault record. It never includes key
+// material, claim tokens or delivery tokens.
+type VaultMetadata struct {
+	ID           string          `json:"id"`
+	FileName     string          `json:"file_name"`
+	RootHash     string          `json:"root_hash"`
+	OriginalHash string          `json:"original_hash"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Chunks       int             `json:"chunks"`
+	Locks        []string        `json:"locks"`
+	KeyWithheld  bool            `json:"key_withheld"`
+	UnlockAt     *time.Time      `json:"unlock_at,omitempty"`
+	NextWindow   *windowInfo     `json:"next_window,omitempty"`
+	UnlockedAt   *time.Time      `json:"unlocked_at,omitempty"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	ConsumedAt   *time.Time      `json:"consumed_at,omitempty"`
+	LegalHold    bool            `json:"legal_hold"`
+	Deletion     *DeletionRecord `json:"deletion,omitempty"`
+	ManifestURL  string          `json:"manifest_url"`
+}
+
+// VaultList is a page of vaults.
+type VaultList struct {
+	Vaults     []VaultMetadata `json:"vaults"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+func vaultMetadata(rec *VaultRecord, now time.Time) VaultMetadata {
+	return VaultMetadata{
+		ID:           rec.ID,
+		FileName:     rec.FileName,
+		RootHash:     rec.RootHash,
+		OriginalHash: rec.OriginalHash,
+		CreatedAt:    rec.CreatedAt,
+		Chunks:       len(rec.CIDs),
+		Locks:        vaultLocks(rec),
+		KeyWithheld:  rec.KeyWithheld(),
+		UnlockAt:     rec.UnlockAt,
+		NextWindow:   nextWindow(rec, now),
+		UnlockedAt:   rec.UnlockedAt,
+		ExpiresAt:    rec.EffectiveExpiry(),
+		ConsumedAt:   rec.ConsumedAt,
+		LegalHold:    rec.LegalHold != nil,
+		Deletion:     rec.Deletion,
+		ManifestURL:  "/v1/vaults/" + rec.ID + "/manifest",
+	}
+}
+
+// vaultLocks names the conditions set on rec, in upload-field terms.
+func vaultLocks(rec *VaultRecord) []string {
+	locks := []string{}
+	for _, l := range []struct {
+		name string
+		set  bool
+	}{
+		{"unlock_at", rec.UnlockAt != nil},
+		{"schedule", rec.Schedule != nil},
+		{"geofence", rec.GeoFence != nil},
+		{"deadman", rec.DeadMan != nil},
+		{"chain", rec.Chain != nil},
+		{"approvals", rec.Approval != nil},
+		{"policy", rec.Policy != nil},
+		{"one_time", rec.OneTime},
+		{"delivery", rec.Delivery != nil},
+	} {
+		if l.set {
+			locks = append(locks, l.name)
+		}
+	}
+	return locks
+}
+
+// ownedVault resolves the {id} path parameter to a vault the caller owns.
+func ownedVault(w http.ResponseWriter, r *http.Request) *VaultRecord {
+	id := r.PathValue("id")
+	if !isValidVaultID(id) {
+		writeError(w, http.StatusNotFound, "Vault not found")
+		return nil
+	}
+	rec, err := vaults.Get(id)
+	if err != nil || rec.Owner != r.Header.Get("X-User-ID") {
+		writeError(w, http.StatusNotFound, "Vault not found")
+		return nil
+	}
+	return rec
+}
+
+// accessibleVault is ownedVault for an action grantees may also perform.
+func accessibleVault(w http.ResponseWriter, r *http.Request, action string) *VaultRecord {
+	id := r.PathValue("id")
+	if !isValidVaultID(id) {
+		writeError(w, http.StatusNotFound, "Vault not found")
+		return nil
+	}
+	rec, err := vaults.Get(id)
+	if err != nil || rec.accessVia(action, r.Header.Get("X-User-ID"), verifiedEmail(r), time.Now()) == "" {
+		writeError(w, http.StatusNotFound, "Vault not found")
+		return nil
+	}
+	return rec
+}
+
+// --- Handlers ---
+
+// listVaultsHandler pages through the caller's vaults, newest first. The
+// cursor encodes the position of the last vault returned, so a page stays
+// stable while vaults are created.
+func listVaultsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = n
+	}
+	var after *pageCursor
+	if v := q.Get("cursor"); v != "" {
+		c, err := parsePageCursor(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		after = c
+	}
+	includeDeleted := q.Get("include_deleted") == "true" || q.Get("include_deleted") == "1"
+
+	userID := r.Header.Get("X-User-ID")
+	now := windowClock()
+	all := vaults.List() // oldest first
+	out := VaultList{Vaults: []VaultMetadata{}}
+	for i := len(all) - 1; i >= 0; i-- {
+		rec := all[i]
+		if rec.Owner != userID || (rec.Deletion != nil && !includeDeleted) {
+			continue
+		}
+		if after != nil && !after.before(rec) {
+			continue
+		}
+		if len(out.Vaults) == limit {
+			last := out.Vaults[limit-1]
+			out.NextCursor = pageCursor{last.CreatedAt, last.ID}.String()
+			break
+		}
+		out.Vaults = append(out.Vaults, vaultMetadata(rec, now))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// pageCursor is the (CreatedAt, ID) of the last vault on a page.
+type pageCursor struct {
+	createdAt time.Time
+	id        string
+}
+
+func (c pageCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.createdAt.UnixNano(), 10) + "." + c.id))
+}
+
+func parsePageCursor(s string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	ns, id, ok := strings.Cut(string(raw), ".")
+	if !ok || !isValidVaultID(id) {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	n, err := strconv.ParseInt(ns, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &pageCursor{time.Unix(0, n), id}, nil
+}
+
+// before reports whether rec sorts after the cursor in newest-first order.
+func (c *pageCursor) before(rec *VaultRecord) bool {
+	if rec.CreatedAt.Equal(c.createdAt) {
+		return rec.ID < c.id
+	}
+	return rec.CreatedAt.Before(c.createdAt)
+}
+
+// createVaultHandler is /upload with REST semantics: 201 and a Location.
+func createVaultHandler(w http.ResponseWriter, r *http.Request) {
+	uploadHandler(statusWriter{ResponseWriter: w, from: http.StatusOK, to: http.StatusCreated}, r)
+}
+
+// statusWriter rewrites one status code.
+type statusWriter struct {
+	http.ResponseWriter
+	from, to int
+}
+
+func (s statusWriter) WriteHeader(code int) {
+	if code == s.from {
+		code = s.to
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func getVaultHandler(w http.ResponseWriter, r *http.Request) {
+	rec := ownedVault(w, r)
+	if rec == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, vaultMetadata(rec, windowClock()))
+}
+
+// deleteVaultHandler crypto-shreds the vault. Unpinning happens on the
+// queue, so the response is 202 and the deletion's progress shows up in later
+// GETs.
+func deleteVaultHandler(w http.ResponseWriter, r *http.Request) {
+	rec := accessibleVault(w, r, accessDelete)
+	if rec == nil {
+		return
+	}
+	if !deleteVault(w, r, rec) {
+		return
+	}
+	if rec, err := vaults.Get(rec.ID); err == nil {
+		writeJSON(w, http.StatusAccepted, vaultMetadata(rec, windowClock()))
+	}
+}
+
+// deleteVault shreds rec at the caller's request (its owner or a grantee),
+// writing the error response if that isn't possible.
+func deleteVault(w http.ResponseWriter, r *http.Request, rec *VaultRecord) bool {
+	if rec.Deletion != nil {
+		writeError(w, http.StatusGone, "Vault has already been deleted")
+		return false
+	}
+	if err := shredVault(rec.ID, "owner", time.Now().UTC()); err != nil {
+		if errors.Is(err, errLegalHold) {
+			auditEvent(r, "delete", rec.ID, auditOutcomeDenied, "legal hold")
+			writeLegalHold(w, rec)
+			return false
+		}
+		fmt.Printf("[API] Delete of %s failed: %v\n", rec.ID, err)
+		auditEvent(r, "delete", rec.ID, auditOutcomeFailed, err.Error())
+		writeError(w, http.StatusInternalServerError, "Failed to delete vault")
+		return false
+	}
+	fmt.Printf("[API] Vault %s deleted by %s\n", rec.ID, r.Header.Get("X-User-ID"))
+	auditEvent(r, "delete", rec.ID, auditOutcomeSuccess, fmt.Sprintf("%d chunks queued for unpinning", len(rec.CIDs)))
+	return true
+}
+
+func getManifestHandler(w http.ResponseWriter, r *http.Request) {
+	rec := ownedVault(w, r)
+	if rec == nil {
+		return
+	}
+	if rec.Deletion != nil {
+		writeError(w, http.StatusGone, "Vault has been deleted")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "manifest_"+rec.FileName+".txt"))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(rec.Manifest))
+}
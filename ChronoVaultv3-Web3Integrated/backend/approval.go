@@ -0,0 +1,354 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- M-of-N Approvals ---
+//
+// A vault uploaded with approvers=<sub>,<sub>,... and approval_threshold=M
+// stays sealed until M of the listed approvers have approved it through
+// POST /vault/approve. The approvals must fall within approval_window of
+// each other (a Go duration, default 72h), so a stale sign-off from last year
+// can't be combined with one from today. The window opens with the first
+// approval and is judged by the trusted time source: an approval that
+// arrives after it has closed clears the lapsed approvals and opens a new
+// window of its own. Approvers are Supabase user IDs, which is what the
+// JWT's sub identifies them by.
+//
+// Each approver signs their own approval. The upload pins a P-256 public key
+// per approver (approver_keys), and an approval is a signature with the
+// matching private key over a statement binding the vault ID, root hash,
+// approver and time. The JWT only decides who may submit one; the server
+// holds no key that could forge it, and approvals added to or edited in the
+// registry file don't verify.
+//
+// The key is escrowed and withheld like a time-locked vault's. Once the
+// threshold is met, the vault stays released and the owner is notified.
+// Retrieving it before then returns 423 APPROVAL_PENDING. MetAt is only a
+// record: the unlock policy (policy.go) recounts the signed approvals on
+// every retrieve, so the (unsigned) field itself can't be used to open the
+// vault. A policy may also ask for a different number of approvals.
+
+const (
+	defaultApprovalWindow = 72 * time.Hour
+	approvalMaxSkew       = 5 * time.Minute // between approved_at and the trusted time
+)
+
+// ApprovalPolicy is the approval state of a vault.
+type ApprovalPolicy struct {
+	Approvers     []string          `json:"approvers"`
+	Keys          map[string]string `json:"keys"` // approver -> base64 uncompressed P-256 point
+	Threshold     int               `json:"threshold"`
+	WindowSeconds int64             `json:"window_seconds"`
+	Approvals     []Approval        `json:"approvals,omitempty"`
+	MetAt         *time.Time        `json:"met_at,omitempty"`
+}
+
+// Approval is one approver's signed sign-off.
+type Approval struct {
+	Approver  string    `json:"approver"`
+	Email     string    `json:"email,omitempty"`
+	At        time.Time `json:"at"`
+	Signature []byte    `json:"signature"` // P-256 r||s by the approver's key
+}
+
+func (p *ApprovalPolicy) window() time.Duration {
+	return time.Duration(p.WindowSeconds) * time.Second
+}
+
+// parseApprovalPolicy reads the approval fields of an upload. It returns nil
+// when the vault needs no approvals.
+func parseApprovalPolicy(r *http.Request) (*ApprovalPolicy, error) {
+	list := r.FormValue("approvers")
+	if list == "" {
+		return nil, nil
+	}
+	p := &ApprovalPolicy{WindowSeconds: int64(defaultApprovalWindow / time.Second)}
+	seen := map[string]bool{}
+	for _, id := range strings.Split(list, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		p.Approvers = append(p.Approvers, id)
+	}
+	if len(p.Approvers) == 0 || len(p.Approvers) > 20 {
+		return nil, fmt.Errorf("approvers must list between 1 and 20 user IDs")
+	}
+
+	var keys map[string]string
+	if err := json.Unmarshal([]byte(r.FormValue("approver_keys")), &keys); err != nil {
+		return nil, fmt.Errorf("approver_keys must be a JSON object mapping each approver to a base64 P-256 public key")
+	}
+	p.Keys = map[string]string{}
+	for _, id := range p.Approvers {
+		if _, err := parseP256PublicKey(keys[id]); err != nil {
+			return nil, fmt.Errorf("approver_keys: %s: %v", id, err)
+		}
+		p.Keys[id] = keys[id]
+	}
+
+	p.Threshold = len(p.Approvers)
+	if v := r.FormValue("approval_threshold"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > len(p.Approvers) {
+			return nil, fmt.Errorf("approval_threshold must be between 1 and the number of approvers")
+		}
+		p.Threshold = n
+	}
+	if v := r.FormValue("approval_window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Minute || d > 365*24*time.Hour {
+			return nil, fmt.Errorf("approval_window must be a duration between 1m and 8760h")
+		}
+		p.WindowSeconds = int64(d / time.Second)
+	}
+	return p, nil
+}
+
+// approvalStatement is the byte string an approver signs. The time is
+// written as RFC 3339 in UTC, with any fraction of a second trimmed of
+// trailing zeros.
+func approvalStatement(rec *VaultRecord, a *Approval) []byte {
+	return []byte(fmt.Sprintf("ChronoVault approval v2\nvault:%s\nroot:%s\napprover:%s\nat:%s\n",
+		rec.ID, rec.RootHash, a.Approver, a.At.UTC().Format(time.RFC3339Nano)))
+}
+
+// parseP256PublicKey reads a base64 uncompressed P-256 point.
+func parseP256PublicKey(b64 string) (*ecdsa.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || b64 == "" {
+		return nil, fmt.Errorf("bad public key encoding")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), raw)
+	if x == nil {
+		return nil, fmt.Errorf("not an uncompressed P-256 point")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// verifyApproval checks a's signature against its approver's pinned key.
+func verifyApproval(rec *VaultRecord, a *Approval) error {
+	key, err := parseP256PublicKey(rec.Approval.Keys[a.Approver])
+	if err != nil {
+		return fmt.Errorf("no usable key for %s: %v", a.Approver, err)
+	}
+	if len(a.Signature) != 64 {
+		return fmt.Errorf("signature is not a 64-byte r||s")
+	}
+	digest := sha256.Sum256(approvalStatement(rec, a))
+	if !ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(a.Signature[:32]), new(big.Int).SetBytes(a.Signature[32:])) {
+		return fmt.Errorf("signature does not verify")
+	}
+	return nil
+}
+
+// validApprovals returns the approvals of rec that verify, come from a
+// listed approver and fall inside the window ending at the latest of them.
+func validApprovals(rec *VaultRecord) []Approval {
+	p := rec.Approval
+	var valid []Approval
+	for _, a := range p.Approvals {
+		if !containsString(p.Approvers, a.Approver) {
+			continue
+		}
+		if err := verifyApproval(rec, &a); err != nil {
+			fmt.Printf("[Approval] Ignoring approval by %s on %s: %v\n", a.Approver, rec.ID, err)
+			continue
+		}
+		valid = append(valid, a)
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	latest := valid[0].At
+	for _, a := range valid[1:] {
+		if a.At.After(latest) {
+			latest = a.At
+		}
+	}
+	inWindow := valid[:0]
+	for _, a := range valid {
+		if latest.Sub(a.At) <= p.window() {
+			inWindow = append(inWindow, a)
+		}
+	}
+	return inWindow
+}
+
+// windowOpened returns the time of the earliest approval on record, which
+// opens the approval window.
+func windowOpened(p *ApprovalPolicy) (time.Time, bool) {
+	if len(p.Approvals) == 0 {
+		return time.Time{}, false
+	}
+	opened := p.Approvals[0].At
+	for _, a := range p.Approvals[1:] {
+		if a.At.Before(opened) {
+			opened = a.At
+		}
+	}
+	return opened, true
+}
+
+// evalApprovals decides an approvals leaf (see policy.go). min 0 means the
+// vault's threshold.
+func (e *policyEnv) evalApprovals(res *PolicyResult, min int) {
+	rec := e.rec
+	if rec.Approval == nil {
+		res.Result, res.Detail = policyFail, "vault has no approvers"
+		return
+	}
+	if min == 0 {
+		min = rec.Approval.Threshold
+	}
+	valid := validApprovals(rec)
+	approvedBy := []string{}
+	for _, a := range valid {
+		approvedBy = append(approvedBy, a.Approver)
+	}
+	res.Detail = fmt.Sprintf("%d of %d approvals", len(valid), min)
+	if len(valid) >= min {
+		res.Result = policyPass
+		return
+	}
+	res.Result, res.Code, res.status = policyFail, "APPROVAL_PENDING", http.StatusLocked
+	res.message = "Vault is waiting for approvals"
+	res.fields = map[string]interface{}{
+		"threshold":   min,
+		"approved_by": approvedBy,
+		"window":      rec.Approval.window().String(),
+	}
+}
+
+// approveHandler records the caller's signed approval of vault_id and
+// releases the vault once the threshold is met. The form carries approved_at
+// and signature, a base64 P-256 r||s over the SHA-256 of approvalStatement.
+func approveHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	userID, email := r.Header.Get("X-User-ID"), verifiedEmail(r)
+	if rec.Approval == nil {
+		writeError(w, http.StatusBadRequest, "Vault does not require approvals")
+		return
+	}
+	if !containsString(rec.Approval.Approvers, userID) {
+		auditEvent(r, "approve", rec.ID, auditOutcomeDenied, "not an approver")
+		writeError(w, http.StatusForbidden, "You are not an approver of this vault")
+		return
+	}
+
+	now, err := timeSource.Now()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "Trusted time source unavailable")
+		return
+	}
+	signedAt := r.FormValue("approved_at")
+	at, err := time.Parse(time.RFC3339Nano, signedAt)
+	if err != nil || at.UTC().Format(time.RFC3339Nano) != signedAt {
+		writeError(w, http.StatusBadRequest, "approved_at must be an RFC 3339 time in UTC, e.g. 2026-01-02T15:04:05Z")
+		return
+	}
+	if d := now.Sub(at); d > approvalMaxSkew || d < -approvalMaxSkew {
+		auditEvent(r, "approve", rec.ID, auditOutcomeDenied, "approved_at too far from the trusted time")
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("approved_at must be within %v of the server's time", approvalMaxSkew))
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.FormValue("signature"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "signature must be a base64 64-byte P-256 r||s signature")
+		return
+	}
+	a := Approval{Approver: userID, Email: email, At: at.UTC(), Signature: sig}
+	if err := verifyApproval(rec, &a); err != nil {
+		auditEvent(r, "approve", rec.ID, auditOutcomeDenied, err.Error())
+		writeError(w, http.StatusForbidden, "Approval signature does not verify with your approver key")
+		return
+	}
+
+	var updated VaultRecord
+	met := false
+	var lapsedAt time.Time
+	err = vaults.Update(rec.ID, func(v *VaultRecord) error {
+		if v.Approval == nil {
+			return fmt.Errorf("vault does not require approvals")
+		}
+		p := *v.Approval
+		if p.MetAt != nil {
+			return fmt.Errorf("vault has already been approved")
+		}
+		// Past the window, the earlier approvals have lapsed and this one
+		// opens a new window.
+		if opened, ok := windowOpened(&p); ok && a.At.Sub(opened) > p.window() {
+			lapsedAt = opened.Add(p.window())
+			p.Approvals = nil
+		}
+		// A repeat approval replaces the approver's earlier one, moving it
+		// forward in the window.
+		var approvals []Approval
+		for _, prev := range p.Approvals {
+			if prev.Approver != userID {
+				approvals = append(approvals, prev)
+			}
+		}
+		p.Approvals = append(approvals, a)
+		v.Approval = &p
+		if len(validApprovals(v)) >= p.Threshold {
+			p.MetAt = &a.At
+			met = true
+		}
+		updated = *v
+		return nil
+	})
+	if err != nil {
+		auditEvent(r, "approve", rec.ID, auditOutcomeDenied, err.Error())
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	valid := validApprovals(&updated)
+	detail := fmt.Sprintf("%d of %d approvals", len(valid), updated.Approval.Threshold)
+	if !lapsedAt.IsZero() {
+		detail += ", earlier approvals lapsed at " + lapsedAt.Format(time.RFC3339)
+	}
+	auditEvent(r, "approve", rec.ID, auditOutcomeSuccess, detail)
+	if met {
+		fmt.Printf("[Approval] Vault %s approved\n", rec.ID)
+		notifyAsync(Notification{
+			Kind:    "approval.met",
+			VaultID: rec.ID,
+			To:      ownerRecipients(&updated),
+			Subject: fmt.Sprintf("Your vault %s has been approved", updated.FileName),
+			Body:    fmt.Sprintf("%d of %d approvers signed off. The vault can now be retrieved.", len(valid), len(updated.Approval.Approvers)),
+		})
+	}
+
+	approvedBy := []string{}
+	for _, v := range valid {
+		approvedBy = append(approvedBy, v.Approver)
+	}
+	resp := map[string]interface{}{
+		"vault_id":    rec.ID,
+		"approved":    met,
+		"threshold":   updated.Approval.Threshold,
+		"approved_by": approvedBy,
+	}
+	if !lapsedAt.IsZero() {
+		resp["lapsed_at"] = lapsedAt.Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
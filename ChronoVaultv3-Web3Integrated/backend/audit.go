@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Audit Log ---
+//
+// Security-relevant events are appended to <VAULT_DATA_DIR>/audit/audit.log.
+// Each line is one JSON AuditEntry: who (JWT sub and client IP), what,
+// which vault, with what outcome and when. Every entry carries the SHA-256
+// of its predecessor, so removing, reordering or editing a line breaks the
+// chain from that point on.
+//
+// A chain alone doesn't stop someone who can write the file from rewriting
+// all of it. Every AUDIT_CHECKPOINT_INTERVAL (default 1h) the head of the
+// chain is written to checkpoints.log, signed with the manifest signing key
+// when one is configured, and printed to the console so it also lands in
+// whatever collects the server's output. History before a signed checkpoint
+// can't be rewritten without the key, and a truncated log falls short of its
+// checkpoints.
+//
+// `chronovault audit-verify` checks both files. Vault owners read the
+// entries of their own vaults at GET /v1/audit.
+
+const (
+	auditOutcomeSuccess = "success"
+	auditOutcomeDenied  = "denied"
+	auditOutcomeFailed  = "failed"
+
+	defaultAuditCheckpointInterval = time.Hour
+)
+
+// AuditEntry is one line of the audit log.
+type AuditEntry struct {
+	Seq     uint64    `json:"seq"`
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"` // JWT sub, or "anonymous"
+	IP      string    `json:"ip,omitempty"`
+	Action  string    `json:"action"`
+	VaultID string    `json:"vault_id,omitempty"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"`
+	Prev    string    `json:"prev"` // hash of the previous entry
+	Hash    string    `json:"hash"` // SHA-256 of this entry with hash empty
+}
+
+// auditGenesis is the Prev of the first entry.
+var auditGenesis = strings.Repeat("0", 64)
+
+func (e AuditEntry) computeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// auditCheckpoint records the head of the chain.
+type auditCheckpoint struct {
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	At        time.Time `json:"at"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+// statement is the byte string a checkpoint signature covers.
+func (c auditCheckpoint) statement() []byte {
+	return []byte(fmt.Sprintf("ChronoVault audit checkpoint v1\nseq:%d\nhash:%s\nat:%s\n",
+		c.Seq, c.Hash, c.At.UTC().Format(time.RFC3339Nano)))
+}
+
+type auditLog struct {
+	mu           sync.Mutex
+	dir          string
+	f            *os.File
+	seq          uint64 // of the last entry
+	head         string // hash of the last entry
+	size         int64  // bytes of audit.log written so far
+	checkpointed uint64 // seq of the last checkpoint
+}
+
+var audit = &auditLog{}
+
+// initAuditLog opens the log next to the vault registry.
+func initAuditLog() {
+	if err := audit.open(filepath.Join(vaults.dir, "audit")); err != nil {
+		fmt.Printf("⚠️  Audit log unavailable: %v\n", err)
+		return
+	}
+	fmt.Printf("🧾 Audit log: %d entries, last checkpoint at #%d\n", audit.seq, audit.checkpointed)
+}
+
+func (l *auditLog) open(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	entries, problems, err := readAuditEntries(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		// Keep appending: the damage stays visible to audit-verify.
+		fmt.Printf("⚠️  Audit log is damaged (%s); run `chronovault audit-verify`\n", problems[0])
+	}
+	checkpoints, err := readAuditCheckpoints(filepath.Join(dir, "checkpoints.log"))
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "audit.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.dir, l.f, l.size = dir, f, fi.Size()
+	l.seq, l.head = 0, auditGenesis
+	if n := len(entries); n > 0 {
+		l.seq, l.head = entries[n-1].Seq, entries[n-1].Hash
+	}
+	if n := len(checkpoints); n > 0 {
+		l.checkpointed = checkpoints[n-1].Seq
+	}
+	return nil
+}
+
+// Append chains e onto the log and syncs it to disk. Seq, At, Prev and Hash
+// are filled in.
+func (l *auditLog) Append(e *AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("audit log not initialised")
+	}
+	e.Seq, e.At, e.Prev = l.seq+1, time.Now().UTC(), l.head
+	e.Hash = e.computeHash()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	n, err := l.f.Write(append(data, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.seq, l.head = e.Seq, e.Hash
+	return nil
+}
+
+// snapshot returns the log's path and how much of it holds complete
+// entries, or "" before the log is open.
+func (l *auditLog) snapshot() (string, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dir == "" {
+		return "", 0
+	}
+	return filepath.Join(l.dir, "audit.log"), l.size
+}
+
+// auditEvent records an event of the request's caller. A failed write is
+// reported but doesn't fail the request.
+func auditEvent(r *http.Request, action, vaultID, outcome, detail string) {
+	auditAs(r.Header.Get("X-User-ID"), extractIP(r), action, vaultID, outcome, detail)
+}
+
+// auditAs is auditEvent for work that outlives its request, such as an
+// upload job.
+func auditAs(actor, ip, action, vaultID, outcome, detail string) {
+	if actor == "" {
+		actor = "anonymous"
+	}
+	e := &AuditEntry{Actor: actor, IP: ip, Action: action, VaultID: vaultID, Outcome: outcome, Detail: detail}
+	if err := audit.Append(e); err != nil {
+		fmt.Printf("⚠️  [Audit] Failed to record %s %s: %v\n", action, outcome, err)
+	}
+}
+
+// Checkpoint writes the head of the chain to checkpoints.log if anything was
+// appended since the last checkpoint.
+func (l *auditLog) Checkpoint() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil || l.seq == l.checkpointed {
+		return nil
+	}
+	cp := auditCheckpoint{Seq: l.seq, Hash: l.head, At: time.Now().UTC()}
+	sig, err := keyProvider.SignManifest(cp.statement())
+	if err != nil && !errors.Is(err, errKeyUnavailable) {
+		return err
+	}
+	cp.Signature = sig
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(l.dir, "checkpoints.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	l.checkpointed = cp.Seq
+	signed := "unsigned"
+	if sig != nil {
+		signed = "signed"
+	}
+	fmt.Printf("[Audit] Checkpoint #%d %s (%s)\n", cp.Seq, cp.Hash, signed)
+	return nil
+}
+
+// runAuditCheckpoints checkpoints the log every audit_checkpoint_interval.
+func runAuditCheckpoints() {
+	ticker := time.NewTicker(cfg.AuditCheckpointInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := audit.Checkpoint(); err != nil {
+			fmt.Printf("⚠️  [Audit] Checkpoint failed: %v\n", err)
+		}
+	}
+}
+
+// --- Rejected Tokens ---
+//
+// Anyone can present a bad bearer token, and an entry written and synced for
+// each one would let clients fill the disk and stall every other writer. The
+// first rejection from an IP in each authFailureWindow is recorded as it
+// happens; the rest are counted and recorded as one entry per IP when the
+// window closes. Past authFailureMaxIPs addresses in a window, further ones
+// are only counted together.
+
+const (
+	authFailureWindow = time.Minute
+	authFailureMaxIPs = 1000
+)
+
+type authFailureTally struct {
+	count  int    // rejections after the one recorded
+	reason string // of the latest
+}
+
+var authFailures = struct {
+	mu       sync.Mutex
+	ips      map[string]*authFailureTally
+	overflow int
+}{ips: make(map[string]*authFailureTally)}
+
+// auditAuthFailure records a rejected token presented from ip.
+func auditAuthFailure(ip, reason string) {
+	authFailures.mu.Lock()
+	record := false
+	if t, ok := authFailures.ips[ip]; ok {
+		t.count++
+		t.reason = reason
+	} else if len(authFailures.ips) < authFailureMaxIPs {
+		authFailures.ips[ip] = &authFailureTally{}
+		record = true
+	} else {
+		authFailures.overflow++
+	}
+	authFailures.mu.Unlock()
+	if record {
+		auditAs("", ip, "auth", "", auditOutcomeDenied, reason)
+	}
+}
+
+// flushAuthFailures records what auditAuthFailure counted and opens a new
+// window.
+func flushAuthFailures() {
+	authFailures.mu.Lock()
+	ips, overflow := authFailures.ips, authFailures.overflow
+	authFailures.ips, authFailures.overflow = make(map[string]*authFailureTally), 0
+	authFailures.mu.Unlock()
+
+	for ip, t := range ips {
+		if t.count > 0 {
+			auditAs("", ip, "auth", "", auditOutcomeDenied,
+				fmt.Sprintf("%d more rejected tokens in %v, latest: %s", t.count, authFailureWindow, t.reason))
+		}
+	}
+	if overflow > 0 {
+		auditAs("", "", "auth", "", auditOutcomeDenied,
+			fmt.Sprintf("%d rejected tokens in %v from addresses beyond the first %d", overflow, authFailureWindow, authFailureMaxIPs))
+	}
+}
+
+// runAuthFailureFlush closes a rejected-token window every
+// authFailureWindow.
+func runAuthFailureFlush() {
+	ticker := time.NewTicker(authFailureWindow)
+	defer ticker.Stop()
+	for range ticker.C {
+		flushAuthFailures()
+	}
+}
+
+// --- Reading and Verification ---
+
+// readAuditEntries returns the entries of a log, and a description of every
+// gap, edit or unreadable line. A missing file is an empty log.
+func readAuditEntries(path string) ([]AuditEntry, []string, error) {
+	return readAuditPrefix(path, -1)
+}
+
+// readAuditPrefix is readAuditEntries for the first size bytes of the file,
+// or all of it when size is negative.
+func readAuditPrefix(path string, size int64) ([]AuditEntry, []string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if size >= 0 {
+		in = io.LimitReader(f, size)
+	}
+
+	var entries []AuditEntry
+	var problems []string
+	prev, seq := auditGenesis, uint64(0)
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		var e AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: unreadable entry", line))
+			continue
+		}
+		if e.Seq != seq+1 {
+			problems = append(problems, fmt.Sprintf("line %d: seq %d follows %d (entries missing or reordered)", line, e.Seq, seq))
+		}
+		if e.Prev != prev {
+			problems = append(problems, fmt.Sprintf("line %d: seq %d does not chain onto the entry before it", line, e.Seq))
+		}
+		if e.computeHash() != e.Hash {
+			problems = append(problems, fmt.Sprintf("line %d: seq %d has been edited", line, e.Seq))
+		}
+		entries = append(entries, e)
+		prev, seq = e.Hash, e.Seq
+	}
+	return entries, problems, sc.Err()
+}
+
+func readAuditCheckpoints(path string) ([]auditCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []auditCheckpoint
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var cp auditCheckpoint
+		if err := json.Unmarshal([]byte(line), &cp); err != nil {
+			return nil, fmt.Errorf("checkpoints.log line %d: %w", i+1, err)
+		}
+		out = append(out, cp)
+	}
+	return out, nil
+}
+
+// runAuditVerify checks an audit directory (default
+// <vault_data_dir>/audit) and fails if anything has been tampered with.
+func runAuditVerify(args []string) error {
+	dir := filepath.Join(cfg.VaultDataDir, "audit")
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	initKeyProvider()
+
+	entries, problems, err := readAuditEntries(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		return err
+	}
+	checkpoints, err := readAuditCheckpoints(filepath.Join(dir, "checkpoints.log"))
+	if err != nil {
+		return err
+	}
+	bySeq := make(map[uint64]AuditEntry, len(entries))
+	for _, e := range entries {
+		bySeq[e.Seq] = e
+	}
+	signed := 0
+	for _, cp := range checkpoints {
+		if cp.Signature != nil {
+			if err := keyProvider.VerifyManifest(cp.statement(), cp.Signature); err != nil {
+				problems = append(problems, fmt.Sprintf("checkpoint #%d: signature invalid: %v", cp.Seq, err))
+			} else {
+				signed++
+			}
+		}
+		e, ok := bySeq[cp.Seq]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("checkpoint #%d: entry missing from the log (truncated?)", cp.Seq))
+		case e.Hash != cp.Hash:
+			problems = append(problems, fmt.Sprintf("checkpoint #%d: entry differs from the checkpointed one (rewritten?)", cp.Seq))
+		}
+	}
+
+	var last uint64
+	if n := len(checkpoints); n > 0 {
+		last = checkpoints[n-1].Seq
+	}
+	var tail int
+	for _, e := range entries {
+		if e.Seq > last {
+			tail++
+		}
+	}
+	fmt.Printf("[Audit] %s: %d entries, %d checkpoints (%d with a valid signature), %d entries after the last checkpoint\n",
+		dir, len(entries), len(checkpoints), signed, tail)
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("  ✗ %s\n", p)
+		}
+		return fmt.Errorf("audit log failed verification (%d problems)", len(problems))
+	}
+	fmt.Println("[Audit] Chain intact.")
+	return nil
+}
+
+// --- Query Endpoint ---
+
+// AuditPage is the response of GET /v1/audit.
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	NextBefore uint64       `json:"next_before,omitempty"`
+}
+
+// listAuditHandler returns the entries about the caller's vaults, newest
+// first. before pages backwards by seq.
+func listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = n
+	}
+	var before uint64
+	if v := q.Get("before"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid before")
+			return
+		}
+		before = n
+	}
+	userID := r.Header.Get("X-User-ID")
+	vaultID := q.Get("vault_id")
+	if vaultID != "" {
+		if rec, err := vaults.Get(vaultID); err != nil || rec.Owner != userID {
+			writeError(w, http.StatusNotFound, "Vault not found")
+			return
+		}
+	}
+
+	// Only the bytes written when the snapshot was taken are read, which keeps
+	// a half-written entry out without holding up writers during the read.
+	path, size := audit.snapshot()
+	var entries []AuditEntry
+	var err error
+	if path != "" {
+		entries, _, err = readAuditPrefix(path, size)
+	}
+	if path == "" || err != nil {
+		writeError(w, http.StatusServiceUnavailable, "Audit log unavailable")
+		return
+	}
+
+	owned := map[string]bool{}
+	for _, rec := range vaults.List() {
+		if rec.Owner == userID {
+			owned[rec.ID] = true
+		}
+	}
+	out := AuditPage{Entries: []AuditEntry{}}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if !owned[e.VaultID] || (vaultID != "" && e.VaultID != vaultID) || (before != 0 && e.Seq >= before) {
+			continue
+		}
+		if len(out.Entries) == limit {
+			out.NextBefore = out.Entries[limit-1].Seq
+			break
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
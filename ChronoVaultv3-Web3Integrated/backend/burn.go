@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// --- One-Time (Burn-After-Read) Vaults ---
+//
+// A vault uploaded with one_time=true escrows and withholds its key, so the
+// server is the only way to open it. The first successful /retrieve burns
+// it. The record is marked consumed, the escrowed key is destroyed, and the
+// chunks go onto the unpin queue (queue.go) like an expired vault's.
+//
+// Two concurrent retrieves must not both succeed. Checking "not consumed"
+// before decrypting and marking it consumed afterwards would let both pass
+// the check, so /retrieve claims the vault first. The claim is an atomic
+// compare-and-set on the record, and a second retrieve sees it and is
+// refused. A failed attempt (wrong data, IPFS outage) abandons the claim so
+// the vault isn't burned by an error. The claim is a lease: if the server
+// dies mid-retrieve, it expires after oneTimeClaimTTL instead of locking the
+// vault forever.
+
+const oneTimeClaimTTL = 5 * time.Minute
+
+var (
+	errVaultConsumed = errors.New("vault has already been read")
+	errVaultBusy     = errors.New("vault is being read by another request")
+)
+
+// claimOneTime reserves a one-time vault for this request and returns the
+// claim token.
+func claimOneTime(id string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("CSPRNG failure generating claim token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	now := time.Now().UTC()
+
+	err := vaults.Update(id, func(r *VaultRecord) error {
+		if r.ConsumedAt != nil {
+			return errVaultConsumed
+		}
+		if err := checkMutable(r); err != nil {
+			return err
+		}
+		if r.ClaimUntil != nil && now.Before(*r.ClaimUntil) {
+			return errVaultBusy
+		}
+		until := now.Add(oneTimeClaimTTL)
+		r.ClaimToken, r.ClaimUntil = token, &until
+		return nil
+	})
+	return token, err
+}
+
+// abandonOneTime releases a claim after a failed retrieve.
+func abandonOneTime(id, token string) {
+	vaults.Update(id, func(r *VaultRecord) error {
+		if r.ClaimToken != token {
+			return fmt.Errorf("claim lost")
+		}
+		r.ClaimToken, r.ClaimUntil = "", nil
+		return nil
+	})
+}
+
+// consumeOneTime burns the vault. It fails if the claim was lost (lease
+// expired and another request took it), in which case the caller must not
+// serve the plaintext.
+func consumeOneTime(id, token string) error {
+	now := time.Now().UTC()
+	var rec VaultRecord
+	var escrowed []byte
+	err := vaults.Update(id, func(r *VaultRecord) error {
+		if r.ClaimToken != token || r.ConsumedAt != nil {
+			return fmt.Errorf("claim on %s lost", id)
+		}
+		if err := checkMutable(r); err != nil {
+			return err
+		}
+		escrowed = r.EscrowedKey
+		r.ConsumedAt, r.EscrowedKey = &now, nil
+		r.ClaimToken, r.ClaimUntil = "", nil
+		r.Deletion = newDeletion(r, "burn-after-read", now, escrowed != nil)
+		rec = *r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	wipe(escrowed) // only once the consumed record is on disk
+	fmt.Printf("[BurnAfterRead] Vault %s consumed; escrowed key destroyed\n", id)
+	// Copies already cached elsewhere in the IPFS network are out of reach;
+	// with the key destroyed they are undecryptable anyway.
+	if err := unpins.Enqueue(id, rec.CIDs); err != nil {
+		fmt.Printf("[BurnAfterRead] Vault %s: unpin not queued: %v\n", id, err)
+	}
+	return nil
+}
+
+// writeConsumed answers a retrieve of a burned or busy vault.
+func writeConsumed(w http.ResponseWriter, rec *VaultRecord, err error) {
+	if errors.Is(err, errLegalHold) {
+		writeLegalHold(w, rec)
+		return
+	}
+	if errors.Is(err, errVaultBusy) {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":    "One-time vault is being read by another request",
+			"code":     "VAULT_BUSY",
+			"vault_id": rec.ID,
+		})
+		return
+	}
+	body := map[string]string{
+		"error":    "One-time vault has already been read and destroyed",
+		"code":     "VAULT_CONSUMED",
+		"vault_id": rec.ID,
+	}
+	if latest, getErr := vaults.Get(rec.ID); getErr == nil && latest.ConsumedAt != nil {
+		body["consumed_at"] = latest.ConsumedAt.Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusGone, body)
+}
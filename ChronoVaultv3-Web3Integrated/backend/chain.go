@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Vault Chains ---
+//
+// Serial unlocking: a vault uploaded with chain_after=<id>[,<id>...] stays
+// sealed until every vault it depends on has been unlocked. A vault only
+// counts as unlocked after passing its whole unlock policy (policy.go):
+// through a successful /retrieve, or through unlockThroughPolicy when an AI
+// unlock handler is given its vault_id. The edges form a DAG. Dependencies must already exist when a
+// vault is uploaded, so there can be no cycles, and every vault in a chain
+// shares the ChainID of its first root.
+//
+// A chained vault's key is escrowed and withheld like a time-locked one.
+// Unlocking a vault releases each dependent whose dependencies are now all
+// unlocked, and the owner is notified. Retrieving a vault before that
+// happens is refused with 423 CHAIN_LOCKED and the list of vaults it is
+// waiting on. /vault/chain reports the state of the whole chain.
+
+// ChainLink places a vault in a chain.
+type ChainLink struct {
+	ChainID    string     `json:"chain_id"`
+	DependsOn  []string   `json:"depends_on"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+}
+
+// parseChainAfter validates chain_after for an upload by owner. It returns
+// nil when the vault is not chained.
+func parseChainAfter(value, owner string) (*ChainLink, error) {
+	if value == "" {
+		return nil, nil
+	}
+	link := &ChainLink{}
+	seen := map[string]bool{}
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if !isValidVaultID(id) {
+			return nil, fmt.Errorf("chain_after contains an invalid vault ID")
+		}
+		dep, err := vaults.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("chain_after vault %s does not exist", id)
+		}
+		if dep.Owner != owner {
+			return nil, fmt.Errorf("chain_after vault %s belongs to another user", id)
+		}
+		if link.ChainID == "" {
+			link.ChainID = dep.ID
+			if dep.Chain != nil {
+				link.ChainID = dep.Chain.ChainID
+			}
+		}
+		seen[id] = true
+		link.DependsOn = append(link.DependsOn, id)
+	}
+	if len(link.DependsOn) == 0 {
+		return nil, nil
+	}
+	return link, nil
+}
+
+// pendingDependencies lists the dependencies of rec not yet unlocked.
+func pendingDependencies(rec *VaultRecord) []string {
+	if rec.Chain == nil {
+		return nil
+	}
+	var pending []string
+	for _, id := range rec.Chain.DependsOn {
+		dep, err := vaults.Get(id)
+		if err != nil || dep.UnlockedAt == nil {
+			pending = append(pending, id)
+		}
+	}
+	return pending
+}
+
+// evalChain decides the chain leaf of rec's policy (see policy.go).
+func (e *policyEnv) evalChain(res *PolicyResult) {
+	rec := e.rec
+	if rec.Chain.ReleasedAt != nil {
+		res.Result, res.Detail = policyPass, "released"
+		return
+	}
+	pending := pendingDependencies(rec)
+	if len(pending) == 0 {
+		// Every dependency is unlocked but the cascade never ran (a crash
+		// between the two writes). Evaluation never writes, so the release
+		// itself is left to the next markVaultUnlocked.
+		res.Result, res.Detail = policyPass, "dependencies unlocked"
+		return
+	}
+	res.Result, res.Code, res.status = policyFail, "CHAIN_LOCKED", http.StatusLocked
+	res.Detail = fmt.Sprintf("waiting on %d vault(s)", len(pending))
+	res.message = "Vault is waiting on earlier vaults in its chain"
+	res.fields = map[string]interface{}{
+		"chain_id":   rec.Chain.ChainID,
+		"waiting_on": pending,
+	}
+}
+
+// checkChainLock returns nil when rec is not waiting on its chain.
+// Otherwise it writes a 423 and returns a non-nil error.
+func checkChainLock(w http.ResponseWriter, rec *VaultRecord) error {
+	if rec.Chain == nil {
+		return nil
+	}
+	res := &PolicyResult{Kind: "chain"}
+	(&policyEnv{rec: rec}).evalChain(res)
+	if res.passed() {
+		return nil
+	}
+	body := map[string]interface{}{"error": res.message, "code": res.Code, "vault_id": rec.ID}
+	for k, v := range res.fields {
+		body[k] = v
+	}
+	writeJSON(w, res.status, body)
+	return fmt.Errorf("vault %s chain-locked", rec.ID)
+}
+
+// markVaultUnlocked records the first unlock of a vault and releases every
+// dependent that was only waiting on it. It returns the released IDs.
+// Callers must have passed checkUnlockPolicy for the vault, or call
+// unlockThroughPolicy instead.
+func markVaultUnlocked(id, via string) []string {
+	now := time.Now().UTC()
+	first := false
+	err := vaults.Update(id, func(r *VaultRecord) error {
+		if r.UnlockedAt != nil {
+			return fmt.Errorf("already unlocked")
+		}
+		r.UnlockedAt, r.UnlockedVia, first = &now, via, true
+		return nil
+	})
+	if err != nil || !first {
+		return nil
+	}
+	fmt.Printf("[Chain] Vault %s unlocked via %s\n", id, via)
+
+	var released []string
+	for _, rec := range vaults.List() {
+		if rec.Chain == nil || rec.Chain.ReleasedAt != nil || !containsString(rec.Chain.DependsOn, id) {
+			continue
+		}
+		if len(pendingDependencies(rec)) == 0 && releaseChained(rec.ID, now) {
+			released = append(released, rec.ID)
+		}
+	}
+	return released
+}
+
+// unlockThroughPolicy marks vault id unlocked, cascading to its chain, only
+// if its full unlock policy now passes for r. It is for unlocks that don't
+// release a key themselves, like the AI handlers. unlocked is false when the
+// policy still refuses; res then explains why. Either way it is audited.
+func unlockThroughPolicy(r *http.Request, id, via string) (released []string, res *PolicyResult, unlocked bool) {
+	rec, err := vaults.Get(id)
+	if err != nil {
+		return nil, nil, false
+	}
+	res, err = evalUnlockPolicy(r, rec)
+	if err != nil {
+		fmt.Printf("[Chain] Vault %s has an unusable policy: %v\n", id, err)
+		auditEvent(r, "unlock", id, auditOutcomeFailed, via+": unusable policy")
+		return nil, nil, false
+	}
+	if res != nil && !res.passed() {
+		fmt.Printf("[Chain] Vault %s not unlocked via %s: policy not satisfied\n", id, via)
+		auditEvent(r, "unlock", id, auditOutcomeDenied, via+": policy not satisfied")
+		return nil, res, false
+	}
+	released = markVaultUnlocked(id, via)
+	auditEvent(r, "unlock", id, auditOutcomeSuccess, fmt.Sprintf("%s, %d chained vault(s) released", via, len(released)))
+	return released, res, true
+}
+
+// releaseChained marks a chained vault released and tells the owner.
+func releaseChained(id string, now time.Time) bool {
+	var rec VaultRecord
+	err := vaults.Update(id, func(r *VaultRecord) error {
+		if r.Chain == nil || r.Chain.ReleasedAt != nil {
+			return fmt.Errorf("not releasable")
+		}
+		link := *r.Chain
+		link.ReleasedAt = &now
+		r.Chain = &link
+		rec = *r
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+	fmt.Printf("[Chain] Vault %s released (chain %s)\n", id, rec.Chain.ChainID)
+	notifyAsync(Notification{
+		Kind:    "chain.released",
+		VaultID: id,
+		To:      ownerRecipients(&rec),
+		Subject: fmt.Sprintf("The next vault in your chain (%s) is now open", rec.FileName),
+		Body:    fmt.Sprintf("Every vault that %s depends on has been unlocked. It can now be retrieved.", id),
+	})
+	return true
+}
+
+// chainPrecheck is used by the AI unlock handlers before they start a scan:
+// it resolves an optional vault_id and refuses out-of-order unlocks early.
+// It is not the gate: a scan that passes still goes through
+// unlockThroughPolicy. It returns ok=false after writing an error response.
+func chainPrecheck(w http.ResponseWriter, vaultID, userID string) (rec *VaultRecord, ok bool) {
+	if vaultID == "" {
+		return nil, true
+	}
+	if !isValidVaultID(vaultID) {
+		writeError(w, http.StatusBadRequest, "Invalid vault_id")
+		return nil, false
+	}
+	rec, err := vaults.Get(vaultID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Vault not found")
+		return nil, false
+	}
+	if rec.Owner != userID {
+		writeError(w, http.StatusForbidden, "Only the vault owner can unlock it")
+		return nil, false
+	}
+	if err := checkChainLock(w, rec); err != nil {
+		fmt.Printf("[Chain] Refused AI unlock: %v\n", err)
+		return nil, false
+	}
+	return rec, true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Chain Status ---
+
+type chainNode struct {
+	VaultID    string      `json:"vault_id"`
+	FileName   string      `json:"file_name"`
+	DependsOn  []string    `json:"depends_on"`
+	State      string      `json:"state"` // "locked", "released" or "unlocked"
+	ReleasedAt string      `json:"released_at,omitempty"`
+	UnlockedAt string      `json:"unlocked_at,omitempty"`
+	LegalHold  bool        `json:"legal_hold"`
+	NextWindow *windowInfo `json:"next_window,omitempty"`
+}
+
+// chainHandler returns the dependency graph and progress of the chain that
+// vault_id belongs to, in upload order.
+func chainHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	if rec.Owner != r.Header.Get("X-User-ID") {
+		writeError(w, http.StatusForbidden, "Only the vault owner can view its chain")
+		return
+	}
+	chainID := rec.ID
+	if rec.Chain != nil {
+		chainID = rec.Chain.ChainID
+	}
+
+	var nodes []chainNode
+	unlocked := 0
+	for _, v := range vaults.List() {
+		if v.ID != chainID && (v.Chain == nil || v.Chain.ChainID != chainID) {
+			continue
+		}
+		n := chainNode{VaultID: v.ID, FileName: v.FileName, DependsOn: []string{}, State: "locked",
+			LegalHold: v.LegalHold != nil, NextWindow: nextWindow(v, windowClock())}
+		if v.Chain == nil || v.Chain.ReleasedAt != nil {
+			n.State = "released"
+		}
+		if v.Chain != nil {
+			n.DependsOn = v.Chain.DependsOn
+			if v.Chain.ReleasedAt != nil {
+				n.ReleasedAt = v.Chain.ReleasedAt.Format(time.RFC3339)
+			}
+		}
+		if v.UnlockedAt != nil {
+			n.State = "unlocked"
+			n.UnlockedAt = v.UnlockedAt.Format(time.RFC3339)
+			unlocked++
+		}
+		nodes = append(nodes, n)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"chain_id": chainID,
+		"unlocked": unlocked,
+		"total":    len(nodes),
+		"vaults":   nodes,
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// --- CLI Subcommands ---
+//
+// Everything that isn't "server" runs locally against files on disk, so the
+// same binary that serves /retrieve can open a capsule fully offline.
+
+func printUsage() {
+	fmt.Println("Usage: chronovault [-config file] [-profile name] [-<setting> value ...] [command]")
+	fmt.Println()
+	fmt.Println("Any setting can be given as a flag before the command, e.g. -chunk-size 512KB;")
+	fmt.Println("`chronovault config` lists them. See the README for files, profiles and env vars.")
+	fmt.Println()
+	fmt.Println("  (none)                         run the local encrypt/restore simulation")
+	fmt.Println("  server | web                   start the HTTP server")
+	fmt.Println("  config                         print the effective configuration, secrets redacted")
+	fmt.Println("  keygen <name>                  create a hybrid X25519+ML-KEM-768 key pair")
+	fmt.Println("  unwrap <manifest> <kem_key>    print the hex data key from a wrapped manifest")
+	fmt.Println("  openapi [-generate] [file]     check (or regenerate) openapi.json against the API")
+	fmt.Println("  audit-verify [dir]             check the audit log's hash chain and checkpoints")
+	fmt.Println("  solve-puzzle <manifest> [-checkpoint file]")
+	fmt.Println("                                 solve a time-lock puzzle offline and print the hex data key")
+	fmt.Println("  puzzle-bench                   measure this machine's squaring rate")
+}
+
+// runKeygen writes <name>.kem.key (private, 0600) and <name>.kem.pub.
+// Both files are base64 so they can be pasted into the upload form.
+func runKeygen(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: keygen <name>")
+	}
+	priv, err := GenerateHybridKey()
+	if err != nil {
+		return err
+	}
+
+	privFile, pubFile := args[0]+".kem.key", args[0]+".kem.pub"
+	if err := os.WriteFile(privFile, []byte(base64.StdEncoding.EncodeToString(priv.Bytes())+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(pubFile, []byte(base64.StdEncoding.EncodeToString(priv.Public().Bytes())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	fmt.Printf("[KEM] %s key pair written: %s (keep secret), %s (share for uploads)\n", kemSuite, privFile, pubFile)
+	return nil
+}
+
+// runUnwrap recovers the data key from a wrapped manifest. The key is the
+// only thing written to stdout so the output can be redirected to a key file.
+func runUnwrap(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: unwrap <manifest> <kem_key>")
+	}
+	manifest, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	privBytes, err := os.ReadFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	key, err := unwrapManifestKey(string(manifest), privBytes)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hex.EncodeToString(key))
+	return nil
+}
+
+// unwrapManifestKey is the code path shared by the CLI and the vector tests.
+func unwrapManifestKey(manifest string, privBytes []byte) ([]byte, error) {
+	wrapped, err := ParseManifestKeyWrap(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if wrapped == nil {
+		return nil, fmt.Errorf("manifest has no Key-Wrap headers (vault was not wrapped)")
+	}
+	priv, err := ParseHybridPrivateKey(privBytes)
+	if err != nil {
+		return nil, err
+	}
+	return UnwrapDataKey(priv, wrapped)
+}
+
+// --- Time-Lock Puzzles ---
+
+const puzzleCheckpointInterval = 30 * time.Second
+
+// runSolvePuzzle grinds through a manifest's RSW puzzle. Progress goes to
+// stderr and only the hex key to stdout. State is checkpointed every 30s and
+// on Ctrl-C; rerunning the same command resumes from the checkpoint.
+func runSolvePuzzle(args []string) error {
+	var manifestPath, checkpointPath string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-checkpoint" && i+1 < len(args) {
+			checkpointPath = args[i+1]
+			i++
+		} else if manifestPath == "" {
+			manifestPath = args[i]
+		} else {
+			return fmt.Errorf("usage: solve-puzzle <manifest> [-checkpoint file]")
+		}
+	}
+	if manifestPath == "" {
+		return fmt.Errorf("usage: solve-puzzle <manifest> [-checkpoint file]")
+	}
+	if checkpointPath == "" {
+		checkpointPath = manifestPath + ".checkpoint"
+	}
+
+	manifest, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	pz, err := ParseManifestPuzzle(string(manifest))
+	if err != nil {
+		return err
+	}
+	if pz == nil {
+		return fmt.Errorf("manifest has no Puzzle headers (vault was not puzzle-locked)")
+	}
+
+	var cp *puzzleCheckpoint
+	if data, err := os.ReadFile(checkpointPath); err == nil {
+		cp = &puzzleCheckpoint{}
+		if err := json.Unmarshal(data, cp); err != nil {
+			return fmt.Errorf("failed to parse checkpoint %s: %w", checkpointPath, err)
+		}
+		fmt.Fprintf(os.Stderr, "[Puzzle] Resuming from %s at %d/%d squarings\n", checkpointPath, cp.Done, pz.T)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "[Puzzle] %d squarings, about %v at the creator's rate of %d/s\n",
+			pz.T, pz.Estimate().Round(time.Second), pz.Rate)
+	}
+
+	save := func(c *puzzleCheckpoint) error {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(checkpointPath, data, 0600)
+	}
+
+	var interrupted atomic.Bool
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		if _, ok := <-sigs; ok {
+			interrupted.Store(true)
+		}
+	}()
+
+	start := time.Now()
+	var startDone uint64
+	if cp != nil {
+		startDone = cp.Done
+	}
+	lastReport := start
+	progress := func(done uint64) {
+		if time.Since(lastReport) < 5*time.Second && done < pz.T {
+			return
+		}
+		lastReport = time.Now()
+		elapsed := time.Since(start).Seconds()
+		rate := float64(done-startDone) / elapsed
+		eta := "?"
+		if rate > 0 {
+			eta = (time.Duration(float64(pz.T-done)/rate) * time.Second).Round(time.Second).String()
+		}
+		fmt.Fprintf(os.Stderr, "[Puzzle] %6.2f%%  %d/%d  %.0f/s  ETA %s\n",
+			100*float64(done)/float64(pz.T), done, pz.T, rate, eta)
+	}
+
+	b, last, err := SolvePuzzle(pz, cp, puzzleCheckpointInterval, save, progress, interrupted.Load)
+	if errors.Is(err, errPuzzleInterrupted) {
+		if saveErr := save(last); saveErr != nil {
+			return fmt.Errorf("interrupted, and checkpoint write failed: %w", saveErr)
+		}
+		fmt.Fprintf(os.Stderr, "[Puzzle] Interrupted. Progress saved to %s; rerun to resume.\n", checkpointPath)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	key, err := pz.Open(b)
+	if err != nil {
+		return err
+	}
+	os.Remove(checkpointPath)
+	fmt.Fprintf(os.Stderr, "[Puzzle] Solved in %v.\n", time.Since(start).Round(time.Second))
+	fmt.Println(hex.EncodeToString(key))
+	wipe(key)
+	return nil
+}
+
+// runPuzzleBench prints the squaring rate that uploads on this host would
+// calibrate puzzles against.
+func runPuzzleBench(args []string) error {
+	rate := benchmarkSquaring(3 * time.Second)
+	fmt.Printf("[Puzzle] %d squarings/s (%d-bit modulus)\n", rate, puzzleModulusBits)
+	fmt.Printf("         1 hour ≈ %d squarings, 1 year ≈ %d\n", rate*3600, rate*3600*24*365)
+	return nil
+}
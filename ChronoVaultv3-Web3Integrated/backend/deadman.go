@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Dead Man's Switch ---
+//
+// An inheritance vault escrows a copy of its data key alongside a check-in
+// schedule. The owner calls /vault/checkin at least every CheckInDays. The
+// switch fires when GraceDays have passed after a missed deadline. The
+// scheduler then marks the vault released and notifies the beneficiaries. A
+// beneficiary authenticates as usual (authMiddleware) and calls
+// /vault/release to get the key and manifest.
+//
+// Reminders go to the owner from one day before the deadline, then daily
+// until check-in or release. All state lives in the vault record, so a
+// restart loses nothing. The scheduler catches up on its first tick.
+
+const (
+	deadManReminderLead  = 24 * time.Hour
+	deadManReminderEvery = 24 * time.Hour
+	deadManMaxDays       = 3650
+)
+
+// DeadManSwitch is the check-in state of an inheritance vault.
+type DeadManSwitch struct {
+	CheckInDays   int        `json:"checkin_days"`
+	GraceDays     int        `json:"grace_days"`
+	Beneficiaries []string   `json:"beneficiaries"` // user IDs or emails
+	LastCheckIn   time.Time  `json:"last_checkin"`
+	LastReminder  *time.Time `json:"last_reminder,omitempty"`
+	Reminders     int        `json:"reminders"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+}
+
+// Deadline is when the next check-in is due.
+func (d *DeadManSwitch) Deadline() time.Time {
+	return d.LastCheckIn.Add(time.Duration(d.CheckInDays) * 24 * time.Hour)
+}
+
+// ReleaseAt is when the switch fires without a check-in.
+func (d *DeadManSwitch) ReleaseAt() time.Time {
+	return d.Deadline().Add(time.Duration(d.GraceDays) * 24 * time.Hour)
+}
+
+// nextReminder is when the owner should next be nudged.
+func (d *DeadManSwitch) nextReminder() time.Time {
+	first := d.Deadline().Add(-deadManReminderLead)
+	if d.LastReminder == nil || d.LastReminder.Before(first) {
+		return first
+	}
+	return d.LastReminder.Add(deadManReminderEvery)
+}
+
+// isBeneficiary matches the caller's user ID or verified email.
+func (d *DeadManSwitch) isBeneficiary(userID, email string) bool {
+	for _, b := range d.Beneficiaries {
+		if (userID != "" && b == userID) || (email != "" && strings.EqualFold(b, email)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDeadManSwitch reads the upload form. It returns nil when the vault
+// has no switch.
+func parseDeadManSwitch(r *http.Request, now time.Time) (*DeadManSwitch, error) {
+	daysField := r.FormValue("deadman_checkin_days")
+	if daysField == "" {
+		return nil, nil
+	}
+	days, err := strconv.Atoi(daysField)
+	if err != nil || days < 1 || days > deadManMaxDays {
+		return nil, fmt.Errorf("deadman_checkin_days must be between 1 and %d", deadManMaxDays)
+	}
+	grace := 7
+	if v := r.FormValue("deadman_grace_days"); v != "" {
+		if grace, err = strconv.Atoi(v); err != nil || grace < 0 || grace > deadManMaxDays {
+			return nil, fmt.Errorf("deadman_grace_days must be between 0 and %d", deadManMaxDays)
+		}
+	}
+	var beneficiaries []string
+	for _, b := range strings.Split(r.FormValue("beneficiaries"), ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			beneficiaries = append(beneficiaries, b)
+		}
+	}
+	if len(beneficiaries) == 0 {
+		return nil, fmt.Errorf("a dead man's switch needs at least one beneficiary")
+	}
+	return &DeadManSwitch{
+		CheckInDays:   days,
+		GraceDays:     grace,
+		Beneficiaries: beneficiaries,
+		LastCheckIn:   now,
+	}, nil
+}
+
+// --- Scheduler ---
+
+// runDeadManScheduler evaluates every switch each deadman_interval
+// (default 1m).
+func runDeadManScheduler() {
+	interval := cfg.DeadmanInterval
+	fmt.Printf("⏳ Dead man's switch scheduler every %v\n", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deadManTick()
+		<-ticker.C
+	}
+}
+
+// deadManTick sends due reminders and fires expired switches.
+func deadManTick() {
+	now, err := timeSource.Now()
+	if err != nil {
+		fmt.Printf("[DeadMan] Skipping tick, time source unavailable: %v\n", err)
+		return
+	}
+	for _, rec := range vaults.List() {
+		d := rec.DeadMan
+		if d == nil || d.ReleasedAt != nil || rec.Deletion != nil {
+			continue
+		}
+		switch {
+		case !now.Before(d.ReleaseAt()):
+			if released, err := releaseDeadMan(rec.ID, now); err != nil {
+				fmt.Printf("[DeadMan] Release of %s failed: %v\n", rec.ID, err)
+			} else if released {
+				fmt.Printf("[DeadMan] Vault %s released to %d beneficiaries\n", rec.ID, len(d.Beneficiaries))
+			}
+		case !now.Before(d.nextReminder()):
+			remindDeadMan(rec, now)
+		}
+	}
+}
+
+// releaseDeadMan marks the switch fired, if it still should be; a check-in
+// racing the scheduler wins because the condition is re-checked under the
+// store lock. It reports whether this call did the release.
+func releaseDeadMan(vaultID string, now time.Time) (bool, error) {
+	var rec VaultRecord
+	released := false
+	err := vaults.Update(vaultID, func(r *VaultRecord) error {
+		if r.DeadMan == nil || r.DeadMan.ReleasedAt != nil || now.Before(r.DeadMan.ReleaseAt()) {
+			return nil
+		}
+		d := *r.DeadMan
+		d.ReleasedAt = &now
+		r.DeadMan = &d
+		rec, released = *r, true
+		return nil
+	})
+	if err != nil || !released {
+		return false, err
+	}
+
+	notifyAsync(Notification{
+		Kind:    "deadman.released",
+		VaultID: rec.ID,
+		To:      rec.DeadMan.Beneficiaries,
+		Subject: fmt.Sprintf("A ChronoVault vault (%s) has been released to you", rec.FileName),
+		Body: fmt.Sprintf("The owner of vault %s has not checked in since %s. "+
+			"Sign in and call /vault/release with vault_id=%s to retrieve it.",
+			rec.ID, rec.DeadMan.LastCheckIn.Format(time.RFC3339), rec.ID),
+	})
+	notifyAsync(Notification{
+		Kind:    "deadman.released",
+		VaultID: rec.ID,
+		To:      ownerRecipients(&rec),
+		Subject: fmt.Sprintf("Your vault %s was released to its beneficiaries", rec.FileName),
+		Body:    fmt.Sprintf("No check-in was received before %s.", rec.DeadMan.ReleaseAt().Format(time.RFC3339)),
+	})
+	return true, nil
+}
+
+func remindDeadMan(rec *VaultRecord, now time.Time) {
+	err := vaults.Update(rec.ID, func(r *VaultRecord) error {
+		if r.DeadMan == nil || now.Before(r.DeadMan.nextReminder()) {
+			return fmt.Errorf("reminder no longer due")
+		}
+		d := *r.DeadMan
+		d.LastReminder = &now
+		d.Reminders++
+		r.DeadMan = &d
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	d := rec.DeadMan
+	notifyAsync(Notification{
+		Kind:    "deadman.reminder",
+		VaultID: rec.ID,
+		To:      ownerRecipients(rec),
+		Subject: fmt.Sprintf("Check in to keep vault %s sealed", rec.FileName),
+		Body: fmt.Sprintf("Check-in was due %s. Without one, the vault is released to %d beneficiaries at %s.",
+			d.Deadline().Format(time.RFC3339), len(d.Beneficiaries), d.ReleaseAt().Format(time.RFC3339)),
+	})
+}
+
+func ownerRecipients(rec *VaultRecord) []string {
+	to := []string{rec.Owner}
+	if rec.OwnerEmail != "" {
+		to = append(to, rec.OwnerEmail)
+	}
+	return to
+}
+
+// notifyAsync keeps slow webhooks off the scheduler and request paths.
+func notifyAsync(n Notification) {
+	n.SentAt = time.Now().UTC()
+	go func() {
+		if err := notifier.Notify(n); err != nil {
+			fmt.Printf("[Notify] %s for %s failed: %v\n", n.Kind, n.VaultID, err)
+		}
+	}()
+}
+
+// --- Handlers ---
+
+// lookupVaultForm loads the vault named by the vault_id form field, writing
+// the error response itself when it can't.
+func lookupVaultForm(w http.ResponseWriter, r *http.Request) *VaultRecord {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return nil
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	id := r.FormValue("vault_id")
+	if !isValidVaultID(id) {
+		writeError(w, http.StatusBadRequest, "Missing or invalid vault_id")
+		return nil
+	}
+	rec, err := vaults.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Vault not found")
+		return nil
+	}
+	return rec
+}
+
+// checkinHandler records the owner's proof of life.
+func checkinHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	userID := r.Header.Get("X-User-ID")
+	if rec.DeadMan == nil {
+		writeError(w, http.StatusBadRequest, "Vault has no dead man's switch")
+		return
+	}
+	if rec.Owner != userID {
+		writeError(w, http.StatusForbidden, "Only the vault owner can check in")
+		return
+	}
+	now, err := timeSource.Now()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "Trusted time source unavailable")
+		return
+	}
+
+	var d DeadManSwitch
+	err = vaults.Update(rec.ID, func(r *VaultRecord) error {
+		if r.DeadMan.ReleasedAt != nil {
+			return fmt.Errorf("already released")
+		}
+		d = *r.DeadMan
+		d.LastCheckIn, d.LastReminder, d.Reminders = now, nil, 0
+		r.DeadMan = &d
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusConflict, "Vault has already been released to its beneficiaries")
+		return
+	}
+
+	fmt.Printf("[DeadMan] Check-in for %s by %s; next due %s\n", rec.ID, userID, d.Deadline().Format(time.RFC3339))
+	writeJSON(w, http.StatusOK, map[string]string{
+		"vault_id":     rec.ID,
+		"last_checkin": d.LastCheckIn.Format(time.RFC3339),
+		"next_due":     d.Deadline().Format(time.RFC3339),
+		"release_at":   d.ReleaseAt().Format(time.RFC3339),
+	})
+}
+
+// releaseHandler hands a fired vault's key and manifest to a beneficiary.
+func releaseHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	userID, email := r.Header.Get("X-User-ID"), verifiedEmail(r)
+	if rec.DeadMan == nil || !rec.DeadMan.isBeneficiary(userID, email) {
+		auditEvent(r, "release", rec.ID, auditOutcomeDenied, "not a beneficiary")
+		writeError(w, http.StatusForbidden, "Not a beneficiary of this vault")
+		return
+	}
+
+	if rec.DeadMan.ReleasedAt == nil {
+		now, err := timeSource.Now()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "Trusted time source unavailable")
+			return
+		}
+		// Don't make the beneficiary wait for the next scheduler tick.
+		if _, err := releaseDeadMan(rec.ID, now); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update vault")
+			return
+		}
+		if rec, err = vaults.Get(rec.ID); err != nil {
+			writeError(w, http.StatusNotFound, "Vault not found")
+			return
+		}
+		if rec.DeadMan.ReleasedAt == nil {
+			writeJSON(w, http.StatusLocked, map[string]string{
+				"error":      "Vault has not been released",
+				"code":       "NOT_RELEASED",
+				"vault_id":   rec.ID,
+				"release_at": rec.DeadMan.ReleaseAt().Format(time.RFC3339),
+			})
+			return
+		}
+	}
+
+	if rec.ConsumedAt != nil {
+		writeConsumed(w, rec, errVaultConsumed)
+		return
+	}
+	if err := checkRetention(w, rec); err != nil {
+		return
+	}
+
+	// Any other lock on the vault still applies to beneficiaries.
+	if err := checkUnlockPolicy(w, r, rec); err != nil {
+		return
+	}
+
+	if writeEscrowedKey(w, rec) {
+		fmt.Printf("[DeadMan] Key for %s released to beneficiary %s\n", rec.ID, userID)
+		auditEvent(r, "release", rec.ID, auditOutcomeSuccess, "key released to beneficiary")
+	}
+}
+
+// writeEscrowedKey unwraps rec's escrowed key and writes it with the
+// manifest, in the shape /upload returns. It reports whether the key went
+// out.
+func writeEscrowedKey(w http.ResponseWriter, rec *VaultRecord) bool {
+	unwrapped, err := keyProvider.UnwrapKey(rec.EscrowedKey)
+	if err != nil {
+		fmt.Printf("[Escrow] Key unwrap failed for %s: %v\n", rec.ID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to release escrowed key")
+		return false
+	}
+	key, err := NewSecureBufferFrom(unwrapped)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to allocate key buffer")
+		return false
+	}
+	defer key.Destroy()
+	keyHex, err := NewSecureBuffer(hex.EncodedLen(key.Len()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to allocate key buffer")
+		return false
+	}
+	defer keyHex.Destroy()
+	hex.Encode(keyHex.Bytes(), key.Bytes())
+
+	resp := UploadResponse{
+		OriginalHash:    rec.OriginalHash,
+		RootHash:        rec.RootHash,
+		FileName:        rec.FileName,
+		ManifestContent: rec.Manifest,
+		VaultID:         rec.ID,
+	}
+	if err := writeUploadResponse(w, resp, keyHex); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to encode response")
+		return false
+	}
+	return true
+}
@@ -13,8 +13,11 @@ import (
 func DecryptAndRestore(filename string) {
 	fmt.Println("--- PHASE 2: RESTORE & VERIFY ---")
 
-	// 1. Load All Metadata
-	key, _ := os.ReadFile("secret_" + filename + ".key")
+	// 1. Load All Metadata (the key goes straight into locked memory)
+	keyBytes, _ := os.ReadFile("secret_" + filename + ".key")
+	key, err := NewSecureBufferFrom(keyBytes)
+	Check(err)
+	defer key.Destroy()
 	expectedRoot, _ := os.ReadFile("roothash_" + filename + ".txt")
 	expectedOriginalHash, _ := os.ReadFile("hash_" + filename + ".txt")
 	manifestData, _ := os.ReadFile("manifest_" + filename)
@@ -39,7 +42,7 @@ func DecryptAndRestore(filename string) {
 			continue
 		}
 
-		chunkPath := filepath.Join(StoreFolder, hash)
+		chunkPath := filepath.Join(cfg.StoreFolder, hash)
 		chunkData, err := os.ReadFile(chunkPath)
 		if err != nil {
 			panic("Data Loss! Chunk not found: " + hash)
@@ -57,15 +60,17 @@ func DecryptAndRestore(filename string) {
 	fmt.Println("[Dec] VERIFIED: Merkle Root matches.")
 
 	// 4. Decrypt
-	block, _ := aes.NewCipher(key)
+	block, _ := aes.NewCipher(key.Bytes())
 	gcm, _ := cipher.NewGCM(block)
 	nonceSize := gcm.NonceSize()
 	if len(assembledEncryptedData) < nonceSize {
 		panic("Error: Encrypted data too short")
 	}
 	nonce, ciphertext := assembledEncryptedData[:nonceSize], assembledEncryptedData[nonceSize:]
-	decryptedData, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := openSecure(gcm, nonce, ciphertext)
 	Check(err)
+	defer plaintext.Destroy()
+	decryptedData := plaintext.Bytes()
 
 	// 5. Verify Original Hash
 	if HashData(decryptedData) != string(expectedOriginalHash) {
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Scheduled Delivery ---
+//
+// A vault uploaded with deliver_at and deliver_to (comma-separated email
+// addresses) arrives on its own. Once deliver_at passes, the delivery
+// scheduler emails each recipient a retrieval link through the SMTP relay
+// (mail.go).
+//
+// Each link carries a random token bound to the vault and that recipient.
+// The record holds only the token's SHA-256. A link works once, and only
+// until DELIVERY_LINK_TTL (default 168h) after it was sent. Redeeming it at
+// POST /vault/collect returns the key and manifest the way /vault/release
+// does. The recipient needs no account, and every unlock policy on the vault
+// still applies.
+//
+// The jobs live in the vault record, so they survive restarts. A failed send
+// is retried with backoff (1m doubling, capped at 1h). After
+// deliveryMaxAttempts the recipient is marked failed and the owner is
+// notified. Owners see per-recipient status at POST /vault/deliveries.
+
+const (
+	deliveryMaxAttempts = 8
+	deliveryBaseBackoff = time.Minute
+	deliveryMaxBackoff  = time.Hour
+	defaultDeliveryTTL  = 7 * 24 * time.Hour
+	maxDeliveryTargets  = 20
+)
+
+// Delivery is a vault's scheduled delivery.
+type Delivery struct {
+	At         time.Time           `json:"at"`
+	Recipients []DeliveryRecipient `json:"recipients"`
+}
+
+// DeliveryRecipient is one recipient's delivery job.
+type DeliveryRecipient struct {
+	Email       string     `json:"email"`
+	Status      string     `json:"status"` // "pending", "sent" or "failed"
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	TokenHash   string     `json:"token_hash,omitempty"`
+	LinkExpires *time.Time `json:"link_expires,omitempty"`
+	RedeemedAt  *time.Time `json:"redeemed_at,omitempty"`
+}
+
+// parseDelivery reads deliver_at and deliver_to from an upload. It returns
+// nil when no delivery was requested.
+func parseDelivery(r *http.Request) (*Delivery, error) {
+	at, to := r.FormValue("deliver_at"), r.FormValue("deliver_to")
+	if at == "" && to == "" {
+		return nil, nil
+	}
+	if at == "" || to == "" {
+		return nil, fmt.Errorf("deliver_at and deliver_to must be given together")
+	}
+	t, err := parseUnlockAt(at)
+	if err != nil {
+		return nil, fmt.Errorf("deliver_at must be a future time, as RFC 3339 or Unix seconds")
+	}
+	d := &Delivery{At: t}
+	seen := map[string]bool{}
+	for _, addr := range strings.Split(to, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || seen[strings.ToLower(addr)] {
+			continue
+		}
+		if !validEmail(addr) {
+			return nil, fmt.Errorf("deliver_to contains an invalid address %q", addr)
+		}
+		seen[strings.ToLower(addr)] = true
+		d.Recipients = append(d.Recipients, DeliveryRecipient{Email: addr, Status: "pending", NextAttempt: t})
+	}
+	if len(d.Recipients) == 0 || len(d.Recipients) > maxDeliveryTargets {
+		return nil, fmt.Errorf("deliver_to must list between 1 and %d addresses", maxDeliveryTargets)
+	}
+	return d, nil
+}
+
+func deliveryLinkTTL() time.Duration {
+	return cfg.DeliveryLinkTTL
+}
+
+// deliveryLink is the URL mailed to a recipient. It points at the frontend,
+// which POSTs the token to /vault/collect, so a mail scanner that follows
+// the link can't redeem it.
+func deliveryLink(vaultID, token string) string {
+	base := cfg.DeliveryLinkBase
+	if base == "" {
+		base = cfg.AllowedOrigin + "/collect"
+	}
+	return base + "?" + url.Values{"vault_id": {vaultID}, "token": {token}}.Encode()
+}
+
+func hashDeliveryToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// --- Scheduler ---
+
+func runDeliveryScheduler() {
+	interval := cfg.DeliveryInterval
+	fmt.Printf("✉️  Delivery scheduler every %v\n", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deliveryTick()
+		<-ticker.C
+	}
+}
+
+func deliveryTick() {
+	now, err := timeSource.Now()
+	if err != nil {
+		fmt.Printf("[Delivery] Skipping tick, time source unavailable: %v\n", err)
+		return
+	}
+	for _, rec := range vaults.List() {
+		if rec.Delivery == nil || rec.Deletion != nil || now.Before(rec.Delivery.At) {
+			continue
+		}
+		for _, rcpt := range rec.Delivery.Recipients {
+			if rcpt.Status == "pending" && !now.Before(rcpt.NextAttempt) {
+				deliverTo(rec.ID, rcpt.Email, now)
+			}
+		}
+	}
+}
+
+// updateRecipient applies fn to one recipient of id's delivery.
+func updateRecipient(id, email string, fn func(r *VaultRecord, rcpt *DeliveryRecipient) error) error {
+	return vaults.Update(id, func(r *VaultRecord) error {
+		if r.Delivery == nil {
+			return fmt.Errorf("vault has no delivery")
+		}
+		d := *r.Delivery
+		d.Recipients = append([]DeliveryRecipient(nil), d.Recipients...)
+		for i := range d.Recipients {
+			if d.Recipients[i].Email == email {
+				if err := fn(r, &d.Recipients[i]); err != nil {
+					return err
+				}
+				r.Delivery = &d
+				return nil
+			}
+		}
+		return fmt.Errorf("no recipient %s", email)
+	})
+}
+
+// deliverTo issues a fresh link to one recipient and mails it. The token is
+// persisted before the mail goes out, so a link that arrives always works.
+func deliverTo(id, email string, now time.Time) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		fmt.Printf("[Delivery] CSPRNG failure: %v\n", err)
+		return
+	}
+	token := hex.EncodeToString(b)
+	expires := now.Add(deliveryLinkTTL())
+
+	var rec VaultRecord
+	var attempt int
+	err := updateRecipient(id, email, func(r *VaultRecord, rcpt *DeliveryRecipient) error {
+		if rcpt.Status != "pending" {
+			return fmt.Errorf("recipient is %s", rcpt.Status)
+		}
+		rcpt.Attempts++
+		rcpt.TokenHash, rcpt.LinkExpires = hashDeliveryToken(token), &expires
+		rec, attempt = *r, rcpt.Attempts
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	var sendErr error
+	if mailer == nil {
+		sendErr = fmt.Errorf("no SMTP relay configured")
+	} else {
+		sendErr = mailer.Send(email,
+			fmt.Sprintf("A time capsule has arrived: %s", rec.FileName),
+			fmt.Sprintf("%s sent you a ChronoVault time capsule, %q, to be opened on %s.\n\n"+
+				"Open it here:\n%s\n\n"+
+				"The link works once and expires on %s.\n",
+				senderName(&rec), rec.FileName, rec.Delivery.At.Format("2 January 2006"),
+				deliveryLink(id, token), expires.Format(time.RFC1123)))
+	}
+
+	failed := false
+	updateRecipient(id, email, func(r *VaultRecord, rcpt *DeliveryRecipient) error {
+		if sendErr == nil {
+			sent := time.Now().UTC()
+			rcpt.Status, rcpt.SentAt, rcpt.LastError = "sent", &sent, ""
+			return nil
+		}
+		rcpt.LastError = sendErr.Error()
+		if rcpt.Attempts >= deliveryMaxAttempts {
+			rcpt.Status, rcpt.TokenHash, rcpt.LinkExpires = "failed", "", nil
+			failed = true
+			return nil
+		}
+		backoff := deliveryBaseBackoff << uint(rcpt.Attempts-1)
+		if backoff > deliveryMaxBackoff {
+			backoff = deliveryMaxBackoff
+		}
+		rcpt.NextAttempt = time.Now().UTC().Add(backoff)
+		return nil
+	})
+
+	if sendErr == nil {
+		fmt.Printf("[Delivery] Vault %s delivered to %s\n", id, email)
+		metricDeliveries.inc("sent")
+		auditAs("scheduler", "", "deliver", id, auditOutcomeSuccess, "link sent to "+email)
+		return
+	}
+	fmt.Printf("[Delivery] Vault %s to %s attempt %d failed: %v\n", id, email, attempt, sendErr)
+	if !failed {
+		metricDeliveries.inc("retry")
+		return
+	}
+	metricDeliveries.inc("failed")
+	auditAs("scheduler", "", "deliver", id, auditOutcomeFailed, fmt.Sprintf("gave up on %s after %d attempts: %v", email, attempt, sendErr))
+	notifyAsync(Notification{
+		Kind:    "delivery.failed",
+		VaultID: id,
+		To:      ownerRecipients(&rec),
+		Subject: fmt.Sprintf("Delivery of %s to %s failed", rec.FileName, email),
+		Body:    fmt.Sprintf("Gave up after %d attempts. Last error: %v", attempt, sendErr),
+	})
+}
+
+func senderName(rec *VaultRecord) string {
+	if rec.OwnerEmail != "" {
+		return rec.OwnerEmail
+	}
+	return "Someone"
+}
+
+// --- Handlers ---
+
+// collectHandler redeems a delivery link. It is not behind authMiddleware:
+// the token is the credential. Form fields: vault_id, token.
+func collectHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	token := r.FormValue("token")
+	var rcpt *DeliveryRecipient
+	if rec.Delivery != nil && token != "" {
+		want := hashDeliveryToken(token)
+		for i := range rec.Delivery.Recipients {
+			c := &rec.Delivery.Recipients[i]
+			if c.TokenHash != "" && subtle.ConstantTimeCompare([]byte(c.TokenHash), []byte(want)) == 1 {
+				rcpt = c
+			}
+		}
+	}
+	if rcpt == nil {
+		auditEvent(r, "collect", rec.ID, auditOutcomeDenied, "invalid delivery link")
+		writeError(w, http.StatusForbidden, "Invalid delivery link")
+		return
+	}
+	if rcpt.RedeemedAt != nil {
+		auditEvent(r, "collect", rec.ID, auditOutcomeDenied, "link already used by "+rcpt.Email)
+		writeJSON(w, http.StatusGone, map[string]string{
+			"error":       "Delivery link has already been used",
+			"code":        "LINK_USED",
+			"vault_id":    rec.ID,
+			"redeemed_at": rcpt.RedeemedAt.Format(time.RFC3339),
+		})
+		return
+	}
+	now, err := timeSource.Now()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "Trusted time source unavailable")
+		return
+	}
+	if rcpt.LinkExpires == nil || now.After(*rcpt.LinkExpires) {
+		writeJSON(w, http.StatusGone, map[string]string{
+			"error":    "Delivery link has expired",
+			"code":     "LINK_EXPIRED",
+			"vault_id": rec.ID,
+		})
+		return
+	}
+
+	if err := checkRetention(w, rec); err != nil {
+		return
+	}
+	if err := checkUnlockPolicy(w, r, rec); err != nil {
+		return
+	}
+
+	// Claim the link, so that of two concurrent requests with it only one
+	// gets past here, and recheck it now that it is ours. It is redeemed only
+	// once the key has gone out: a failed unwrap leaves it usable.
+	email, tokenHash := rcpt.Email, hashDeliveryToken(token)
+	if _, busy := collecting.LoadOrStore(tokenHash, struct{}{}); busy {
+		writeError(w, http.StatusConflict, "Delivery link is being redeemed")
+		return
+	}
+	defer collecting.Delete(tokenHash)
+	if !linkRedeemable(rec.ID, email, tokenHash) {
+		writeError(w, http.StatusGone, "Delivery link has already been used")
+		return
+	}
+
+	if !writeEscrowedKey(w, rec) {
+		auditEvent(r, "collect", rec.ID, auditOutcomeFailed, "key not released to "+email)
+		return
+	}
+	redeemed := now.UTC()
+	err = updateRecipient(rec.ID, email, func(_ *VaultRecord, c *DeliveryRecipient) error {
+		c.RedeemedAt = &redeemed
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("⚠️  [Delivery] Vault %s collected by %s but not marked redeemed: %v\n", rec.ID, email, err)
+	}
+	fmt.Printf("[Delivery] Vault %s collected by %s\n", rec.ID, email)
+	metricDeliveries.inc("collected")
+	auditEvent(r, "collect", rec.ID, auditOutcomeSuccess, "collected by "+email)
+}
+
+// collecting holds the token hashes of links being redeemed right now.
+var collecting sync.Map
+
+// linkRedeemable reports whether email's link on vault id still has
+// tokenHash and hasn't been redeemed.
+func linkRedeemable(id, email, tokenHash string) bool {
+	rec, err := vaults.Get(id)
+	if err != nil || rec.Delivery == nil {
+		return false
+	}
+	for _, c := range rec.Delivery.Recipients {
+		if c.Email == email {
+			return c.RedeemedAt == nil && c.TokenHash == tokenHash
+		}
+	}
+	return false
+}
+
+type deliveryStatus struct {
+	Email       string `json:"email"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	LastError   string `json:"last_error,omitempty"`
+	NextAttempt string `json:"next_attempt,omitempty"`
+	SentAt      string `json:"sent_at,omitempty"`
+	LinkExpires string `json:"link_expires,omitempty"`
+	RedeemedAt  string `json:"redeemed_at,omitempty"`
+}
+
+// deliveriesHandler shows the owner the state of vault_id's delivery.
+func deliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	if rec.Owner != r.Header.Get("X-User-ID") {
+		writeError(w, http.StatusForbidden, "Only the vault owner can view its deliveries")
+		return
+	}
+	if rec.Delivery == nil {
+		writeError(w, http.StatusBadRequest, "Vault has no scheduled delivery")
+		return
+	}
+	format := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	var out []deliveryStatus
+	for _, c := range rec.Delivery.Recipients {
+		s := deliveryStatus{
+			Email: c.Email, Status: c.Status, Attempts: c.Attempts, LastError: c.LastError,
+			SentAt: format(c.SentAt), LinkExpires: format(c.LinkExpires), RedeemedAt: format(c.RedeemedAt),
+		}
+		if c.Status == "pending" {
+			s.NextAttempt = c.NextAttempt.Format(time.RFC3339)
+		}
+		out = append(out, s)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"vault_id":   rec.ID,
+		"deliver_at": rec.Delivery.At.Format(time.RFC3339),
+		"recipients": out,
+	})
+}
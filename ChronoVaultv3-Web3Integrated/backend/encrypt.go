@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
@@ -8,60 +9,90 @@ import (
 	"io"
 )
 
+// pipelineHooks lets a caller follow EncryptAndStore, e.g. to report the
+// progress of an upload job. Any hook may be nil.
+type pipelineHooks struct {
+	Encrypted func(size, chunks int)
+	Pinned    func(index, chunks int, cid string) // index counts from 1
+}
+
 // EncryptAndStore handles the encryption and shredding logic.
 // Returns (originalHash, rootHash, manifestContent, key, error).
-// On partial failure, uploaded chunks are rolled back (unpinned).
-func EncryptAndStore(originalData []byte, filename string) (string, string, string, []byte, error) {
+// The key lives in locked memory; the caller must Destroy it.
+// On partial failure, or when ctx is cancelled between or during chunk
+// uploads, uploaded chunks are rolled back (unpinned).
+func EncryptAndStore(ctx context.Context, originalData []byte, filename string, hooks *pipelineHooks) (string, string, string, *SecureBuffer, error) {
+	if hooks == nil {
+		hooks = &pipelineHooks{}
+	}
+
 	fmt.Println("--- PHASE 1: ENCRYPT & SHRED ---")
 
 	// 1. Hash Original Data (Identity)
 	originalHash := HashData(originalData)
 	fmt.Printf("[Enc] Original Hash: %s\n", originalHash[:10])
 
-	// 2. Generate Encryption Key (AES-256)
-	key := make([]byte, 32)
-	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+	// 2. Generate Encryption Key (AES-256) directly into locked memory
+	key, err := NewSecureBuffer(32)
+	if err != nil {
+		return "", "", "", nil, fmt.Errorf("failed to allocate key buffer: %w", err)
+	}
+	if _, err := io.ReadFull(rand.Reader, key.Bytes()); err != nil {
+		key.Destroy()
 		return "", "", "", nil, fmt.Errorf("CSPRNG failure generating key: %w", err)
 	}
 
 	// 3. Encrypt Data with AES-256-GCM
-	block, err := aes.NewCipher(key)
+	block, err := aes.NewCipher(key.Bytes())
 	if err != nil {
+		key.Destroy()
 		return "", "", "", nil, fmt.Errorf("failed to create cipher: %w", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
+		key.Destroy()
 		return "", "", "", nil, fmt.Errorf("failed to create GCM: %w", err)
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		key.Destroy()
 		return "", "", "", nil, fmt.Errorf("CSPRNG failure generating nonce: %w", err)
 	}
 
 	encryptedData := gcm.Seal(nonce, nonce, originalData, nil)
+	chunkSize := int(cfg.ChunkSize)
+	chunks := (len(encryptedData) + chunkSize - 1) / chunkSize
+	if hooks.Encrypted != nil {
+		hooks.Encrypted(len(encryptedData), chunks)
+	}
 
 	// 4. Shred and Upload Chunks to IPFS (with rollback on failure)
 	var chunkCIDs []string
 
-	for i := 0; i < len(encryptedData); i += ChunkSize {
-		end := i + ChunkSize
+	for i := 0; i < len(encryptedData); i += chunkSize {
+		end := i + chunkSize
 		if end > len(encryptedData) {
 			end = len(encryptedData)
 		}
 		chunk := encryptedData[i:end]
 
-		cid, err := UploadChunkToIPFS(chunk, filename)
+		cid, err := "", ctx.Err()
+		if err == nil {
+			cid, err = UploadChunkToIPFS(ctx, chunk, filename)
+		}
 		if err != nil {
 			// ROLLBACK: Unpin any chunks that were already uploaded
-			fmt.Printf("[Enc] ROLLBACK: Chunk upload failed at index %d, unpinning %d chunks\n", i/ChunkSize, len(chunkCIDs))
-			for _, pinnedCID := range chunkCIDs {
-				_ = UnpinFromIPFS(pinnedCID) // Best-effort cleanup
-			}
-			return "", "", "", nil, fmt.Errorf("IPFS upload failed for chunk %d: %w", i/ChunkSize, err)
+			fmt.Printf("[Enc] ROLLBACK: Chunk upload failed at index %d, unpinning %d chunks\n", i/chunkSize, len(chunkCIDs))
+			rollbackChunks(chunkCIDs)
+			key.Destroy()
+			return "", "", "", nil, fmt.Errorf("IPFS upload failed for chunk %d: %w", i/chunkSize, err)
 		}
 		chunkCIDs = append(chunkCIDs, cid)
+		if hooks.Pinned != nil {
+			hooks.Pinned(len(chunkCIDs), chunks, cid)
+		}
 	}
 	fmt.Printf("[Enc] Shredded file into %d chunks\n", len(chunkCIDs))
 
@@ -77,3 +108,18 @@ func EncryptAndStore(originalData []byte, filename string) (string, string, stri
 
 	return originalHash, rootNode.Hash, manifestContent, key, nil
 }
+
+// rollbackChunks unpins chunks of a failed upload. The server hands them to
+// the persistent unpin queue, so the rollback survives a shutdown; without
+// one (the CLI) it unpins inline, best-effort.
+func rollbackChunks(cids []string) {
+	if len(cids) == 0 {
+		return
+	}
+	if err := unpins.Enqueue("", cids); err == nil {
+		return
+	}
+	for _, cid := range cids {
+		_ = UnpinFromIPFS(cid) // Best-effort cleanup
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// --- Geo-Lock Vaults ---
+//
+// A vault may carry a geofence (a circle, or a GeoJSON Polygon with optional
+// holes). Like time-locked vaults its key is escrowed, so the fence can only
+// be satisfied by asking the server. /retrieve evaluates the fence against
+// one of two kinds of location evidence:
+//
+//  1. A signed device attestation. The client posts the attestation JSON as
+//     location_attestation and a raw P-256 r||s signature over those exact
+//     bytes as location_signature. Device public keys are loaded from the
+//     JSON file in GEO_DEVICE_KEYS. An attestation must name the vault and be
+//     less than geoAttestationMaxAge old by the trusted time source.
+//  2. An IP lookup in a local MaxMind-format database (GEOIP_DB), used when
+//     no attestation is posted and the fence does not require one.
+//
+// Access is granted only when the reported point lies inside the fence and
+// its uncertainty is at most GEO_MAX_UNCERTAINTY_M (default 50 km). Every
+// decision is written to the audit log (audit.go) with the evidence source,
+// its accuracy and the distance to the fence boundary. The distance is never
+// returned to the client, because a series of probes could otherwise locate
+// the fence.
+
+const (
+	earthRadiusM          = 6371008.8
+	geoAttestationMaxAge  = 5 * time.Minute
+	defaultGeoUncertainty = 50000.0
+)
+
+// GeoFence is a vault's location policy. Coordinates follow GeoJSON order.
+type GeoFence struct {
+	Type               string         `json:"type"` // "circle" or "polygon"
+	Center             [2]float64     `json:"center,omitempty"`
+	RadiusM            float64        `json:"radius_m,omitempty"`
+	Rings              [][][2]float64 `json:"rings,omitempty"` // outer ring first, then holes
+	RequireAttestation bool           `json:"require_attestation,omitempty"`
+}
+
+// geoFix is one piece of location evidence.
+type geoFix struct {
+	Source    string // "attestation:<device>" or "ip:<addr>"
+	Lon, Lat  float64
+	AccuracyM float64
+}
+
+// deviceLocationAttestation is the signed payload from a trusted device.
+type deviceLocationAttestation struct {
+	DeviceID  string  `json:"device_id"`
+	VaultID   string  `json:"vault_id"`
+	Lat       float64 `json:"lat"`
+	Lon       float64 `json:"lon"`
+	AccuracyM float64 `json:"accuracy_m"`
+	Timestamp int64   `json:"timestamp"` // Unix seconds
+}
+
+type geoDevice struct {
+	PublicKey string `json:"public_key"` // base64 uncompressed P-256 point
+	UserID    string `json:"user_id,omitempty"`
+	key       *ecdsa.PublicKey
+}
+
+var (
+	geoMu         sync.RWMutex
+	geoIPDB       *maxminddb.Reader
+	geoDevices    map[string]*geoDevice
+	geoMaxUncertM = defaultGeoUncertainty
+)
+
+// initGeoLock opens the GeoIP database and device key file, if configured.
+func initGeoLock() {
+	geoMu.Lock()
+	defer geoMu.Unlock()
+
+	geoMaxUncertM = cfg.GeoMaxUncertaintyM
+
+	if path := cfg.GeoIPDB; path != "" {
+		db, err := maxminddb.Open(path)
+		if err != nil {
+			fmt.Printf("⚠️  GeoIP database %s unavailable: %v — IP-based geo-lock disabled.\n", path, err)
+		} else {
+			geoIPDB = db
+			fmt.Printf("🌍 GeoIP database: %s (%s, built %s)\n", path, db.Metadata.DatabaseType,
+				time.Unix(int64(db.Metadata.BuildEpoch), 0).UTC().Format("2006-01-02"))
+		}
+	}
+
+	if path := cfg.GeoDeviceKeys; path != "" {
+		devices, err := loadGeoDevices(path)
+		if err != nil {
+			fmt.Printf("⚠️  Device key file %s unusable: %v — location attestations disabled.\n", path, err)
+		} else {
+			geoDevices = devices
+			fmt.Printf("📍 Location attestation: %d trusted device(s)\n", len(devices))
+		}
+	}
+}
+
+func loadGeoDevices(path string) (map[string]*geoDevice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var devices map[string]*geoDevice
+	if err := json.Unmarshal(data, &devices); err != nil {
+		return nil, err
+	}
+	for id, d := range devices {
+		if d.key, err = parseP256PublicKey(d.PublicKey); err != nil {
+			return nil, fmt.Errorf("device %s: %v", id, err)
+		}
+	}
+	return devices, nil
+}
+
+// parseGeoFence accepts either a circle
+//
+//	{"type":"circle","lat":..,"lon":..,"radius_m":..}
+//
+// or a GeoJSON Polygon geometry or Feature. "require_attestation" may be set
+// at the top level or, for a Feature, in its properties.
+func parseGeoFence(raw string) (*GeoFence, error) {
+	var in struct {
+		Type               string          `json:"type"`
+		Lat                *float64        `json:"lat"`
+		Lon                *float64        `json:"lon"`
+		RadiusM            float64         `json:"radius_m"`
+		Coordinates        [][][2]float64  `json:"coordinates"`
+		Geometry           json.RawMessage `json:"geometry"`
+		RequireAttestation bool            `json:"require_attestation"`
+		Properties         struct {
+			RequireAttestation bool `json:"require_attestation"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(raw), &in); err != nil {
+		return nil, fmt.Errorf("geofence is not valid JSON: %w", err)
+	}
+
+	switch in.Type {
+	case "circle":
+		if in.Lat == nil || in.Lon == nil || !validLatLon(*in.Lat, *in.Lon) {
+			return nil, fmt.Errorf("circle geofence needs a valid lat and lon")
+		}
+		if in.RadiusM <= 0 || in.RadiusM > math.Pi*earthRadiusM {
+			return nil, fmt.Errorf("circle geofence radius_m is out of range")
+		}
+		return &GeoFence{Type: "circle", Center: [2]float64{*in.Lon, *in.Lat}, RadiusM: in.RadiusM,
+			RequireAttestation: in.RequireAttestation}, nil
+
+	case "Feature":
+		if len(in.Geometry) == 0 {
+			return nil, fmt.Errorf("geofence Feature has no geometry")
+		}
+		fence, err := parseGeoFence(string(in.Geometry))
+		if err != nil {
+			return nil, err
+		}
+		fence.RequireAttestation = fence.RequireAttestation || in.RequireAttestation || in.Properties.RequireAttestation
+		return fence, nil
+
+	case "Polygon":
+		if len(in.Coordinates) == 0 {
+			return nil, fmt.Errorf("polygon geofence has no rings")
+		}
+		for i, ring := range in.Coordinates {
+			if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+				ring = append(ring, ring[0]) // GeoJSON rings are closed; be lenient
+				in.Coordinates[i] = ring
+			}
+			if len(ring) < 4 {
+				return nil, fmt.Errorf("polygon ring %d needs at least 3 distinct points", i)
+			}
+			for _, pt := range ring {
+				if !validLatLon(pt[1], pt[0]) {
+					return nil, fmt.Errorf("polygon ring %d has an invalid coordinate", i)
+				}
+			}
+		}
+		return &GeoFence{Type: "polygon", Rings: in.Coordinates, RequireAttestation: in.RequireAttestation}, nil
+	}
+	return nil, fmt.Errorf("unsupported geofence type %q (want circle, Polygon or Feature)", in.Type)
+}
+
+func validLatLon(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+// DistanceM returns the signed distance in metres from (lon, lat) to the
+// fence boundary: negative inside, positive outside.
+func (f *GeoFence) DistanceM(lon, lat float64) float64 {
+	if f.Type == "circle" {
+		return haversineM(f.Center[0], f.Center[1], lon, lat) - f.RadiusM
+	}
+
+	minD := math.Inf(1)
+	for _, ring := range f.Rings {
+		for i := 0; i+1 < len(ring); i++ {
+			if d := segmentDistanceM(lon, lat, ring[i], ring[i+1]); d < minD {
+				minD = d
+			}
+		}
+	}
+	inside := pointInRing(lon, lat, f.Rings[0])
+	for _, hole := range f.Rings[1:] {
+		if pointInRing(lon, lat, hole) {
+			inside = false
+		}
+	}
+	if inside {
+		return -minD
+	}
+	return minD
+}
+
+func haversineM(lon1, lat1, lon2, lat2 float64) float64 {
+	φ1, φ2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dφ, dλ := φ2-φ1, (lon2-lon1)*math.Pi/180
+	a := math.Sin(dφ/2)*math.Sin(dφ/2) + math.Cos(φ1)*math.Cos(φ2)*math.Sin(dλ/2)*math.Sin(dλ/2)
+	return 2 * earthRadiusM * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// segmentDistanceM projects the segment into a local equirectangular plane
+// centred on the point. Accurate to well under 1% for fences up to a few
+// hundred kilometres, which is what geo-locks are used for.
+func segmentDistanceM(lon, lat float64, a, b [2]float64) float64 {
+	k := math.Cos(lat * math.Pi / 180)
+	toXY := func(p [2]float64) (float64, float64) {
+		return (p[0] - lon) * k * math.Pi / 180 * earthRadiusM, (p[1] - lat) * math.Pi / 180 * earthRadiusM
+	}
+	ax, ay := toXY(a)
+	bx, by := toXY(b)
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/l2))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// pointInRing is the even-odd ray-casting test in lon/lat space.
+func pointInRing(lon, lat float64, ring [][2]float64) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi, xj, yj := ring[i][0], ring[i][1], ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lon < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// --- Evidence ---
+
+// locationFromAttestation verifies a device-signed fix for vaultID.
+func locationFromAttestation(r *http.Request, vaultID, userID string) (*geoFix, error) {
+	raw := r.FormValue("location_attestation")
+	sig, err := base64.StdEncoding.DecodeString(r.FormValue("location_signature"))
+	if err != nil || len(sig) != 64 {
+		return nil, fmt.Errorf("location_signature must be a base64 64-byte P-256 r||s signature")
+	}
+
+	var att deviceLocationAttestation
+	if err := json.Unmarshal([]byte(raw), &att); err != nil {
+		return nil, fmt.Errorf("location_attestation is not valid JSON")
+	}
+
+	geoMu.RLock()
+	dev := geoDevices[att.DeviceID]
+	geoMu.RUnlock()
+	if dev == nil {
+		return nil, fmt.Errorf("device %q is not trusted", att.DeviceID)
+	}
+	digest := sha256.Sum256([]byte(raw))
+	if !ecdsa.Verify(dev.key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, fmt.Errorf("attestation signature does not verify for device %q", att.DeviceID)
+	}
+	if dev.UserID != "" && dev.UserID != userID {
+		return nil, fmt.Errorf("device %q is not registered to this user", att.DeviceID)
+	}
+	if att.VaultID != vaultID {
+		return nil, fmt.Errorf("attestation is for a different vault")
+	}
+	now, err := timeSource.Now()
+	if err != nil {
+		return nil, fmt.Errorf("trusted time source unavailable: %w", err)
+	}
+	if age := now.Sub(time.Unix(att.Timestamp, 0)); age > geoAttestationMaxAge || age < -time.Minute {
+		return nil, fmt.Errorf("attestation timestamp is outside the %v window", geoAttestationMaxAge)
+	}
+	if !validLatLon(att.Lat, att.Lon) || att.AccuracyM < 0 {
+		return nil, fmt.Errorf("attestation coordinates are invalid")
+	}
+	return &geoFix{Source: "attestation:" + att.DeviceID, Lon: att.Lon, Lat: att.Lat, AccuracyM: att.AccuracyM}, nil
+}
+
+// locationFromIP looks the client address up in the GeoIP database.
+func locationFromIP(r *http.Request) (*geoFix, error) {
+	geoMu.RLock()
+	db := geoIPDB
+	geoMu.RUnlock()
+	if db == nil {
+		return nil, fmt.Errorf("no GeoIP database configured")
+	}
+
+	addr := extractIP(r)
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("cannot parse client address %q", addr)
+	}
+	var rec struct {
+		Location struct {
+			Latitude       *float64 `maxminddb:"latitude"`
+			Longitude      *float64 `maxminddb:"longitude"`
+			AccuracyRadius uint16   `maxminddb:"accuracy_radius"` // kilometres
+		} `maxminddb:"location"`
+	}
+	if err := db.Lookup(ip, &rec); err != nil {
+		return nil, fmt.Errorf("GeoIP lookup failed: %w", err)
+	}
+	if rec.Location.Latitude == nil || rec.Location.Longitude == nil {
+		return nil, fmt.Errorf("no location for %s", addr)
+	}
+	return &geoFix{
+		Source:    "ip:" + addr,
+		Lon:       *rec.Location.Longitude,
+		Lat:       *rec.Location.Latitude,
+		AccuracyM: float64(rec.Location.AccuracyRadius) * 1000,
+	}, nil
+}
+
+// --- Enforcement ---
+
+// evalGeoFence decides a geofence leaf (see policy.go) for this request.
+func (e *policyEnv) evalGeoFence(res *PolicyResult, fence *GeoFence) {
+	r, rec, userID := e.r, e.rec, e.userID
+
+	var fix *geoFix
+	var err error
+	switch {
+	case r.FormValue("location_attestation") != "":
+		fix, err = locationFromAttestation(r, rec.ID, userID)
+	case fence.RequireAttestation:
+		err = fmt.Errorf("vault requires a signed device location attestation")
+	default:
+		fix, err = locationFromIP(r)
+	}
+	if err != nil {
+		auditEvent(r, "geofence", rec.ID, auditOutcomeDenied, "location unverified: "+err.Error())
+		res.Result, res.Code, res.status = policyUnknown, "GEO_UNVERIFIED", http.StatusForbidden
+		res.Detail = "location could not be established"
+		res.message = "Location could not be established: " + err.Error()
+		return
+	}
+
+	dist := fence.DistanceM(fix.Lon, fix.Lat)
+	decision, reason := "allow", "inside fence"
+	switch {
+	case dist > 0:
+		decision, reason = "deny", "outside fence"
+	case fix.AccuracyM > geoMaxUncertM:
+		decision, reason = "deny", fmt.Sprintf("uncertainty %.0fm exceeds %.0fm", fix.AccuracyM, geoMaxUncertM)
+	}
+	outcome := auditOutcomeSuccess
+	if decision == "deny" {
+		outcome = auditOutcomeDenied
+	}
+	auditEvent(r, "geofence", rec.ID, outcome, fmt.Sprintf("%s: source %s, accuracy %.0fm, %s fence, distance to fence %.1fm",
+		reason, fix.Source, fix.AccuracyM, fence.Type, dist))
+
+	// The distance stays in the audit log; the detail only names the reason.
+	source := strings.SplitN(fix.Source, ":", 2)[0]
+	res.Detail = reason + " (" + source + ")"
+	if decision == "deny" {
+		res.Result, res.Code, res.status = policyFail, "GEO_LOCKED", http.StatusForbidden
+		res.message = "Vault is geo-locked to a location this request is not in"
+		res.fields = map[string]interface{}{"source": source}
+		return
+	}
+	res.Result = policyPass
+}
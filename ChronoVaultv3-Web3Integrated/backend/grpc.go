@@ -0,0 +1,682 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"chronovault/vaultpb"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// --- gRPC API ---
+//
+// Internal services use a typed, streaming interface instead of multipart
+// forms: chronovault.v1.VaultService in vaultpb/vault.proto. Upload streams
+// the file in and returns the root hash and manifest; Retrieve streams the
+// plaintext out; Delete, GetVault and ListVaults mirror /v1/vaults. The
+// service listens on GRPC_ADDR (default :9090, "off" to disable), with TLS
+// when GRPC_TLS_CERT and GRPC_TLS_KEY are set.
+//
+// The interceptors do what protect does for HTTP: rate limiting per client
+// IP, then the Supabase JWT from the "authorization" metadata, verified by
+// verifySupabaseJWT and audited when rejected.
+//
+// No vault logic is duplicated here. Upload validates its header with
+// parseUploadOptions and runs the upload pipeline, reading the file into
+// locked memory as it streams in. The other calls build the request the
+// HTTP handler expects and run that handler against a grpcResponse, which
+// streams a successful body back and turns an error response into a gRPC
+// status with the same message and code.
+//
+// After editing vaultpb/vault.proto, regenerate the Go code with protoc,
+// protoc-gen-go and protoc-gen-go-grpc on the PATH:
+//
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative vaultpb/vault.proto
+
+const (
+	defaultGRPCAddr = ":9090"
+	grpcChunkSize   = 64 * 1024 // data per Retrieve message
+)
+
+// startGRPC serves the gRPC API in the background. It returns nil when the
+// API is disabled or can't start.
+func startGRPC() *grpc.Server {
+	addr := cfg.GRPCAddr
+	if addr == "off" {
+		fmt.Println("🛰️  gRPC API disabled")
+		return nil
+	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcUnaryAuth),
+		grpc.ChainStreamInterceptor(grpcStreamAuth),
+	}
+	transport := "plaintext"
+	if cert, key := cfg.GRPCTLSCert, cfg.GRPCTLSKey; cert != "" {
+		creds, err := credentials.NewServerTLSFromFile(cert, key)
+		if err != nil {
+			fmt.Printf("⚠️  gRPC API disabled: %v\n", err)
+			return nil
+		}
+		opts = append(opts, grpc.Creds(creds))
+		transport = "TLS"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("⚠️  gRPC API disabled: %v\n", err)
+		return nil
+	}
+	srv := grpc.NewServer(opts...)
+	vaultpb.RegisterVaultServiceServer(srv, &grpcVaultServer{})
+	fmt.Printf("🛰️  gRPC API on %s (%s)\n", addr, transport)
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			fmt.Printf("Error starting gRPC server: %v\n", err)
+		}
+	}()
+	return srv
+}
+
+// stopGRPC lets the calls in progress finish, and cuts them off when ctx
+// ends.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// --- Authentication ---
+
+// grpcCaller is the verified caller of a gRPC call.
+type grpcCaller struct {
+	userID, email, role string
+	emailVerified       bool
+	remoteAddr          string
+	forwardedFor        string
+	ip                  string
+}
+
+type grpcCallerKey struct{}
+
+func callerFrom(ctx context.Context) *grpcCaller {
+	c, _ := ctx.Value(grpcCallerKey{}).(*grpcCaller)
+	return c
+}
+
+// grpcAuthenticate is authMiddleware and rateLimit for a gRPC call.
+func grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	c := &grpcCaller{}
+	if p, ok := peer.FromContext(ctx); ok {
+		c.remoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("x-forwarded-for"); len(v) > 0 {
+		c.forwardedFor = v[0]
+	}
+	c.ip = extractIP(c.request(ctx, "", "", nil))
+	if !limiter.allow(c.ip) {
+		return nil, status.Error(codes.ResourceExhausted, "Rate limit exceeded. Try again later.")
+	}
+
+	auth := md.Get("authorization")
+	if len(auth) == 0 {
+		metricJWTFailures.inc("missing")
+		return nil, status.Error(codes.Unauthenticated, "Missing authorization header")
+	}
+	if !strings.HasPrefix(auth[0], "Bearer ") {
+		metricJWTFailures.inc("bad_format")
+		return nil, status.Error(codes.Unauthenticated, "Invalid authorization format")
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(auth[0], "Bearer "))
+	if token == "" {
+		metricJWTFailures.inc("empty")
+		return nil, status.Error(codes.Unauthenticated, "Empty token")
+	}
+	claims, err := verifySupabaseJWT(token)
+	if err != nil {
+		fmt.Printf("[Auth] gRPC token rejected: %v\n", err)
+		countJWTFailure(err)
+		auditAuthFailure(c.ip, err.Error())
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	fmt.Printf("[Auth] Verified gRPC user: %s (%s)\n", claims.Sub, claims.Email)
+	c.userID, c.email, c.role = claims.Sub, claims.Email, claims.AppMetadata.Role
+	c.emailVerified = claims.EmailVerified
+	return context.WithValue(ctx, grpcCallerKey{}, c), nil
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authedStream carries the caller in its context.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context { return s.ctx }
+
+// --- Handler Bridge ---
+
+// request builds the request an HTTP handler would see for this caller
+// after authMiddleware.
+func (c *grpcCaller) request(ctx context.Context, method, path string, body io.Reader) *http.Request {
+	if body == nil {
+		body = http.NoBody
+	}
+	r := &http.Request{
+		Method:     method,
+		URL:        &url.URL{Path: path},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(body),
+		RemoteAddr: c.remoteAddr,
+	}
+	if c.forwardedFor != "" {
+		r.Header.Set("X-Forwarded-For", c.forwardedFor)
+	}
+	if c.userID != "" {
+		r.Header.Set("X-User-ID", c.userID)
+		r.Header.Set("X-User-Email", c.email)
+		r.Header.Set("X-User-Email-Verified", strconv.FormatBool(c.emailVerified))
+		r.Header.Set("X-User-Role", c.role)
+	}
+	return r.WithContext(ctx)
+}
+
+// grpcResponse is the http.ResponseWriter a handler runs against for a gRPC
+// call. A successful body goes to stream, or is kept for decoding when
+// stream is nil. An error body is kept and becomes the call's status.
+type grpcResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	stream func(header http.Header, p []byte) error
+	err    error // from stream
+}
+
+func (g *grpcResponse) Header() http.Header {
+	if g.header == nil {
+		g.header = http.Header{}
+	}
+	return g.header
+}
+
+func (g *grpcResponse) WriteHeader(code int) {
+	if g.status == 0 {
+		g.status = code
+	}
+}
+
+func (g *grpcResponse) Write(p []byte) (int, error) {
+	g.WriteHeader(http.StatusOK)
+	if !g.ok() || g.stream == nil {
+		return g.body.Write(p)
+	}
+	if g.err == nil {
+		g.err = g.stream(g.Header(), p)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	return len(p), nil
+}
+
+func (g *grpcResponse) ok() bool {
+	return g.status >= 200 && g.status < 300
+}
+
+// result is the call's error: the stream's, or the handler's error response
+// as a status. The JSON "code" and other string fields go into an ErrorInfo.
+func (g *grpcResponse) result() error {
+	if g.err != nil {
+		return g.err
+	}
+	if g.status == 0 || g.ok() {
+		return nil
+	}
+	var body map[string]interface{}
+	json.Unmarshal(g.body.Bytes(), &body)
+	msg, _ := body["error"].(string)
+	if msg == "" {
+		msg = http.StatusText(g.status)
+	}
+	info := &errdetails.ErrorInfo{Domain: "chronovault", Metadata: map[string]string{}}
+	if info.Reason, _ = body["code"].(string); info.Reason == "" {
+		info.Reason = strings.ToUpper(strings.ReplaceAll(http.StatusText(g.status), " ", "_"))
+	}
+	for k, v := range body {
+		if s, ok := v.(string); ok && k != "error" && k != "code" {
+			info.Metadata[k] = s
+		}
+	}
+	if v := g.header.Get("Retry-After"); v != "" {
+		info.Metadata["retry_after"] = v
+	}
+	st := status.New(grpcCode(g.status), msg)
+	if withInfo, err := st.WithDetails(info); err == nil {
+		st = withInfo
+	}
+	return st.Err()
+}
+
+// grpcCode maps the statuses the handlers use.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusGone, http.StatusPreconditionFailed, http.StatusLocked:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
+
+// callJSON runs h and decodes its JSON response into out.
+func callJSON(h http.HandlerFunc, r *http.Request, out interface{}) error {
+	resp := &grpcResponse{}
+	h(resp, r)
+	if err := resp.result(); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(resp.body.Bytes(), out); err != nil {
+		return status.Error(codes.Internal, "Failed to decode response")
+	}
+	return nil
+}
+
+// --- Service ---
+
+type grpcVaultServer struct {
+	vaultpb.UnimplementedVaultServiceServer
+}
+
+// grpcUploadInitialBuffer is the locked memory an Upload starts with.
+const grpcUploadInitialBuffer = 64 << 10
+
+func (s *grpcVaultServer) Upload(stream vaultpb.VaultService_UploadServer) error {
+	ctx := stream.Context()
+	c := callerFrom(ctx)
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	h := first.GetHeader()
+	if h == nil {
+		return status.Error(codes.InvalidArgument, "The first message must be the header")
+	}
+	if h.Size <= 0 {
+		return status.Error(codes.InvalidArgument, "size is required")
+	}
+	if h.Size > int64(cfg.MaxUploadSize) {
+		return status.Errorf(codes.ResourceExhausted, "File exceeds %v limit", cfg.MaxUploadSize)
+	}
+	fmt.Printf("\n[gRPC Upload] User: %s | Processing: %s\n", c.userID, h.FileName)
+
+	r := c.request(ctx, http.MethodPost, "/upload", nil)
+	r.Form = uploadForm(h)
+	resp := &grpcResponse{}
+	u := parseUploadOptions(resp, r, h.FileName)
+	if u == nil {
+		return resp.result()
+	}
+
+	// The file goes straight into locked memory, and each message's copy is
+	// wiped once read. The buffer grows with the data that has actually
+	// arrived, so a header declaring a large size reserves nothing by itself.
+	if u.plaintext, err = NewSecureBuffer(int(min(h.Size, grpcUploadInitialBuffer))); err != nil {
+		fmt.Printf("[gRPC Upload] Secure allocation failed: %v\n", err)
+		return status.Error(codes.Internal, "Failed to read file")
+	}
+	defer func() { u.plaintext.Destroy() }()
+	n := 0
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if msg.GetHeader() != nil {
+			return status.Error(codes.InvalidArgument, "Only the first message may be a header")
+		}
+		data := msg.GetData()
+		if int64(n+len(data)) > h.Size {
+			wipe(data)
+			return status.Error(codes.InvalidArgument, "The file is longer than size")
+		}
+		if n+len(data) > u.plaintext.Len() {
+			// Double, up to the declared size.
+			grown, err := NewSecureBuffer(int(min(h.Size, int64(max(n+len(data), 2*u.plaintext.Len())))))
+			if err != nil {
+				wipe(data)
+				fmt.Printf("[gRPC Upload] Secure allocation failed: %v\n", err)
+				return status.Error(codes.Internal, "Failed to read file")
+			}
+			copy(grown.Bytes(), u.plaintext.Bytes()[:n])
+			u.plaintext.Destroy()
+			u.plaintext = grown
+		}
+		n += copy(u.plaintext.Bytes()[n:], data)
+		wipe(data)
+	}
+	if int64(n) != h.Size {
+		return status.Error(codes.InvalidArgument, "The file is shorter than size")
+	}
+
+	out, key, err := u.run(nil)
+	if errors.Is(err, errShuttingDown) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer key.Destroy()
+	pb := &vaultpb.UploadResponse{
+		VaultId:         out.VaultID,
+		OriginalHash:    out.OriginalHash,
+		RootHash:        out.RootHash,
+		FileName:        out.FileName,
+		ManifestContent: out.ManifestContent,
+		KeyWrap:         out.KeyWrap,
+		UnlockAt:        rfc3339Timestamp(out.UnlockAt),
+		ExpiresAt:       rfc3339Timestamp(out.ExpiresAt),
+		NextWindow:      windowProto(out.NextWindow),
+		PuzzleSquarings: out.PuzzleSquarings,
+	}
+	if key != nil {
+		pb.EncryptionKey = bytes.Clone(key.Bytes())
+		defer wipe(pb.EncryptionKey)
+	}
+	if err := stream.SendAndClose(pb); err != nil {
+		return err
+	}
+	fmt.Printf("[gRPC Upload] Success. Merkle Root: %s\n", out.RootHash[:10])
+	auditAs(c.userID, c.ip, "upload", out.VaultID, auditOutcomeSuccess, out.FileName)
+	return nil
+}
+
+// uploadForm is the /upload form equivalent to h's options.
+func uploadForm(h *vaultpb.UploadHeader) url.Values {
+	f := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			f.Set(k, v)
+		}
+	}
+	setInt := func(k string, v *int32) {
+		if v != nil {
+			f.Set(k, strconv.Itoa(int(*v)))
+		}
+	}
+	set("kem_public_key", h.KemPublicKey)
+	set("unlock_at", h.UnlockAt)
+	set("schedule", h.Schedule)
+	set("schedule_window", h.ScheduleWindow)
+	set("schedule_tz", h.ScheduleTz)
+	set("geofence", h.Geofence)
+	setInt("deadman_checkin_days", h.DeadmanCheckinDays)
+	setInt("deadman_grace_days", h.DeadmanGraceDays)
+	set("beneficiaries", strings.Join(h.Beneficiaries, ","))
+	set("chain_after", strings.Join(h.ChainAfter, ","))
+	set("approvers", strings.Join(h.Approvers, ","))
+	set("approver_keys", h.ApproverKeys)
+	setInt("approval_threshold", h.ApprovalThreshold)
+	set("approval_window", h.ApprovalWindow)
+	set("policy", h.Policy)
+	setInt("retention_days", h.RetentionDays)
+	set("expires_at", h.ExpiresAt)
+	if h.OneTime {
+		f.Set("one_time", "true")
+	}
+	set("deliver_at", h.DeliverAt)
+	set("deliver_to", strings.Join(h.DeliverTo, ","))
+	set("puzzle_delay", h.PuzzleDelay)
+	return f
+}
+
+func (s *grpcVaultServer) Retrieve(req *vaultpb.RetrieveRequest, stream vaultpb.VaultService_RetrieveServer) error {
+	ctx := stream.Context()
+	body, contentType, err := retrieveForm(req)
+	if err != nil {
+		return status.Error(codes.Internal, "Failed to build request")
+	}
+	defer wipe(body)
+	r := callerFrom(ctx).request(ctx, http.MethodPost, "/retrieve", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	defer func() {
+		if r.MultipartForm != nil {
+			r.MultipartForm.RemoveAll()
+		}
+	}()
+
+	sentHeader := false
+	resp := &grpcResponse{stream: func(h http.Header, p []byte) error {
+		if !sentHeader {
+			sentHeader = true
+			if err := stream.Send(&vaultpb.RetrieveResponse{Payload: &vaultpb.RetrieveResponse_Header{Header: retrieveHeader(h)}}); err != nil {
+				return err
+			}
+		}
+		for len(p) > 0 {
+			n := min(len(p), grpcChunkSize)
+			if err := stream.Send(&vaultpb.RetrieveResponse{Payload: &vaultpb.RetrieveResponse_Data{Data: p[:n]}}); err != nil {
+				return err
+			}
+			p = p[n:]
+		}
+		return nil
+	}}
+	retrieveHandler(resp, r)
+	return resp.result()
+}
+
+// retrieveForm encodes req as the multipart /retrieve form.
+func retrieveForm(req *vaultpb.RetrieveRequest) ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	files := []struct {
+		field string
+		data  []byte
+	}{
+		{"roothash_file", []byte(req.RootHash)},
+		{"manifest_file", []byte(req.Manifest)},
+		{"key_file", req.Key},
+		{"kem_key_file", req.KemPrivateKey},
+	}
+	for _, f := range files {
+		if len(f.data) == 0 {
+			continue
+		}
+		part, err := mw.CreateFormFile(f.field, f.field)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(f.data)
+	}
+	for k, v := range map[string]string{
+		"original_hash":        req.OriginalHash,
+		"location_attestation": req.LocationAttestation,
+		"location_signature":   req.LocationSignature,
+	} {
+		if v != "" {
+			mw.WriteField(k, v)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+// retrieveHeader reads the headers retrieveHandler sets with the file.
+func retrieveHeader(h http.Header) *vaultpb.RetrieveHeader {
+	out := &vaultpb.RetrieveHeader{Integrity: vaultpb.Integrity_INTEGRITY_UNAVAILABLE}
+	if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		out.FileName = params["filename"]
+	}
+	switch h.Get("X-Integrity-Verified") {
+	case "true":
+		out.Integrity = vaultpb.Integrity_INTEGRITY_VERIFIED
+	case "false":
+		out.Integrity = vaultpb.Integrity_INTEGRITY_MISMATCH
+	}
+	if v := h.Get("X-Chain-Released"); v != "" {
+		out.ChainReleased = strings.Split(v, ",")
+	}
+	return out
+}
+
+func (s *grpcVaultServer) Delete(ctx context.Context, req *vaultpb.DeleteRequest) (*vaultpb.Vault, error) {
+	r := callerFrom(ctx).request(ctx, http.MethodDelete, "/v1/vaults/{id}", nil)
+	r.SetPathValue("id", req.VaultId)
+	var out VaultMetadata
+	if err := callJSON(deleteVaultHandler, r, &out); err != nil {
+		return nil, err
+	}
+	return vaultProto(&out), nil
+}
+
+func (s *grpcVaultServer) GetVault(ctx context.Context, req *vaultpb.GetVaultRequest) (*vaultpb.Vault, error) {
+	r := callerFrom(ctx).request(ctx, http.MethodGet, "/v1/vaults/{id}", nil)
+	r.SetPathValue("id", req.VaultId)
+	var out VaultMetadata
+	if err := callJSON(getVaultHandler, r, &out); err != nil {
+		return nil, err
+	}
+	return vaultProto(&out), nil
+}
+
+func (s *grpcVaultServer) ListVaults(ctx context.Context, req *vaultpb.ListVaultsRequest) (*vaultpb.ListVaultsResponse, error) {
+	r := callerFrom(ctx).request(ctx, http.MethodGet, "/v1/vaults", nil)
+	q := url.Values{}
+	if req.Limit != 0 {
+		q.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+	if req.Cursor != "" {
+		q.Set("cursor", req.Cursor)
+	}
+	if req.IncludeDeleted {
+		q.Set("include_deleted", "true")
+	}
+	r.URL.RawQuery = q.Encode()
+	var out VaultList
+	if err := callJSON(listVaultsHandler, r, &out); err != nil {
+		return nil, err
+	}
+	resp := &vaultpb.ListVaultsResponse{NextCursor: out.NextCursor}
+	for i := range out.Vaults {
+		resp.Vaults = append(resp.Vaults, vaultProto(&out.Vaults[i]))
+	}
+	return resp, nil
+}
+
+// --- Conversions ---
+
+func vaultProto(m *VaultMetadata) *vaultpb.Vault {
+	v := &vaultpb.Vault{
+		Id:           m.ID,
+		FileName:     m.FileName,
+		RootHash:     m.RootHash,
+		OriginalHash: m.OriginalHash,
+		CreatedAt:    timestamppb.New(m.CreatedAt),
+		Chunks:       int32(m.Chunks),
+		Locks:        m.Locks,
+		KeyWithheld:  m.KeyWithheld,
+		UnlockAt:     timestampOrNil(m.UnlockAt),
+		NextWindow:   windowProto(m.NextWindow),
+		UnlockedAt:   timestampOrNil(m.UnlockedAt),
+		ExpiresAt:    timestampOrNil(m.ExpiresAt),
+		ConsumedAt:   timestampOrNil(m.ConsumedAt),
+		LegalHold:    m.LegalHold,
+	}
+	if d := m.Deletion; d != nil {
+		v.Deletion = &vaultpb.Deletion{
+			At:             timestamppb.New(d.At),
+			Reason:         d.Reason,
+			KeyShredded:    d.KeyShredded,
+			ChunksTotal:    int32(d.ChunksTotal),
+			ChunksUnpinned: int32(d.ChunksUnpinned),
+			ChunksFailed:   d.ChunksFailed,
+			CompletedAt:    timestampOrNil(d.CompletedAt),
+		}
+	}
+	return v
+}
+
+func windowProto(w *windowInfo) *vaultpb.Window {
+	if w == nil {
+		return nil
+	}
+	return &vaultpb.Window{Opens: rfc3339Timestamp(w.Opens), Closes: rfc3339Timestamp(w.Closes), Open: w.Open}
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func rfc3339Timestamp(s string) *timestamppb.Timestamp {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return timestamppb.New(t)
+}
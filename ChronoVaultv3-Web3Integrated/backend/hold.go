@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Legal Hold (WORM) ---
+//
+// A legal hold makes a vault immutable until it is lifted:
+//
+//   - /delete refuses to unpin its chunks
+//   - the retention reaper skips it, even when it is past expiry
+//   - a one-time vault on hold can't be read, since reading burns it
+//
+// Only admins can place or lift holds. An admin is a user whose ID is listed
+// in ADMIN_USER_IDS, or whose JWT carries app_metadata.role = "admin". The
+// reason and the admin's identity are recorded. Lifted holds are kept in
+// HoldHistory.
+
+// LegalHold records who placed a hold and why, and who lifted it.
+type LegalHold struct {
+	Reason        string     `json:"reason"`
+	PlacedBy      string     `json:"placed_by"`
+	PlacedByEmail string     `json:"placed_by_email,omitempty"`
+	PlacedAt      time.Time  `json:"placed_at"`
+	LiftReason    string     `json:"lift_reason,omitempty"`
+	LiftedBy      string     `json:"lifted_by,omitempty"`
+	LiftedAt      *time.Time `json:"lifted_at,omitempty"`
+}
+
+var errLegalHold = errors.New("vault is under legal hold")
+
+// checkMutable returns errLegalHold when rec may not be changed or destroyed.
+func checkMutable(rec *VaultRecord) error {
+	if rec.LegalHold != nil {
+		return errLegalHold
+	}
+	return nil
+}
+
+// isAdmin reports whether the authenticated caller may manage holds.
+func isAdmin(r *http.Request) bool {
+	if r.Header.Get("X-User-Role") == "admin" {
+		return true
+	}
+	userID := r.Header.Get("X-User-ID")
+	for _, id := range cfg.AdminUserIDs {
+		if id = strings.TrimSpace(id); id != "" && id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// writeLegalHold answers a request refused because of a hold.
+func writeLegalHold(w http.ResponseWriter, rec *VaultRecord) {
+	body := map[string]string{
+		"error":    "Vault is under legal hold",
+		"code":     "LEGAL_HOLD",
+		"vault_id": rec.ID,
+	}
+	if rec.LegalHold != nil {
+		body["hold_placed_at"] = rec.LegalHold.PlacedAt.Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusLocked, body)
+}
+
+// heldCIDs maps the chunks of every held vault to its ID. /delete works from
+// the manifest's CIDs, which need not carry a Vault-ID.
+func heldCIDs() map[string]string {
+	held := map[string]string{}
+	for _, rec := range vaults.List() {
+		if rec.LegalHold == nil {
+			continue
+		}
+		for _, cid := range rec.CIDs {
+			held[cid] = rec.ID
+		}
+	}
+	return held
+}
+
+// holdHandler places or lifts a hold. Form fields: vault_id, action
+// ("place" or "lift") and reason.
+func holdHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	if !isAdmin(r) {
+		writeError(w, http.StatusForbidden, "Only an admin can manage legal holds")
+		return
+	}
+	action := r.FormValue("action")
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" || len(reason) > 1000 {
+		writeError(w, http.StatusBadRequest, "A reason (up to 1000 characters) is required")
+		return
+	}
+	userID, email := r.Header.Get("X-User-ID"), r.Header.Get("X-User-Email")
+	now := time.Now().UTC()
+
+	var updated VaultRecord
+	err := vaults.Update(rec.ID, func(v *VaultRecord) error {
+		switch action {
+		case "place":
+			if v.LegalHold != nil {
+				return fmt.Errorf("vault is already under legal hold")
+			}
+			if v.Deletion != nil {
+				return fmt.Errorf("vault has already been deleted")
+			}
+			v.LegalHold = &LegalHold{Reason: reason, PlacedBy: userID, PlacedByEmail: email, PlacedAt: now}
+		case "lift":
+			if v.LegalHold == nil {
+				return fmt.Errorf("vault is not under legal hold")
+			}
+			lifted := *v.LegalHold
+			lifted.LiftReason, lifted.LiftedBy, lifted.LiftedAt = reason, userID, &now
+			v.HoldHistory = append(append([]LegalHold(nil), v.HoldHistory...), lifted)
+			v.LegalHold = nil
+		default:
+			return fmt.Errorf("action must be \"place\" or \"lift\"")
+		}
+		updated = *v
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	fmt.Printf("[LegalHold] AUDIT action=%s vault=%s by=%s (%s) reason=%q\n", action, rec.ID, userID, email, reason)
+	auditEvent(r, "hold."+action, rec.ID, auditOutcomeSuccess, reason)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"vault_id":     rec.ID,
+		"legal_hold":   updated.LegalHold,
+		"hold_history": updated.HoldHistory,
+	})
+}
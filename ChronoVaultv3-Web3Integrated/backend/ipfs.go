@@ -2,17 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
 // --- CID Validation ---
@@ -40,9 +38,7 @@ func isValidCID(cid string) bool {
 var pinataJWT string
 
 func initIPFSConfig() {
-	_ = godotenv.Load()
-
-	jwt := os.Getenv("PINATA_JWT")
+	jwt := cfg.PinataJWT
 	if jwt == "" {
 		fmt.Println("⚠️  WARNING: PINATA_JWT not found in environment. IPFS operations will fail.")
 		return
@@ -69,31 +65,47 @@ const maxIPFSRetries = 3
 
 // UploadChunkToIPFS pushes a byte slice to the global IPFS network.
 // Uses exponential backoff with 3 retries for transient failures.
-func UploadChunkToIPFS(chunk []byte, filename string) (string, error) {
+// Cancelling ctx abandons the upload, including a request in flight.
+func UploadChunkToIPFS(ctx context.Context, chunk []byte, filename string) (string, error) {
 	if pinataJWT == "" {
+		metricIPFSFailures.inc("unconfigured")
 		return "", fmt.Errorf("IPFS not configured: missing PINATA_JWT")
 	}
 
 	var lastErr error
 	for attempt := 0; attempt < maxIPFSRetries; attempt++ {
 		if attempt > 0 {
+			metricIPFSRetries.inc()
 			backoff := time.Duration(1<<uint(attempt-1)) * time.Second // 1s, 2s
 			fmt.Printf("   [IPFS] Retry %d/%d after %v...\n", attempt+1, maxIPFSRetries, backoff)
-			time.Sleep(backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				metricIPFSFailures.inc("cancelled")
+				return "", ctx.Err()
+			}
 		}
 
-		cid, err := doUploadChunk(chunk, filename)
+		started := time.Now()
+		cid, err := doUploadChunk(ctx, chunk, filename)
+		metricIPFSAttempt.observe(time.Since(started).Seconds(), outcomeLabel(err))
 		if err == nil {
+			metricChunksPinned.inc()
 			return cid, nil
 		}
+		if ctx.Err() != nil {
+			metricIPFSFailures.inc("cancelled")
+			return "", ctx.Err()
+		}
 		lastErr = err
 		fmt.Printf("   [IPFS] Upload attempt %d failed: %v\n", attempt+1, err)
 	}
 
+	metricIPFSFailures.inc("exhausted")
 	return "", fmt.Errorf("IPFS upload failed after %d attempts: %w", maxIPFSRetries, lastErr)
 }
 
-func doUploadChunk(chunk []byte, filename string) (string, error) {
+func doUploadChunk(ctx context.Context, chunk []byte, filename string) (string, error) {
 	// Prepare the multipart form data required by Pinata
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -107,7 +119,7 @@ func doUploadChunk(chunk []byte, filename string) (string, error) {
 	writer.Close()
 
 	// Send to Pinata
-	req, err := http.NewRequest("POST", "https://api.pinata.cloud/pinning/pinFileToIPFS", body)
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.PinataAPIURL+"/pinning/pinFileToIPFS", body)
 	if err != nil {
 		return "", err
 	}
@@ -148,8 +160,9 @@ func doUploadChunk(chunk []byte, filename string) (string, error) {
 
 // maxChunkDownload is the maximum bytes we will read from a single IPFS chunk.
 // A malicious or misconfigured gateway could otherwise stream gigabytes into RAM.
-// ChunkSize (256 KB) + 16-byte GCM tag + 12-byte nonce + 1 KB margin.
-const maxChunkDownload = ChunkSize + 4*1024
+// The largest chunk_size (4 MB) + 16-byte GCM tag + 12-byte nonce + margin,
+// so vaults written under an earlier, larger chunk_size stay readable.
+const maxChunkDownload = maxChunkSize + 4*1024
 
 // DownloadChunkFromIPFS fetches a chunk back from the decentralized network.
 func DownloadChunkFromIPFS(cid string) ([]byte, error) {
@@ -160,7 +173,7 @@ func DownloadChunkFromIPFS(cid string) ([]byte, error) {
 	fmt.Printf("   [IPFS] Locating and fetching CID: %s...\n", cid)
 
 	// Use a pre-validated constant base URL — never interpolate user input into paths.
-	url := "https://gateway.pinata.cloud/ipfs/" + cid
+	url := cfg.PinataGatewayURL + "/ipfs/" + cid
 
 	resp, err := ipfsClient.Get(url)
 	if err != nil {
@@ -196,7 +209,7 @@ func UnpinFromIPFS(cid string) error {
 		return fmt.Errorf("invalid or unsafe CID: %q", cid)
 	}
 
-	url := "https://api.pinata.cloud/pinning/unpin/" + cid
+	url := cfg.PinataAPIURL + "/pinning/unpin/" + cid
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return err
@@ -0,0 +1,597 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Asynchronous Upload Jobs ---
+//
+// A plain /upload holds the request open through encryption and every Pinata
+// upload, which is why the server's WriteTimeout is two minutes. With
+// async=true, /upload and POST /v1/vaults check the form, read the file into
+// locked memory and answer 202 with a job straight away. A worker then runs
+// the pipeline and records each step as an event:
+//
+//	queued      accepted, waiting for a worker
+//	started     a worker picked the job up
+//	encrypted   the file is encrypted; chunks says how many will be pinned
+//	pinned      one per chunk, with its index and CID
+//	registered  the manifest is signed and the vault is in the registry
+//	done        the UploadResponse is ready
+//	failed      the pipeline stopped; pinned chunks are queued for unpinning
+//
+// v3 doesn't anchor vaults on chain, so registration is the last stage.
+//
+// GET /v1/jobs/{id} returns the job, with the UploadResponse once it is done.
+// GET /v1/jobs/{id}/events streams the events as Server-Sent Events. It
+// replays every event after Last-Event-ID first, so a client that drops the
+// connection reconnects and carries on. The data of the done event is the
+// UploadResponse itself.
+//
+// Jobs are persisted under <VAULT_DATA_DIR>/jobs and outlive both the
+// connection and a restart. The plaintext never leaves memory, so a job that
+// was queued or running when the server stopped is failed on startup. Any
+// chunks it had pinned are queued for unpinning. The data key of a finished
+// job is stored wrapped under the KEK, so an async upload that returns the
+// key needs one, as escrow does. A finished job is removed after
+// UPLOAD_JOB_TTL (default 1h), or sooner by DELETE /v1/jobs/{id}.
+//
+// A job has the ID of the vault it creates and is visible only to its owner.
+
+const (
+	jobQueued  = "queued"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+
+	defaultUploadWorkers = 2
+	defaultUploadJobTTL  = time.Hour
+	maxQueuedUploads     = 8
+
+	sseHeartbeat    = 15 * time.Second
+	sseWriteTimeout = 30 * time.Second
+)
+
+var errUploadQueueFull = errors.New("upload queue is full")
+
+// JobEvent is one step of an upload job.
+type JobEvent struct {
+	Seq    int       `json:"seq"`
+	Type   string    `json:"type"`
+	At     time.Time `json:"at"`
+	Chunk  int       `json:"chunk,omitempty"`
+	Chunks int       `json:"chunks,omitempty"`
+	CID    string    `json:"cid,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// JobStatus is the public view of an upload job.
+type JobStatus struct {
+	ID           string          `json:"id"`
+	State        string          `json:"state"`
+	FileName     string          `json:"file_name"`
+	CreatedAt    time.Time       `json:"created_at"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+	Chunks       int             `json:"chunks"`
+	ChunksPinned int             `json:"chunks_pinned"`
+	Events       []JobEvent      `json:"events"`
+	Error        string          `json:"error,omitempty"`
+	Result       *UploadResponse `json:"result,omitempty"`
+	EventsURL    string          `json:"events_url"`
+}
+
+// uploadJob is the persisted state of a job.
+type uploadJob struct {
+	ID         string          `json:"id"`
+	Owner      string          `json:"owner"`
+	FileName   string          `json:"file_name"`
+	State      string          `json:"state"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Events     []JobEvent      `json:"events"`
+	Error      string          `json:"error,omitempty"`
+	Result     *UploadResponse `json:"result,omitempty"` // encryption_key blank
+	WrappedKey []byte          `json:"wrapped_key,omitempty"`
+
+	changed chan struct{} // closed and replaced on every change
+}
+
+func (j *uploadJob) finished() bool {
+	return j.State == jobDone || j.State == jobFailed
+}
+
+// pinnedCIDs lists the chunks the job's events say were pinned.
+func (j *uploadJob) pinnedCIDs() []string {
+	var cids []string
+	for _, e := range j.Events {
+		if e.Type == "pinned" {
+			cids = append(cids, e.CID)
+		}
+	}
+	return cids
+}
+
+func (j *uploadJob) status() JobStatus {
+	st := JobStatus{
+		ID:         j.ID,
+		State:      j.State,
+		FileName:   j.FileName,
+		CreatedAt:  j.CreatedAt,
+		FinishedAt: j.FinishedAt,
+		Events:     j.Events,
+		Error:      j.Error,
+		Result:     j.Result,
+		EventsURL:  "/v1/jobs/" + j.ID + "/events",
+	}
+	for _, e := range j.Events {
+		switch e.Type {
+		case "encrypted":
+			st.Chunks = e.Chunks
+		case "pinned":
+			st.ChunksPinned = e.Chunk
+		}
+	}
+	if st.Events == nil {
+		st.Events = []JobEvent{}
+	}
+	return st
+}
+
+// resultKey unwraps a finished job's data key and hex-encodes it into locked
+// memory. It returns nil when the result carries no key.
+func (j *uploadJob) resultKey() (*SecureBuffer, error) {
+	if j.WrappedKey == nil {
+		return nil, nil
+	}
+	unwrapped, err := keyProvider.UnwrapKey(j.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := NewSecureBufferFrom(unwrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+	return hexKey(key)
+}
+
+// queuedUpload is a job waiting for a worker, with what only lives in memory.
+type queuedUpload struct {
+	u     *uploadRequest
+	actor string
+	ip    string
+}
+
+type jobStore struct {
+	mu      sync.Mutex
+	dir     string
+	jobs    map[string]*uploadJob
+	queue   chan *queuedUpload
+	workers int
+	ttl     time.Duration
+}
+
+var jobs = &jobStore{jobs: make(map[string]*uploadJob), queue: make(chan *queuedUpload, maxQueuedUploads)}
+
+// initUploadJobs loads persisted jobs and fails those a restart interrupted.
+func initUploadJobs() {
+	jobs.workers = cfg.UploadWorkers
+	jobs.ttl = cfg.UploadJobTTL
+	if err := jobs.open(filepath.Join(vaults.dir, "jobs")); err != nil {
+		fmt.Printf("⚠️  Upload jobs unavailable: %v\n", err)
+		return
+	}
+	fmt.Printf("📤 Upload jobs: %d worker(s), %d job(s) kept for %v\n", jobs.workers, len(jobs.jobs), jobs.ttl)
+}
+
+func (s *jobStore) open(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.Name(), err)
+		}
+		j := &uploadJob{}
+		if err := json.Unmarshal(data, j); err != nil {
+			return fmt.Errorf("parse %s: %w", e.Name(), err)
+		}
+		j.changed = make(chan struct{})
+		s.jobs[j.ID] = j
+		if j.finished() {
+			continue
+		}
+		// The plaintext went with the old process. A vault that got as far
+		// as the registry keeps its chunks; otherwise they are orphans.
+		if _, err := vaults.Get(j.ID); err != nil {
+			if cids := j.pinnedCIDs(); len(cids) > 0 {
+				if err := unpins.Enqueue(j.ID, cids); err != nil {
+					fmt.Printf("[Jobs] Rollback of %s not queued: %v\n", j.ID, err)
+				}
+			}
+		}
+		s.fail(j, "Interrupted by a server restart")
+		if err := s.persist(j); err != nil {
+			return fmt.Errorf("write %s: %w", e.Name(), err)
+		}
+		fmt.Printf("[Jobs] Job %s was interrupted by a restart\n", j.ID)
+	}
+	return nil
+}
+
+// run starts the workers and removes expired jobs until the process exits.
+func (s *jobStore) run() {
+	for i := 0; i < s.workers; i++ {
+		go s.work()
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		s.expire(time.Now())
+		<-ticker.C
+	}
+}
+
+func (s *jobStore) work() {
+	for q := range s.queue {
+		s.runUpload(q)
+	}
+}
+
+// submit persists a new job and queues it, returning its status as queued.
+// It fails with errUploadQueueFull rather than wait for a worker.
+func (s *jobStore) submit(j *uploadJob, q *queuedUpload) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return JobStatus{}, fmt.Errorf("upload jobs not initialised")
+	}
+	j.changed = make(chan struct{})
+	s.record(j, JobEvent{Type: jobQueued})
+	if err := s.persist(j); err != nil {
+		return JobStatus{}, err
+	}
+	select {
+	case s.queue <- q:
+		s.jobs[j.ID] = j
+		return j.status(), nil
+	default:
+		os.Remove(filepath.Join(s.dir, j.ID+".json"))
+		return JobStatus{}, errUploadQueueFull
+	}
+}
+
+// runUpload runs one job's pipeline and records the outcome.
+func (s *jobStore) runUpload(q *queuedUpload) {
+	defer q.u.plaintext.Destroy()
+	id := q.u.rec.ID
+	s.update(id, func(j *uploadJob) {
+		j.State = jobRunning
+		s.record(j, JobEvent{Type: "started"})
+	})
+	fmt.Printf("[Jobs] Upload %s started (%s)\n", id, q.u.rec.FileName)
+
+	resp, key, err := q.u.run(&pipelineHooks{
+		Encrypted: func(size, chunks int) {
+			s.update(id, func(j *uploadJob) { s.record(j, JobEvent{Type: "encrypted", Chunks: chunks}) })
+		},
+		Pinned: func(index, chunks int, cid string) {
+			s.update(id, func(j *uploadJob) { s.record(j, JobEvent{Type: "pinned", Chunk: index, Chunks: chunks, CID: cid}) })
+		},
+	})
+	if err != nil {
+		s.update(id, func(j *uploadJob) { s.fail(j, err.Error()) })
+		fmt.Printf("[Jobs] Upload %s failed: %v\n", id, err)
+		return
+	}
+	defer key.Destroy()
+	s.update(id, func(j *uploadJob) { s.record(j, JobEvent{Type: "registered"}) })
+
+	var wrapped []byte
+	if key != nil {
+		if wrapped, err = keyProvider.WrapKey(key.Bytes()); err != nil {
+			fmt.Printf("[Jobs] Result key wrap for %s FAILED: %v\n", id, err)
+			s.update(id, func(j *uploadJob) { s.fail(j, "Vault registered, but its key could not be kept for the result") })
+			return
+		}
+	}
+	key.Destroy()
+
+	s.update(id, func(j *uploadJob) {
+		now := time.Now().UTC()
+		j.State, j.FinishedAt = jobDone, &now
+		j.Result, j.WrappedKey = resp, wrapped
+		s.record(j, JobEvent{Type: jobDone})
+	})
+	fmt.Printf("[Jobs] Upload %s done. Merkle Root: %s\n", id, resp.RootHash[:10])
+	auditAs(q.actor, q.ip, "upload", id, auditOutcomeSuccess, resp.FileName)
+}
+
+// update applies fn to a job, persists it and wakes its watchers.
+func (s *jobStore) update(id string, fn func(*uploadJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	fn(j)
+	if err := s.persist(j); err != nil {
+		fmt.Printf("[Jobs] Job %s write failed: %v\n", id, err)
+	}
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// record appends an event. It must be called with s.mu held.
+func (s *jobStore) record(j *uploadJob, e JobEvent) {
+	e.Seq = len(j.Events) + 1
+	e.At = time.Now().UTC()
+	j.Events = append(j.Events, e)
+}
+
+// fail finishes j as failed. It must be called with s.mu held.
+func (s *jobStore) fail(j *uploadJob, msg string) {
+	now := time.Now().UTC()
+	j.State, j.FinishedAt, j.Error = jobFailed, &now, msg
+	s.record(j, JobEvent{Type: jobFailed, Error: msg})
+}
+
+// persist must be called with s.mu held.
+func (s *jobStore) persist(j *uploadJob) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, j.ID+".json"), data, 0600)
+}
+
+// get returns a copy of the job and the channel that is closed on its next
+// change.
+func (s *jobStore) get(id string) (*uploadJob, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil, nil, false
+	}
+	cp := *j
+	cp.Events = append([]JobEvent(nil), j.Events...)
+	return &cp, j.changed, true
+}
+
+// remove deletes a finished job.
+func (s *jobStore) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(s.jobs, id)
+	close(j.changed)
+	return nil
+}
+
+// expire removes jobs that finished more than ttl ago.
+func (s *jobStore) expire(now time.Time) {
+	s.mu.Lock()
+	var due []string
+	for id, j := range s.jobs {
+		if j.finished() && now.Sub(*j.FinishedAt) > s.ttl {
+			due = append(due, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range due {
+		if err := s.remove(id); err != nil {
+			fmt.Printf("[Jobs] Removing expired job %s failed: %v\n", id, err)
+		}
+	}
+}
+
+// --- Handlers ---
+
+// submitUploadJob queues a parsed upload and answers 202. It takes ownership
+// of u.plaintext.
+func submitUploadJob(w http.ResponseWriter, r *http.Request, u *uploadRequest) {
+	if u.returnsKey() {
+		if _, err := keyProvider.WrapKey(make([]byte, 32)); err != nil {
+			u.plaintext.Destroy()
+			fmt.Printf("[Jobs] Result key wrapping unavailable: %v\n", err)
+			writeError(w, http.StatusServiceUnavailable, "Asynchronous uploads are not available: server has no key-encryption key")
+			return
+		}
+	}
+	j := &uploadJob{ID: u.rec.ID, Owner: u.rec.Owner, FileName: u.rec.FileName, State: jobQueued, CreatedAt: time.Now().UTC()}
+	q := &queuedUpload{u: u, actor: r.Header.Get("X-User-ID"), ip: extractIP(r)}
+	st, err := jobs.submit(j, q)
+	if err != nil {
+		u.plaintext.Destroy()
+		if errors.Is(err, errUploadQueueFull) {
+			w.Header().Set("Retry-After", "30")
+			writeError(w, http.StatusServiceUnavailable, "Upload queue is full, try again shortly")
+			return
+		}
+		fmt.Printf("[Jobs] Job creation failed: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "Failed to create upload job")
+		return
+	}
+	fmt.Printf("[Jobs] Upload %s queued for %s\n", j.ID, j.Owner)
+	w.Header().Set("Location", "/v1/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, st)
+}
+
+// ownedJob resolves the {id} path parameter to a job the caller owns.
+func ownedJob(w http.ResponseWriter, r *http.Request) (*uploadJob, <-chan struct{}) {
+	id := r.PathValue("id")
+	if !isValidVaultID(id) {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return nil, nil
+	}
+	j, changed, ok := jobs.get(id)
+	if !ok || j.Owner != r.Header.Get("X-User-ID") {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return nil, nil
+	}
+	return j, changed
+}
+
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	j, _ := ownedJob(w, r)
+	if j == nil {
+		return
+	}
+	if j.Result == nil {
+		writeJSON(w, http.StatusOK, j.status())
+		return
+	}
+	keyHex, err := j.resultKey()
+	if err != nil {
+		fmt.Printf("[Jobs] Result key unwrap failed for %s: %v\n", j.ID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to release the result key")
+		return
+	}
+	defer keyHex.Destroy()
+	if err := writeKeyedJSON(w, http.StatusOK, j.status(), keyHex); err != nil {
+		fmt.Printf("[Jobs] Response encoding failed: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "Failed to encode response")
+	}
+}
+
+// deleteJobHandler discards a finished job, and with it the only copy of the
+// result key.
+func deleteJobHandler(w http.ResponseWriter, r *http.Request) {
+	j, _ := ownedJob(w, r)
+	if j == nil {
+		return
+	}
+	if !j.finished() {
+		writeError(w, http.StatusConflict, "Job is still running")
+		return
+	}
+	if err := jobs.remove(j.ID); err != nil {
+		fmt.Printf("[Jobs] Removing job %s failed: %v\n", j.ID, err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete job")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jobEventsHandler streams a job's events as Server-Sent Events until the job
+// finishes or the client goes away.
+func jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	j, changed := ownedJob(w, r)
+	if j == nil {
+		return
+	}
+	after := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		after = n
+	}
+
+	// The server's WriteTimeout would end the stream, so every write gets
+	// its own deadline instead.
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+		for _, e := range j.Events {
+			if e.Seq <= after {
+				continue
+			}
+			if err := writeJobEvent(w, j, e); err != nil {
+				fmt.Printf("[Jobs] Event stream for %s ended: %v\n", j.ID, err)
+				return
+			}
+			after = e.Seq
+		}
+		if err := rc.Flush(); err != nil || j.finished() {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(sseWriteTimeout))
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			continue
+		case <-r.Context().Done():
+			return
+		}
+		var ok bool
+		if j, changed, ok = jobs.get(j.ID); !ok {
+			return // deleted
+		}
+	}
+}
+
+// writeJobEvent writes one SSE message. The done event carries the
+// UploadResponse, with the key spliced in from locked memory.
+func writeJobEvent(w http.ResponseWriter, j *uploadJob, e JobEvent) error {
+	if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: ", e.Seq, e.Type); err != nil {
+		return err
+	}
+	if e.Type == jobDone && j.Result != nil {
+		head, tail, err := splitAtKey(j.Result)
+		if err != nil {
+			return err
+		}
+		keyHex, err := j.resultKey()
+		if err != nil {
+			return err
+		}
+		defer keyHex.Destroy()
+		w.Write(head)
+		w.Write(keyHex.Bytes())
+		w.Write(tail)
+	} else {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		w.Write(data)
+	}
+	_, err := fmt.Fprint(w, "\n\n")
+	return err
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// --- Hybrid Post-Quantum Key Wrapping (X25519 + ML-KEM-768) ---
+//
+// Time-capsule vaults are designed to stay sealed for years, which makes them
+// the textbook target for "harvest now, decrypt later": an adversary records
+// the wrapped key today and breaks the classical KEM once a quantum computer
+// is available. Wrapping the AES data key under BOTH X25519 and ML-KEM-768
+// keeps the vault safe as long as either primitive holds.
+//
+// The key-encryption key is derived with HKDF-SHA256 over the two shared
+// secrets, bound to the ML-KEM ciphertext, the ephemeral X25519 key and the
+// recipient's X25519 key so that no component can be swapped independently.
+// The data key is then sealed with AES-256-GCM (nonce || ciphertext, the same
+// layout EncryptAndStore uses for file data).
+//
+// The wrap lives in the manifest as "# Key-Wrap" headers, so the manifest is
+// the capsule: whoever holds the matching hybrid private key can unwrap it via
+// POST /retrieve or the "unwrap" CLI command.
+
+const (
+	kemSuite = "X25519-MLKEM768"
+
+	hybridPublicKeySize  = 32 + mlkem.EncapsulationKeySize768 // X25519 pub || ML-KEM ek
+	hybridPrivateKeySize = 32 + mlkem.SeedSize                // X25519 priv || ML-KEM seed
+
+	manifestKeyWrapPrefix    = "# Key-Wrap: "
+	manifestKEMCtPrefix      = "# KEM-Ciphertext: "
+	manifestKEMEphPrefix     = "# KEM-Ephemeral: "
+	manifestWrappedKeyPrefix = "# Wrapped-Key: "
+)
+
+// HybridPublicKey is the recipient key a vault's data key is wrapped to.
+type HybridPublicKey struct {
+	X25519 *ecdh.PublicKey
+	MLKEM  *mlkem.EncapsulationKey768
+}
+
+// HybridPrivateKey unwraps data keys wrapped to its public half.
+type HybridPrivateKey struct {
+	X25519 *ecdh.PrivateKey
+	MLKEM  *mlkem.DecapsulationKey768
+}
+
+// WrappedKey is a data key sealed to a HybridPublicKey.
+type WrappedKey struct {
+	Suite           string
+	MLKEMCiphertext []byte
+	X25519Ephemeral []byte
+	Sealed          []byte // nonce || AES-GCM(kek, dataKey)
+}
+
+// GenerateHybridKey creates a fresh X25519 + ML-KEM-768 key pair.
+func GenerateHybridKey() (*HybridPrivateKey, error) {
+	xPriv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 key generation failed: %w", err)
+	}
+	dk, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, fmt.Errorf("ML-KEM key generation failed: %w", err)
+	}
+	return &HybridPrivateKey{X25519: xPriv, MLKEM: dk}, nil
+}
+
+// Public returns the public half of the key pair.
+func (k *HybridPrivateKey) Public() *HybridPublicKey {
+	return &HybridPublicKey{X25519: k.X25519.PublicKey(), MLKEM: k.MLKEM.EncapsulationKey()}
+}
+
+// Bytes serialises the private key as X25519 scalar || ML-KEM seed.
+func (k *HybridPrivateKey) Bytes() []byte {
+	out := make([]byte, 0, hybridPrivateKeySize)
+	out = append(out, k.X25519.Bytes()...)
+	return append(out, k.MLKEM.Bytes()...)
+}
+
+// Bytes serialises the public key as X25519 point || ML-KEM encapsulation key.
+func (k *HybridPublicKey) Bytes() []byte {
+	out := make([]byte, 0, hybridPublicKeySize)
+	out = append(out, k.X25519.Bytes()...)
+	return append(out, k.MLKEM.Bytes()...)
+}
+
+// ParseHybridPrivateKey accepts raw bytes or their base64 encoding (the form
+// the "keygen" command writes and the web UI uploads).
+func ParseHybridPrivateKey(b []byte) (*HybridPrivateKey, error) {
+	raw := decodeKeyMaterial(b, hybridPrivateKeySize)
+	if len(raw) != hybridPrivateKeySize {
+		return nil, fmt.Errorf("hybrid private key must be %d bytes, got %d", hybridPrivateKeySize, len(raw))
+	}
+	xPriv, err := ecdh.X25519().NewPrivateKey(raw[:32])
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 private key: %w", err)
+	}
+	dk, err := mlkem.NewDecapsulationKey768(raw[32:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ML-KEM seed: %w", err)
+	}
+	return &HybridPrivateKey{X25519: xPriv, MLKEM: dk}, nil
+}
+
+// ParseHybridPublicKey accepts raw bytes or their base64 encoding.
+func ParseHybridPublicKey(b []byte) (*HybridPublicKey, error) {
+	raw := decodeKeyMaterial(b, hybridPublicKeySize)
+	if len(raw) != hybridPublicKeySize {
+		return nil, fmt.Errorf("hybrid public key must be %d bytes, got %d", hybridPublicKeySize, len(raw))
+	}
+	xPub, err := ecdh.X25519().NewPublicKey(raw[:32])
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 public key: %w", err)
+	}
+	ek, err := mlkem.NewEncapsulationKey768(raw[32:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ML-KEM encapsulation key: %w", err)
+	}
+	return &HybridPublicKey{X25519: xPub, MLKEM: ek}, nil
+}
+
+// decodeKeyMaterial returns b as-is when it already has the raw size,
+// otherwise tries standard base64 (whitespace-trimmed).
+func decodeKeyMaterial(b []byte, rawSize int) []byte {
+	if len(b) == rawSize {
+		return b
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return b
+	}
+	return decoded
+}
+
+// hybridKEK combines both shared secrets into a single 256-bit wrapping key.
+func hybridKEK(mlkemSecret, x25519Secret, mlkemCt, ephPub, recipientX25519 []byte) ([]byte, error) {
+	ikm := make([]byte, 0, len(mlkemSecret)+len(x25519Secret))
+	ikm = append(ikm, mlkemSecret...)
+	ikm = append(ikm, x25519Secret...)
+
+	var info bytes.Buffer
+	info.WriteString("ChronoVault " + kemSuite + " key wrap v1")
+	info.Write(mlkemCt)
+	info.Write(ephPub)
+	info.Write(recipientX25519)
+
+	return hkdf.Key(sha256.New, ikm, nil, info.String(), 32)
+}
+
+// WrapDataKey seals dataKey to pub. Each call uses a fresh encapsulation and
+// ephemeral X25519 key, so wrapping the same key twice yields unrelated output.
+func WrapDataKey(pub *HybridPublicKey, dataKey []byte) (*WrappedKey, error) {
+	mlkemSecret, mlkemCt := pub.MLKEM.Encapsulate()
+
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 ephemeral key generation failed: %w", err)
+	}
+	x25519Secret, err := eph.ECDH(pub.X25519)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 key agreement failed: %w", err)
+	}
+
+	ephPub := eph.PublicKey().Bytes()
+	kek, err := hybridKEK(mlkemSecret, x25519Secret, mlkemCt, ephPub, pub.X25519.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("KEK derivation failed: %w", err)
+	}
+
+	gcm, err := newKeyWrapGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("CSPRNG failure generating nonce: %w", err)
+	}
+
+	return &WrappedKey{
+		Suite:           kemSuite,
+		MLKEMCiphertext: mlkemCt,
+		X25519Ephemeral: ephPub,
+		Sealed:          gcm.Seal(nonce, nonce, dataKey, []byte(kemSuite)),
+	}, nil
+}
+
+// UnwrapDataKey recovers the data key from wk using priv.
+func UnwrapDataKey(priv *HybridPrivateKey, wk *WrappedKey) ([]byte, error) {
+	if wk.Suite != kemSuite {
+		return nil, fmt.Errorf("unsupported key-wrap suite: %q", wk.Suite)
+	}
+
+	mlkemSecret, err := priv.MLKEM.Decapsulate(wk.MLKEMCiphertext)
+	if err != nil {
+		return nil, fmt.Errorf("ML-KEM decapsulation failed: %w", err)
+	}
+	ephPub, err := ecdh.X25519().NewPublicKey(wk.X25519Ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X25519 ephemeral key: %w", err)
+	}
+	x25519Secret, err := priv.X25519.ECDH(ephPub)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 key agreement failed: %w", err)
+	}
+
+	kek, err := hybridKEK(mlkemSecret, x25519Secret, wk.MLKEMCiphertext, wk.X25519Ephemeral, priv.X25519.PublicKey().Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("KEK derivation failed: %w", err)
+	}
+
+	gcm, err := newKeyWrapGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wk.Sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is truncated")
+	}
+	nonce, sealed := wk.Sealed[:gcm.NonceSize()], wk.Sealed[gcm.NonceSize():]
+	dataKey, err := gcm.Open(nil, nonce, sealed, []byte(kemSuite))
+	if err != nil {
+		return nil, fmt.Errorf("key unwrap failed — wrong private key or tampered manifest")
+	}
+	return dataKey, nil
+}
+
+func newKeyWrapGCM(kek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key-wrap cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key-wrap GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// --- Manifest Encoding ---
+
+// ManifestHeaders renders the wrap as manifest comment lines. Older readers
+// skip any line starting with "#", so wrapped manifests stay parseable.
+func (wk *WrappedKey) ManifestHeaders() string {
+	enc := base64.StdEncoding
+	return manifestKeyWrapPrefix + wk.Suite + "\n" +
+		manifestKEMCtPrefix + enc.EncodeToString(wk.MLKEMCiphertext) + "\n" +
+		manifestKEMEphPrefix + enc.EncodeToString(wk.X25519Ephemeral) + "\n" +
+		manifestWrappedKeyPrefix + enc.EncodeToString(wk.Sealed) + "\n"
+}
+
+// insertManifestHeaders places extra header lines directly after the
+// "# Filename:" line so that every header precedes the CID list.
+func insertManifestHeaders(manifest, headers string) string {
+	first, rest, ok := strings.Cut(manifest, "\n")
+	if !ok {
+		return manifest + "\n" + headers
+	}
+	return first + "\n" + headers + rest
+}
+
+// ParseManifestKeyWrap extracts the key-wrap headers from a manifest.
+// It returns (nil, nil) for manifests that carry a plain (unwrapped) key.
+func ParseManifestKeyWrap(manifest string) (*WrappedKey, error) {
+	var wk WrappedKey
+	var haveCt, haveEph, haveSealed bool
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		var err error
+		switch {
+		case strings.HasPrefix(line, manifestKeyWrapPrefix):
+			wk.Suite = strings.TrimSpace(strings.TrimPrefix(line, manifestKeyWrapPrefix))
+		case strings.HasPrefix(line, manifestKEMCtPrefix):
+			wk.MLKEMCiphertext, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, manifestKEMCtPrefix))
+			haveCt = true
+		case strings.HasPrefix(line, manifestKEMEphPrefix):
+			wk.X25519Ephemeral, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, manifestKEMEphPrefix))
+			haveEph = true
+		case strings.HasPrefix(line, manifestWrappedKeyPrefix):
+			wk.Sealed, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, manifestWrappedKeyPrefix))
+			haveSealed = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed key-wrap header: %w", err)
+		}
+	}
+
+	if wk.Suite == "" {
+		if haveCt || haveEph || haveSealed {
+			return nil, fmt.Errorf("manifest has key-wrap fields but no Key-Wrap suite")
+		}
+		return nil, nil
+	}
+	if !haveCt || !haveEph || !haveSealed {
+		return nil, fmt.Errorf("manifest key-wrap headers are incomplete")
+	}
+	if len(wk.MLKEMCiphertext) != mlkem.CiphertextSize768 {
+		return nil, fmt.Errorf("ML-KEM ciphertext must be %d bytes, got %d", mlkem.CiphertextSize768, len(wk.MLKEMCiphertext))
+	}
+	return &wk, nil
+}
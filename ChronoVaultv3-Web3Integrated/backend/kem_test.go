@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The known-answer vectors are produced by the upload path (WrapDataKey +
+// ManifestHeaders, exactly what /upload emits) and checked with the CLI path
+// (unwrapManifestKey), so a passing run proves that a capsule written by the
+// server opens offline. `go test -run TestKEMVectors -update` rewrites them;
+// only do that for a deliberate format change.
+
+const kemVectorsFile = "testdata/kem_vectors.json"
+
+var updateKEMVectors = flag.Bool("update", false, "rewrite testdata/kem_vectors.json")
+
+type kemVector struct {
+	Comment    string `json:"comment"`
+	PrivateKey string `json:"private_key"` // base64, X25519 scalar || ML-KEM seed
+	PublicKey  string `json:"public_key"`  // base64, X25519 point || ML-KEM ek
+	DataKey    string `json:"data_key"`    // hex
+	Manifest   string `json:"manifest"`
+}
+
+type kemVectorFile struct {
+	Suite   string      `json:"suite"`
+	Vectors []kemVector `json:"vectors"`
+}
+
+func TestKEMVectors(t *testing.T) {
+	if *updateKEMVectors {
+		writeKEMVectors(t)
+	}
+	data, err := os.ReadFile(kemVectorsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vf kemVectorFile
+	if err := json.Unmarshal(data, &vf); err != nil {
+		t.Fatal(err)
+	}
+	if vf.Suite != kemSuite {
+		t.Fatalf("vector suite %q, want %q", vf.Suite, kemSuite)
+	}
+	if len(vf.Vectors) == 0 {
+		t.Fatal("no vectors")
+	}
+
+	for _, v := range vf.Vectors {
+		t.Run(v.Comment, func(t *testing.T) {
+			privBytes, err := base64.StdEncoding.DecodeString(v.PrivateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			priv, err := ParseHybridPrivateKey(privBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := base64.StdEncoding.EncodeToString(priv.Public().Bytes()); got != v.PublicKey {
+				t.Fatal("public key does not match private key")
+			}
+			want, err := hex.DecodeString(v.DataKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := unwrapManifestKey(v.Manifest, privBytes)
+			if err != nil {
+				t.Fatalf("unwrap: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatal("unwrapped key mismatch")
+			}
+
+			// A fresh wrap to the stored public key opens the same way.
+			pub, err := ParseHybridPublicKey([]byte(v.PublicKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rewrapped, err := WrapDataKey(pub, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = unwrapManifestKey(insertManifestHeaders("# Filename: x\n", rewrapped.ManifestHeaders()), privBytes)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Fatalf("round trip: %v", err)
+			}
+		})
+	}
+}
+
+func writeKEMVectors(t *testing.T) {
+	out := kemVectorFile{Suite: kemSuite}
+	for i, comment := range []string{"single-chunk vault", "multi-chunk vault", "all-zero data key"} {
+		priv := mustHybridKey(t)
+		dataKey := make([]byte, 32)
+		if i != 2 {
+			rand.Read(dataKey)
+		}
+		wrapped, err := WrapDataKey(priv.Public(), dataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest := fmt.Sprintf("# Filename: vector_%d.bin\n", i+1)
+		for c := 0; c <= i; c++ {
+			manifest += "Qm" + strings.Repeat(string("123456789"[c]), 44) + "\n" // placeholder CIDs; only the headers matter
+		}
+		out.Vectors = append(out.Vectors, kemVector{
+			Comment:    comment,
+			PrivateKey: base64.StdEncoding.EncodeToString(priv.Bytes()),
+			PublicKey:  base64.StdEncoding.EncodeToString(priv.Public().Bytes()),
+			DataKey:    hex.EncodeToString(dataKey),
+			Manifest:   insertManifestHeaders(manifest, wrapped.ManifestHeaders()),
+		})
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kemVectorsFile, append(data, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("wrote %d vectors to %s", len(out.Vectors), kemVectorsFile)
+}
+
+func mustHybridKey(t *testing.T) *HybridPrivateKey {
+	t.Helper()
+	priv, err := GenerateHybridKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func TestWrapDataKeyRoundTrip(t *testing.T) {
+	priv := mustHybridKey(t)
+	random := make([]byte, 32)
+	rand.Read(random)
+
+	tests := []struct {
+		name    string
+		dataKey []byte
+	}{
+		{"random 256-bit key", random},
+		{"all-zero key", make([]byte, 32)},
+		{"128-bit key", random[:16]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped, err := WrapDataKey(priv.Public(), tt.dataKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Through the manifest, as /upload writes it and /retrieve reads it.
+			parsed, err := ParseManifestKeyWrap(insertManifestHeaders("# Filename: f\nQmcid\n", wrapped.ManifestHeaders()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := UnwrapDataKey(priv, parsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.dataKey) {
+				t.Fatal("unwrapped key mismatch")
+			}
+		})
+	}
+}
+
+func TestWrapDataKeyIsRandomized(t *testing.T) {
+	priv := mustHybridKey(t)
+	key := make([]byte, 32)
+	a, err := WrapDataKey(priv.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := WrapDataKey(priv.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a.MLKEMCiphertext, b.MLKEMCiphertext) || bytes.Equal(a.X25519Ephemeral, b.X25519Ephemeral) ||
+		bytes.Equal(a.Sealed, b.Sealed) {
+		t.Fatal("two wraps of the same key share a component")
+	}
+}
+
+func TestUnwrapDataKeyRejectsTampering(t *testing.T) {
+	priv := mustHybridKey(t)
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	tests := []struct {
+		name   string
+		tamper func(wk *WrappedKey)
+	}{
+		{"ML-KEM ciphertext", func(wk *WrappedKey) { wk.MLKEMCiphertext[0] ^= 1 }},
+		{"X25519 ephemeral", func(wk *WrappedKey) { wk.X25519Ephemeral[0] ^= 1 }},
+		{"nonce", func(wk *WrappedKey) { wk.Sealed[0] ^= 1 }},
+		{"sealed key", func(wk *WrappedKey) { wk.Sealed[len(wk.Sealed)/2] ^= 1 }},
+		{"GCM tag", func(wk *WrappedKey) { wk.Sealed[len(wk.Sealed)-1] ^= 1 }},
+		{"truncated", func(wk *WrappedKey) { wk.Sealed = wk.Sealed[:8] }},
+		{"suite", func(wk *WrappedKey) { wk.Suite = "X25519-MLKEM1024" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped, err := WrapDataKey(priv.Public(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(wrapped)
+			if got, err := UnwrapDataKey(priv, wrapped); err == nil {
+				t.Fatalf("tampered wrap opened to %x", got)
+			}
+		})
+	}
+}
+
+func TestUnwrapDataKeyWrongKey(t *testing.T) {
+	priv, other := mustHybridKey(t), mustHybridKey(t)
+	wrapped, err := WrapDataKey(priv.Public(), make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  *HybridPrivateKey
+	}{
+		{"other key pair", other},
+		{"right X25519, wrong ML-KEM", &HybridPrivateKey{X25519: priv.X25519, MLKEM: other.MLKEM}},
+		{"right ML-KEM, wrong X25519", &HybridPrivateKey{X25519: other.X25519, MLKEM: priv.MLKEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := UnwrapDataKey(tt.key, wrapped); err == nil {
+				t.Fatal("wrap opened with the wrong private key")
+			}
+		})
+	}
+}
+
+func TestParseManifestKeyWrap(t *testing.T) {
+	priv := mustHybridKey(t)
+	wrapped, err := WrapDataKey(priv.Public(), make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := wrapped.ManifestHeaders()
+	without := func(prefix string) string {
+		var kept []string
+		for _, line := range strings.SplitAfter(headers, "\n") {
+			if !strings.HasPrefix(line, prefix) {
+				kept = append(kept, line)
+			}
+		}
+		return strings.Join(kept, "")
+	}
+
+	tests := []struct {
+		name     string
+		headers  string
+		wantWrap bool
+		wantErr  bool
+	}{
+		{"plain manifest", "", false, false},
+		{"wrapped manifest", headers, true, false},
+		{"no suite", without(manifestKeyWrapPrefix), false, true},
+		{"no ciphertext", without(manifestKEMCtPrefix), false, true},
+		{"no ephemeral", without(manifestKEMEphPrefix), false, true},
+		{"no wrapped key", without(manifestWrappedKeyPrefix), false, true},
+		{"bad base64", without(manifestWrappedKeyPrefix) + manifestWrappedKeyPrefix + "!!!\n", false, true},
+		{"short ciphertext", without(manifestKEMCtPrefix) + manifestKEMCtPrefix + "AAAA\n", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wk, err := ParseManifestKeyWrap(insertManifestHeaders("# Filename: f\nQmcid\n", tt.headers))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if (wk != nil) != tt.wantWrap {
+				t.Fatalf("wrap = %v, want %v", wk != nil, tt.wantWrap)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// --- Server Key Provider ---
+//
+// Every operation that needs server-held secret key material goes through a
+// KeyProvider, so handlers never touch the raw keys. Two providers exist:
+//
+//	KEY_PROVIDER=env     keys are read from the environment / .env (default)
+//	KEY_PROVIDER=pkcs11  keys live on a PKCS#11 token (SoftHSM, YubiHSM,
+//	                     cloud HSM); only ciphertexts and signatures leave it.
+//
+// The PKCS#11 provider needs cgo and is compiled in with `-tags pkcs11`.
+
+// KeyProvider wraps data keys under the server's key-encryption key and signs
+// manifests with the server's manifest-signing key.
+type KeyProvider interface {
+	Name() string
+	// WrapKey seals a data key under the KEK (nonce || AES-256-GCM output).
+	WrapKey(dataKey []byte) ([]byte, error)
+	// UnwrapKey reverses WrapKey.
+	UnwrapKey(wrapped []byte) ([]byte, error)
+	// SignManifest returns a raw r||s ECDSA P-256 signature over SHA-256(data).
+	SignManifest(data []byte) ([]byte, error)
+	// VerifyManifest checks a signature produced by SignManifest.
+	VerifyManifest(data, sig []byte) error
+	Close() error
+}
+
+// errKeyUnavailable is returned when the provider has no key for an operation.
+var errKeyUnavailable = errors.New("key not configured")
+
+var keyProvider KeyProvider = &envKeyProvider{}
+
+// kekAAD binds wrapped keys to their purpose so a wrapped data key cannot be
+// replayed as some other ciphertext under the same KEK.
+var kekAAD = []byte("ChronoVault data key v1")
+
+func initKeyProvider() {
+	var (
+		kp  KeyProvider
+		err error
+	)
+	switch name := strings.ToLower(cfg.KeyProvider); name {
+	case "", "env":
+		kp, err = newEnvKeyProvider()
+	case "pkcs11":
+		kp, err = newPKCS11KeyProvider()
+	default:
+		err = fmt.Errorf("unknown KEY_PROVIDER %q (expected env or pkcs11)", name)
+	}
+	// Fail closed: running on without the configured keys would issue
+	// unsigned manifests and refuse every escrow. Only an env provider with
+	// no keys set runs keyless, and that is not an error.
+	if err != nil {
+		fmt.Printf("⚠️  FATAL: key provider unavailable: %v\n", err)
+		os.Exit(1)
+	}
+	keyProvider = kp
+	fmt.Printf("🔑 Key provider: %s\n", kp.Name())
+}
+
+// --- Environment Provider ---
+
+type envKeyProvider struct {
+	kek     []byte
+	signKey *ecdsa.PrivateKey
+}
+
+func newEnvKeyProvider() (*envKeyProvider, error) {
+	p := &envKeyProvider{}
+
+	if v := strings.TrimSpace(cfg.VaultKEK); v != "" {
+		kek, err := hex.DecodeString(v)
+		if err != nil || len(kek) != 32 {
+			return nil, fmt.Errorf("VAULT_KEK must be 32 hex-encoded bytes")
+		}
+		p.kek = kek
+	}
+
+	if v := strings.TrimSpace(cfg.ManifestSigningKey); v != "" {
+		d, err := hex.DecodeString(v)
+		if err != nil || len(d) != 32 {
+			return nil, fmt.Errorf("MANIFEST_SIGNING_KEY must be a 32-byte hex P-256 scalar")
+		}
+		curve := elliptic.P256()
+		k := new(big.Int).SetBytes(d)
+		if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+			return nil, fmt.Errorf("MANIFEST_SIGNING_KEY is out of range for P-256")
+		}
+		priv := &ecdsa.PrivateKey{D: k}
+		priv.PublicKey.Curve = curve
+		priv.PublicKey.X, priv.PublicKey.Y = curve.ScalarBaseMult(d)
+		p.signKey = priv
+	}
+
+	return p, nil
+}
+
+func (p *envKeyProvider) Name() string { return "env" }
+
+func (p *envKeyProvider) WrapKey(dataKey []byte) ([]byte, error) {
+	if p.kek == nil {
+		return nil, fmt.Errorf("VAULT_KEK: %w", errKeyUnavailable)
+	}
+	gcm, err := newKEKGCM(p.kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("CSPRNG failure generating nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, dataKey, kekAAD), nil
+}
+
+func (p *envKeyProvider) UnwrapKey(wrapped []byte) ([]byte, error) {
+	if p.kek == nil {
+		return nil, fmt.Errorf("VAULT_KEK: %w", errKeyUnavailable)
+	}
+	gcm, err := newKEKGCM(p.kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is truncated")
+	}
+	nonce, sealed := wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():]
+	dataKey, err := gcm.Open(nil, nonce, sealed, kekAAD)
+	if err != nil {
+		return nil, fmt.Errorf("key unwrap failed — wrong KEK or corrupted escrow")
+	}
+	return dataKey, nil
+}
+
+func (p *envKeyProvider) SignManifest(data []byte) ([]byte, error) {
+	if p.signKey == nil {
+		return nil, fmt.Errorf("MANIFEST_SIGNING_KEY: %w", errKeyUnavailable)
+	}
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, p.signKey, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("manifest signing failed: %w", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+func (p *envKeyProvider) VerifyManifest(data, sig []byte) error {
+	if p.signKey == nil {
+		return fmt.Errorf("MANIFEST_SIGNING_KEY: %w", errKeyUnavailable)
+	}
+	if len(sig) != 64 {
+		return fmt.Errorf("invalid manifest signature length: %d", len(sig))
+	}
+	digest := sha256.Sum256(data)
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(&p.signKey.PublicKey, digest[:], r, s) {
+		return fmt.Errorf("invalid manifest signature")
+	}
+	return nil
+}
+
+func (p *envKeyProvider) Close() error { return nil }
+
+func newKEKGCM(kek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KEK cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KEK GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// --- Manifest Signatures ---
+//
+// The server signs every manifest it issues so that /retrieve can tell a
+// manifest it produced from one that was edited or forged. The signature is
+// a "# Signature:" header over the canonical manifest (every other non-empty
+// line, whitespace-trimmed, joined with "\n"), so CRLF conversions by a
+// browser download don't invalidate it.
+
+const manifestSignaturePrefix = "# Signature: ES256 "
+
+func canonicalManifest(manifest string) []byte {
+	var lines []string
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, manifestSignaturePrefix) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// signManifest appends a signature header. When no signing key is
+// configured the manifest is returned unsigned.
+func signManifest(manifest string) (string, error) {
+	sig, err := keyProvider.SignManifest(canonicalManifest(manifest))
+	if errors.Is(err, errKeyUnavailable) {
+		return manifest, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(manifest, "\n") {
+		manifest += "\n"
+	}
+	return manifest + manifestSignaturePrefix + base64.StdEncoding.EncodeToString(sig) + "\n", nil
+}
+
+// isSignedManifest reports whether the manifest carries a signature header,
+// without verifying it.
+func isSignedManifest(manifest string) bool {
+	for _, line := range strings.Split(manifest, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), manifestSignaturePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyManifestSignature reports whether the manifest was signed and, if
+// so, whether the signature is valid. Unsigned manifests predate signing and
+// are accepted unless REQUIRE_SIGNED_MANIFESTS=true.
+func verifyManifestSignature(manifest string) (signed bool, err error) {
+	var sigB64 string
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, manifestSignaturePrefix) {
+			if sigB64 != "" {
+				return true, fmt.Errorf("manifest carries more than one signature")
+			}
+			sigB64 = strings.TrimPrefix(line, manifestSignaturePrefix)
+		}
+	}
+	if sigB64 == "" {
+		if cfg.RequireSignedManifests {
+			return false, fmt.Errorf("manifest is not signed")
+		}
+		return false, nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		return true, fmt.Errorf("malformed manifest signature")
+	}
+	return true, keyProvider.VerifyManifest(canonicalManifest(manifest), sig)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// --- SMTP Mail ---
+//
+// Email goes out through an SMTP relay, configured with:
+//
+//	SMTP_HOST       relay host; email is disabled when unset
+//	SMTP_PORT       default 587 (MailHog listens on 1025)
+//	SMTP_USERNAME   optional; PLAIN auth, which net/smtp only allows over
+//	SMTP_PASSWORD   TLS or to localhost
+//	SMTP_FROM       envelope and header sender (default chronovault@<host>)
+//	SMTP_TLS        "starttls" (default: use it when offered), "tls" for
+//	                implicit TLS (port 465), or "none"
+//
+// When a relay is configured, notifications (notify.go) addressed to email
+// addresses are mailed as well, and scheduled deliveries (delivery.go)
+// become available.
+
+const smtpTimeout = 30 * time.Second
+
+type smtpMailer struct {
+	host, port         string
+	username, password string
+	from               string
+	tlsMode            string
+}
+
+var mailer *smtpMailer
+
+func initMailer() {
+	host := cfg.SMTPHost
+	if host == "" {
+		fmt.Println("✉️  Email: disabled (set SMTP_HOST to enable)")
+		return
+	}
+	m := &smtpMailer{
+		host:     host,
+		port:     cfg.SMTPPort,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword,
+		from:     cfg.SMTPFrom,
+		tlsMode:  strings.ToLower(cfg.SMTPTLS),
+	}
+	if m.from == "" {
+		m.from = "chronovault@" + host
+	}
+	if _, err := mail.ParseAddress(m.from); err != nil {
+		fmt.Printf("⚠️  SMTP_FROM %q is not a valid address — email disabled.\n", m.from)
+		return
+	}
+	mailer = m
+	fmt.Printf("✉️  Email: SMTP relay %s:%s (tls=%s)\n", m.host, m.port, m.tlsMode)
+}
+
+// validEmail reports whether s is a bare email address.
+func validEmail(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s
+}
+
+// Send mails a plain-text message to one address, so recipients never see
+// each other. Once the relay has accepted the message, a failed QUIT is only
+// logged: the message is on its way and sending it again would duplicate it.
+func (m *smtpMailer) Send(to, subject, body string) error {
+	if !validEmail(to) {
+		return fmt.Errorf("invalid recipient %q", to)
+	}
+
+	addr := net.JoinHostPort(m.host, m.port)
+	var conn net.Conn
+	var err error
+	if m.tlsMode == "tls" {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: smtpTimeout}, "tcp", addr, &tls.Config{ServerName: m.host})
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, smtpTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("SMTP connect: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake: %w", err)
+	}
+	defer c.Close()
+
+	if m.tlsMode == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+				return fmt.Errorf("SMTP STARTTLS: %w", err)
+			}
+		}
+	}
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("SMTP auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.from); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM: %w", err)
+	}
+	if err := c.Rcpt(to); err != nil {
+		return fmt.Errorf("SMTP RCPT TO %s: %w", to, err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	if _, err := wc.Write(m.message(to, subject, body)); err != nil {
+		wc.Close()
+		return fmt.Errorf("SMTP write: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("SMTP DATA: %w", err)
+	}
+	if err := c.Quit(); err != nil {
+		fmt.Printf("[Mail] QUIT after accepted message to %s failed: %v\n", to, err)
+	}
+	return nil
+}
+
+// message renders the RFC 5322 message. Header values are single-line by
+// construction: addresses are validated and the subject is Q-encoded with
+// line breaks removed.
+func (m *smtpMailer) message(to, subject, body string) []byte {
+	id := make([]byte, 12)
+	rand.Read(id)
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: ChronoVault <%s>\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), m.host)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// mailNotifier mails notifications to their email recipients, one message
+// each, after passing them on to the next notifier.
+type mailNotifier struct {
+	next Notifier
+}
+
+func (mn mailNotifier) Notify(n Notification) error {
+	err := mn.next.Notify(n)
+	for _, r := range n.To {
+		if !validEmail(r) {
+			continue
+		}
+		if mailErr := mailer.Send(r, n.Subject, n.Body); mailErr != nil {
+			err = errors.Join(err, fmt.Errorf("email delivery to %s failed: %w", r, mailErr))
+		}
+	}
+	return err
+}
@@ -1,18 +1,17 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"os"
 )
 
-// --- Shared Configuration & Structs ---
-
-const (
-	ChunkSize   = 256 * 1024 // 256KB chunks
-	StoreFolder = "shredded_store"
-)
+// --- Shared Structs ---
+//
+// Settings such as the chunk size and the store folder live in cfg
+// (see config.go).
 
 // MerkleNode is used by both encrypt and decrypt
 type MerkleNode struct {
@@ -23,12 +22,42 @@ type MerkleNode struct {
 // --- Main Entry Point ---
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "server" || os.Args[1] == "web") {
-		startServer()
+	args := initConfig(os.Args[1:], printUsage)
+	if len(args) == 0 {
+		runSimulation()
 		return
 	}
 
-	runSimulation()
+	var err error
+	switch args[0] {
+	case "server", "web":
+		startServer()
+		return
+	case "config":
+		printConfig(os.Stdout)
+	case "keygen":
+		err = runKeygen(args[1:])
+	case "unwrap":
+		err = runUnwrap(args[1:])
+	case "openapi":
+		err = runOpenAPI(args[1:])
+	case "audit-verify":
+		err = runAuditVerify(args[1:])
+	case "solve-puzzle":
+		err = runSolvePuzzle(args[1:])
+	case "puzzle-bench":
+		err = runPuzzleBench(args[1:])
+	case "help", "-h", "--help":
+		printUsage()
+	default:
+		fmt.Printf("Unknown command: %s\n\n", args[0])
+		printUsage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 func runSimulation() {
@@ -36,8 +65,8 @@ func runSimulation() {
 	inputFile := "original.txt"
 
 	// 1. Prepare Environment
-	os.RemoveAll(StoreFolder)
-	os.Mkdir(StoreFolder, 0755)
+	os.RemoveAll(cfg.StoreFolder)
+	os.Mkdir(cfg.StoreFolder, 0755)
 
 	// Create a dummy file if it doesn't exist
 	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
@@ -53,7 +82,9 @@ func runSimulation() {
 	Check(err)
 
 	// 3. Trigger Encryption Pipeline (defined in encrypt.go)
-	EncryptAndStore(originalData, inputFile)
+	_, _, _, key, err := EncryptAndStore(context.Background(), originalData, inputFile, nil)
+	Check(err)
+	key.Destroy()
 
 	fmt.Println("\n------------------------------------------------")
 	fmt.Println("   (Network Simulation: Transferring files...)")
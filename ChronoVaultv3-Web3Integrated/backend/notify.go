@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// --- Notifications ---
+//
+// Background jobs (dead man's switch reminders, releases) need to reach
+// people who are not currently making a request. A Notifier delivers a
+// Notification; which one is used depends on NOTIFY_WEBHOOK_URL:
+//
+//	unset   log to stdout only
+//	set     POST the notification as JSON to the webhook (and log it)
+//
+// Recipients are Supabase user IDs or email addresses, whichever the vault
+// owner supplied; the webhook consumer resolves them.
+
+// Notification is one message to one or more recipients.
+type Notification struct {
+	Kind    string    `json:"kind"` // e.g. "deadman.reminder", "deadman.released"
+	VaultID string    `json:"vault_id"`
+	To      []string  `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Notifier delivers notifications.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+var notifier Notifier = logNotifier{}
+
+func initNotifier() {
+	if url := cfg.NotifyWebhookURL; url != "" {
+		notifier = &webhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+		fmt.Printf("📣 Notifications: webhook %s\n", url)
+	} else {
+		notifier = logNotifier{}
+		fmt.Println("📣 Notifications: log only (set NOTIFY_WEBHOOK_URL to deliver)")
+	}
+	if mailer != nil {
+		notifier = mailNotifier{next: notifier}
+		fmt.Println("📣 Notifications: also emailed to address recipients")
+	}
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(n Notification) error {
+	fmt.Printf("[Notify] %s vault=%s to=%v: %s\n", n.Kind, n.VaultID, n.To, n.Subject)
+	return nil
+}
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (wn *webhookNotifier) Notify(n Notification) error {
+	logNotifier{}.Notify(n)
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := wn.client.Post(wn.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
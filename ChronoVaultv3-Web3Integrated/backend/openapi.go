@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- OpenAPI Document ---
+//
+// The OpenAPI 3.0 document for the v1 API is generated from v1Routes (api.go).
+// Response schemas come from the Go response types by reflection, following
+// their json tags. The server serves the live document at /v1/openapi.json. A
+// copy is committed as openapi.json for client generators. `chronovault
+// openapi` fails when that copy is out of date, and `-generate` rewrites it.
+
+const (
+	apiVersion         = "1.0.0"
+	defaultOpenAPIFile = "openapi.json"
+)
+
+var pathParam = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+type obj = map[string]interface{}
+
+// openAPIDocument builds the document.
+func openAPIDocument() obj {
+	schemas := obj{}
+	paths := obj{}
+	for _, rt := range v1Routes {
+		op := obj{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+			"responses":   openAPIResponses(rt, schemas),
+		}
+		if rt.public {
+			op["security"] = []interface{}{}
+		}
+
+		var params []interface{}
+		for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+			params = append(params, obj{"name": m[1], "in": "path", "required": true, "schema": obj{"type": "string"}})
+		}
+		for _, q := range rt.query {
+			params = append(params, obj{"name": q.name, "in": "query", "description": q.desc, "schema": paramSchema(q.typ)})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if rt.form != nil {
+			props := obj{}
+			var required []string
+			for _, f := range rt.form {
+				s := paramSchema(f.typ)
+				s["description"] = f.desc
+				props[f.name] = s
+				if f.required {
+					required = append(required, f.name)
+				}
+			}
+			form := obj{"type": "object", "properties": props}
+			if required != nil {
+				form["required"] = required
+			}
+			op["requestBody"] = obj{
+				"required": true,
+				"content":  obj{"multipart/form-data": obj{"schema": form}},
+			}
+		}
+
+		item, _ := paths[rt.path].(obj)
+		if item == nil {
+			item = obj{}
+			paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = op
+	}
+	return obj{
+		"openapi": "3.0.3",
+		"info": obj{
+			"title":       "ChronoVault API",
+			"version":     apiVersion,
+			"description": "Time-locked, IPFS-backed vaults. Authenticate with a Supabase access token as a Bearer token.",
+		},
+		"servers":  []interface{}{obj{"url": "http://localhost:8080"}},
+		"security": []interface{}{obj{"bearerAuth": []interface{}{}}},
+		"paths":    paths,
+		"components": obj{
+			"schemas": schemas,
+			"securitySchemes": obj{
+				"bearerAuth": obj{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+}
+
+// operationID derives a stable name: GET /v1/vaults/{id}/manifest is
+// getVaultsIdManifest.
+func operationID(rt apiRoute) string {
+	id := strings.ToLower(rt.method)
+	words := strings.FieldsFunc(strings.TrimPrefix(rt.path, "/v1/"), func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9')
+	})
+	for _, w := range words {
+		id += strings.ToUpper(w[:1]) + w[1:]
+	}
+	return id
+}
+
+func openAPIResponses(rt apiRoute, schemas obj) obj {
+	resp := obj{"description": http.StatusText(rt.status)}
+	switch v := rt.response.(type) {
+	case string:
+		mediaType := rt.mediaType
+		if mediaType == "" {
+			mediaType = "text/plain"
+		}
+		resp["content"] = obj{mediaType: obj{"schema": obj{"type": "string"}}}
+	case nil:
+	default:
+		resp["content"] = obj{"application/json": obj{"schema": schemaFor(reflect.TypeOf(v), schemas)}}
+	}
+	out := obj{strconv.Itoa(rt.status): resp}
+	for _, code := range rt.errors {
+		out[strconv.Itoa(code)] = obj{
+			"description": http.StatusText(code),
+			"content":     obj{"application/json": obj{"schema": schemaFor(reflect.TypeOf(apiError{}), schemas)}},
+		}
+	}
+	return out
+}
+
+func paramSchema(typ string) obj {
+	if typ == "binary" {
+		return obj{"type": "string", "format": "binary"}
+	}
+	return obj{"type": typ}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of t. Named structs are added to schemas and
+// referenced.
+func schemaFor(t reflect.Type, schemas obj) obj {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return obj{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return obj{}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return obj{"type": "string"}
+	case reflect.Bool:
+		return obj{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return obj{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return obj{"type": "number"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return obj{"type": "string", "format": "byte"}
+		}
+		return obj{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return obj{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Interface:
+		return obj{}
+	case reflect.Struct:
+		name := t.Name()
+		name = strings.ToUpper(name[:1]) + name[1:]
+		ref := obj{"$ref": "#/components/schemas/" + name}
+		if _, ok := schemas[name]; ok {
+			return ref
+		}
+		schemas[name] = obj{} // placeholder, for recursive types
+		props := obj{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			fieldName, opts, _ := strings.Cut(tag, ",")
+			if fieldName == "" {
+				fieldName = f.Name
+			}
+			props[fieldName] = schemaFor(f.Type, schemas)
+			if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+				required = append(required, fieldName)
+			}
+		}
+		s := obj{"type": "object", "properties": props}
+		if required != nil {
+			sort.Strings(required)
+			s["required"] = required
+		}
+		schemas[name] = s
+		return ref
+	}
+	return obj{}
+}
+
+// openAPIJSON renders the document with stable formatting.
+func openAPIJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(openAPIDocument(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// The document route is added here rather than in v1Routes' initializer,
+// which would make v1Routes depend on itself.
+func init() {
+	v1Routes = append(v1Routes, apiRoute{
+		method: http.MethodGet, path: "/v1/openapi.json", handler: openAPIHandler, public: true,
+		summary: "This document",
+		status:  http.StatusOK, response: map[string]interface{}{},
+	})
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := openAPIJSON()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to render OpenAPI document")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// runOpenAPI checks (or with -generate, rewrites) the committed document.
+func runOpenAPI(args []string) error {
+	generate := false
+	path := defaultOpenAPIFile
+	for _, a := range args {
+		if a == "-generate" {
+			generate = true
+		} else {
+			path = a
+		}
+	}
+	data, err := openAPIJSON()
+	if err != nil {
+		return err
+	}
+	if generate {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to write OpenAPI document: %w", err)
+		}
+		fmt.Printf("[OpenAPI] Wrote %s (%d operations)\n", path, len(v1Routes))
+		return nil
+	}
+	have, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read OpenAPI document: %w", err)
+	}
+	if !bytes.Equal(have, data) {
+		return fmt.Errorf("%s does not match the handlers; run `chronovault openapi -generate`", path)
+	}
+	fmt.Printf("[OpenAPI] %s matches the handlers (%d operations).\n", path, len(v1Routes))
+	return nil
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Unlock Policies ---
+//
+// Every condition that gates the release of an escrowed key is a node in one
+// policy tree, and checkUnlockPolicy is the single gate that /retrieve and
+// /vault/release pass through. The tree is built from:
+//
+//   - the lock fields set at upload (unlock_at, schedule, geofence,
+//     chain_after, approvers, one_time), each becoming a leaf
+//   - an optional declarative policy uploaded as JSON in the policy field
+//
+// All of them are ANDed together. The policy language:
+//
+//	{"all": [ ... ]}              every child passes
+//	{"any": [ ... ]}              at least one child passes
+//	{"not": { ... }}              the child fails
+//	{"time": {"not_before": "2030-01-01T00:00:00Z", "not_after": "..."}}
+//	{"schedule": {"cron": "0 0 14 2 *", "window": "24h", "tz": "..."}}
+//	                              recurring windows (schedule.go)
+//	{"geofence": <circle or GeoJSON, as for the geofence field>}
+//	{"biometric": "facial"}       or "emotional"; see below
+//	{"approvals": {"min": 2}}     valid approvals (approval.go); min
+//	                              defaults to the vault's threshold
+//	{"one_time": true}            burn after read (burn.go)
+//
+// A biometric leaf passes when the requesting user completed that AI check
+// for this vault, by calling /api/trigger-facial-auth or
+// /api/trigger-emotional-auth with its vault_id, within biometricFactorTTL.
+//
+// Leaves are three-valued. A leaf that cannot be decided (time source down,
+// no location evidence) is "unknown". NOT of unknown is unknown, so missing
+// evidence can never satisfy a negated condition. Evaluation returns a tree
+// of results mirroring the policy: kind, result, detail and a machine code
+// on each node. It is sent back whenever the gate refuses.
+
+const (
+	biometricFactorTTL = 10 * time.Minute
+	maxPolicyNodes     = 64
+	maxPolicyDepth     = 8
+)
+
+// PolicyNode is one node of an unlock policy. Exactly one field is set.
+type PolicyNode struct {
+	All       []*PolicyNode    `json:"all,omitempty"`
+	Any       []*PolicyNode    `json:"any,omitempty"`
+	Not       *PolicyNode      `json:"not,omitempty"`
+	Time      *PolicyTime      `json:"time,omitempty"`
+	Schedule  *UnlockSchedule  `json:"schedule,omitempty"`
+	GeoFence  json.RawMessage  `json:"geofence,omitempty"`
+	Biometric string           `json:"biometric,omitempty"`
+	Approvals *PolicyApprovals `json:"approvals,omitempty"`
+	OneTime   bool             `json:"one_time,omitempty"`
+
+	// Compiled or built from the vault record; never read from JSON.
+	notBefore, notAfter *time.Time
+	schedule            *compiledSchedule
+	fence               *GeoFence
+	chain               bool
+}
+
+// PolicyTime is a time window; either bound may be omitted.
+type PolicyTime struct {
+	NotBefore string `json:"not_before,omitempty"`
+	NotAfter  string `json:"not_after,omitempty"`
+}
+
+// PolicyApprovals requires Min valid approvals.
+type PolicyApprovals struct {
+	Min int `json:"min,omitempty"`
+}
+
+func (n *PolicyNode) kind() string {
+	switch {
+	case n.All != nil:
+		return "all"
+	case n.Any != nil:
+		return "any"
+	case n.Not != nil:
+		return "not"
+	case n.Time != nil || n.notBefore != nil || n.notAfter != nil:
+		return "time"
+	case n.Schedule != nil:
+		return "schedule"
+	case n.GeoFence != nil || n.fence != nil:
+		return "geofence"
+	case n.Biometric != "":
+		return "biometric"
+	case n.Approvals != nil:
+		return "approvals"
+	case n.OneTime:
+		return "one_time"
+	case n.chain:
+		return "chain"
+	}
+	return ""
+}
+
+// compilePolicy parses and validates an uploaded policy.
+func compilePolicy(raw []byte) (*PolicyNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	var root PolicyNode
+	if err := dec.Decode(&root); err != nil {
+		return nil, fmt.Errorf("policy is not valid: %w", err)
+	}
+	count := 0
+	if err := root.compile(0, true, &count); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// compile validates n. positive is false under any/not, where one_time would
+// be meaningless: burning is a side effect, not a condition.
+func (n *PolicyNode) compile(depth int, positive bool, count *int) error {
+	*count++
+	if *count > maxPolicyNodes || depth > maxPolicyDepth {
+		return fmt.Errorf("policy is limited to %d nodes and depth %d", maxPolicyNodes, maxPolicyDepth)
+	}
+	set := 0
+	for _, b := range []bool{n.All != nil, n.Any != nil, n.Not != nil, n.Time != nil, n.Schedule != nil, n.GeoFence != nil,
+		n.Biometric != "", n.Approvals != nil, n.OneTime} {
+		if b {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("each policy node must have exactly one of all, any, not, time, schedule, geofence, biometric, approvals, one_time")
+	}
+
+	switch n.kind() {
+	case "all", "any":
+		children := n.All
+		if n.Any != nil {
+			children, positive = n.Any, false
+		}
+		if len(children) == 0 {
+			return fmt.Errorf("policy %s needs at least one child", n.kind())
+		}
+		for _, c := range children {
+			if c == nil {
+				return fmt.Errorf("policy node is empty")
+			}
+			if err := c.compile(depth+1, positive, count); err != nil {
+				return err
+			}
+		}
+	case "not":
+		return n.Not.compile(depth+1, false, count)
+	case "time":
+		var err error
+		if n.Time.NotBefore != "" {
+			if n.notBefore, err = parsePolicyTime(n.Time.NotBefore); err != nil {
+				return err
+			}
+		}
+		if n.Time.NotAfter != "" {
+			if n.notAfter, err = parsePolicyTime(n.Time.NotAfter); err != nil {
+				return err
+			}
+		}
+		if n.notBefore == nil && n.notAfter == nil {
+			return fmt.Errorf("policy time needs not_before or not_after")
+		}
+		if n.notBefore != nil && n.notAfter != nil && !n.notAfter.After(*n.notBefore) {
+			return fmt.Errorf("policy time window is empty")
+		}
+	case "schedule":
+		c, err := n.Schedule.compile()
+		if err != nil {
+			return err
+		}
+		n.schedule = c
+	case "geofence":
+		fence, err := parseGeoFence(string(n.GeoFence))
+		if err != nil {
+			return fmt.Errorf("policy geofence: %w", err)
+		}
+		n.fence = fence
+	case "biometric":
+		if n.Biometric != "facial" && n.Biometric != "emotional" {
+			return fmt.Errorf("policy biometric must be \"facial\" or \"emotional\"")
+		}
+	case "approvals":
+		if n.Approvals.Min < 0 || n.Approvals.Min > 20 {
+			return fmt.Errorf("policy approvals min must be at most 20")
+		}
+	case "one_time":
+		if !positive {
+			return fmt.Errorf("policy one_time may only appear under all")
+		}
+	}
+	return nil
+}
+
+func parsePolicyTime(v string) (*time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		secs, convErr := strconv.ParseInt(v, 10, 64)
+		if convErr != nil {
+			return nil, fmt.Errorf("policy times must be RFC 3339 or Unix seconds")
+		}
+		t = time.Unix(secs, 0)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// walk calls fn on n and every node below it.
+func (n *PolicyNode) walk(fn func(*PolicyNode)) {
+	fn(n)
+	for _, c := range append(append([]*PolicyNode(nil), n.All...), n.Any...) {
+		c.walk(fn)
+	}
+	if n.Not != nil {
+		n.Not.walk(fn)
+	}
+}
+
+// requires reports whether any node in the tree is of the given kind.
+func (n *PolicyNode) requires(kind string) bool {
+	found := false
+	n.walk(func(c *PolicyNode) {
+		if c.kind() == kind {
+			found = true
+		}
+	})
+	return found
+}
+
+// effectivePolicy combines rec's lock fields and uploaded policy into one
+// tree, or returns nil when nothing gates the vault.
+func effectivePolicy(rec *VaultRecord) (*PolicyNode, error) {
+	var nodes []*PolicyNode
+	if rec.UnlockAt != nil {
+		nodes = append(nodes, &PolicyNode{notBefore: rec.UnlockAt})
+	}
+	if rec.Schedule != nil {
+		c, err := rec.Schedule.compile()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, &PolicyNode{Schedule: rec.Schedule, schedule: c})
+	}
+	if rec.GeoFence != nil {
+		nodes = append(nodes, &PolicyNode{fence: rec.GeoFence})
+	}
+	if rec.Chain != nil {
+		nodes = append(nodes, &PolicyNode{chain: true})
+	}
+	if rec.Approval != nil {
+		nodes = append(nodes, &PolicyNode{Approvals: &PolicyApprovals{}})
+	}
+	if rec.OneTime {
+		nodes = append(nodes, &PolicyNode{OneTime: true})
+	}
+	if rec.Policy != nil {
+		p, err := compilePolicy(rec.Policy)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, p)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	}
+	return &PolicyNode{All: nodes}, nil
+}
+
+// --- Evaluation ---
+
+const (
+	policyPass    = "pass"
+	policyFail    = "fail"
+	policyUnknown = "unknown"
+)
+
+// PolicyResult is one node of the explanation tree.
+type PolicyResult struct {
+	Kind     string          `json:"kind"`
+	Result   string          `json:"result"`
+	Detail   string          `json:"detail,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Children []*PolicyResult `json:"children,omitempty"`
+
+	// How a refusal on this leaf is reported when it is the deciding one.
+	status     int
+	message    string
+	fields     map[string]interface{}
+	retryAfter int64
+}
+
+func (res *PolicyResult) passed() bool { return res.Result == policyPass }
+
+// policyEnv is the context of one evaluation. The trusted time is fetched
+// once so every leaf sees the same instant.
+type policyEnv struct {
+	r      *http.Request
+	rec    *VaultRecord
+	userID string
+	now    time.Time
+	nowErr error
+}
+
+func newPolicyEnv(r *http.Request, rec *VaultRecord) *policyEnv {
+	e := &policyEnv{r: r, rec: rec, userID: r.Header.Get("X-User-ID")}
+	e.now, e.nowErr = timeSource.Now()
+	return e
+}
+
+func (e *policyEnv) eval(n *PolicyNode) *PolicyResult {
+	res := &PolicyResult{Kind: n.kind()}
+	switch res.Kind {
+	case "all", "any":
+		children := n.All
+		if res.Kind == "any" {
+			children = n.Any
+		}
+		passed, unknown := 0, 0
+		for _, c := range children {
+			cr := e.eval(c)
+			res.Children = append(res.Children, cr)
+			switch cr.Result {
+			case policyPass:
+				passed++
+			case policyUnknown:
+				unknown++
+			}
+		}
+		switch {
+		case res.Kind == "all" && passed == len(children), res.Kind == "any" && passed > 0:
+			res.Result = policyPass
+		case unknown > 0 && (res.Kind == "any" || passed+unknown == len(children)):
+			res.Result = policyUnknown
+		default:
+			res.Result = policyFail
+		}
+		res.Detail = fmt.Sprintf("%d of %d passed", passed, len(children))
+	case "not":
+		cr := e.eval(n.Not)
+		res.Children = []*PolicyResult{cr}
+		switch cr.Result {
+		case policyPass:
+			res.Result = policyFail
+		case policyFail:
+			res.Result = policyPass
+		default:
+			res.Result = policyUnknown
+		}
+	case "time":
+		e.evalTime(res, n.notBefore, n.notAfter)
+	case "schedule":
+		e.evalSchedule(res, n.schedule)
+	case "geofence":
+		e.evalGeoFence(res, n.fence)
+	case "biometric":
+		e.evalBiometric(res, n.Biometric)
+	case "approvals":
+		e.evalApprovals(res, n.Approvals.Min)
+	case "one_time":
+		if e.rec.ConsumedAt != nil {
+			res.Result, res.Code, res.status = policyFail, "VAULT_CONSUMED", http.StatusGone
+			res.Detail = "already read"
+			res.message = "One-time vault has already been read and destroyed"
+		} else {
+			res.Result, res.Detail = policyPass, "not yet read"
+		}
+	case "chain":
+		e.evalChain(res)
+	}
+	return res
+}
+
+// evalBiometric looks for a recent AI verification of this user.
+func (e *policyEnv) evalBiometric(res *PolicyResult, factor string) {
+	res.Detail = factor
+	if pass, ok := e.rec.Factors[factor]; ok && pass.UserID == e.userID && e.nowErr == nil &&
+		e.now.Sub(pass.At) <= biometricFactorTTL && e.now.Sub(pass.At) > -time.Minute {
+		res.Result = policyPass
+		res.Detail = fmt.Sprintf("%s verified at %s", factor, pass.At.Format(time.RFC3339))
+		return
+	}
+	res.Result, res.Code, res.status = policyFail, "BIOMETRIC_REQUIRED", http.StatusForbidden
+	res.message = fmt.Sprintf("Vault requires a %s verification within the last %v", factor, biometricFactorTTL)
+	res.fields = map[string]interface{}{"factor": factor}
+}
+
+// deciding finds the leaf to report for a refused tree: the first leaf that
+// fails on its own, reached through "all" nodes only. Under any/not no
+// single leaf is to blame, and nil is returned.
+func (res *PolicyResult) deciding() *PolicyResult {
+	if res.passed() {
+		return nil
+	}
+	switch res.Kind {
+	case "all":
+		for _, c := range res.Children {
+			if d := c.deciding(); d != nil {
+				return d
+			}
+		}
+		return nil
+	case "any", "not":
+		return nil
+	}
+	return res
+}
+
+// checkUnlockPolicy is the gate before any key release. It returns nil when
+// rec may be opened by this request. Otherwise it writes the refusal, with
+// the explanation tree, and returns a non-nil error.
+func checkUnlockPolicy(w http.ResponseWriter, r *http.Request, rec *VaultRecord) error {
+	res, err := evalUnlockPolicy(r, rec)
+	if err != nil {
+		fmt.Printf("[Policy] Vault %s has an unusable policy: %v\n", rec.ID, err)
+		writeError(w, http.StatusInternalServerError, "Vault policy is unusable")
+		return err
+	}
+	if res == nil || res.passed() {
+		return nil
+	}
+
+	status, code, message := http.StatusForbidden, "POLICY_DENIED", "Vault unlock policy is not satisfied"
+	body := map[string]interface{}{}
+	if d := res.deciding(); d != nil {
+		if d.status != 0 {
+			status = d.status
+		}
+		if d.Code != "" {
+			code = d.Code
+		}
+		if d.message != "" {
+			message = d.message
+		}
+		for k, v := range d.fields {
+			body[k] = v
+		}
+		if d.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(d.retryAfter, 10))
+		}
+	}
+	body["error"], body["code"], body["vault_id"], body["policy"] = message, code, rec.ID, res
+	writeJSON(w, status, body)
+	return fmt.Errorf("vault %s refused by policy: %s", rec.ID, code)
+}
+
+// evalUnlockPolicy evaluates rec's effective policy for r. It writes
+// nothing, to the response or to any vault. The result is nil when nothing
+// gates the vault.
+func evalUnlockPolicy(r *http.Request, rec *VaultRecord) (*PolicyResult, error) {
+	policy, err := effectivePolicy(rec)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+	return newPolicyEnv(r, rec).eval(policy), nil
+}
+
+// --- Biometric Factors ---
+
+// FactorPass records a successful AI verification against a vault.
+type FactorPass struct {
+	UserID string    `json:"user_id"`
+	At     time.Time `json:"at"`
+}
+
+// recordFactor notes that userID passed factor for vaultID.
+func recordFactor(vaultID, userID, factor string) {
+	now := time.Now().UTC()
+	err := vaults.Update(vaultID, func(r *VaultRecord) error {
+		factors := make(map[string]FactorPass, len(r.Factors)+1)
+		for k, v := range r.Factors {
+			factors[k] = v
+		}
+		factors[factor] = FactorPass{UserID: userID, At: now}
+		r.Factors = factors
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("[Policy] Recording %s factor for %s failed: %v\n", factor, vaultID, err)
+	}
+}
+
+// --- Policy Status ---
+
+// policyHandler evaluates vault_id's policy for the calling owner without
+// releasing anything. It takes the same location fields as /retrieve.
+func policyHandler(w http.ResponseWriter, r *http.Request) {
+	rec := lookupVaultForm(w, r)
+	if rec == nil {
+		return
+	}
+	if rec.Owner != r.Header.Get("X-User-ID") {
+		writeError(w, http.StatusForbidden, "Only the vault owner can inspect its policy")
+		return
+	}
+	policy, err := effectivePolicy(rec)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Vault policy is unusable")
+		return
+	}
+	if policy == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"vault_id": rec.ID, "allowed": true})
+		return
+	}
+	env := newPolicyEnv(r, rec)
+	res := env.eval(policy)
+	body := map[string]interface{}{
+		"vault_id": rec.ID,
+		"allowed":  res.passed(),
+		"policy":   res,
+	}
+	if env.nowErr == nil {
+		if next := nextWindow(rec, env.now); next != nil {
+			body["next_window"] = next
+		}
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// --- Upload ---
+
+// uploadPolicy validates the policy field of an upload and returns it
+// compacted for storage. hasApprovers says whether the upload configured
+// approvers for approvals leaves to count.
+func uploadPolicy(raw string, hasApprovers bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(strings.TrimSpace(raw))); err != nil {
+		return nil, fmt.Errorf("policy is not valid JSON")
+	}
+	p, err := compilePolicy(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if p.requires("approvals") && !hasApprovers {
+		return nil, fmt.Errorf("policy requires approvals but no approvers were given")
+	}
+	return buf.Bytes(), nil
+}
+
+// compiledOneTime reports whether a policy from uploadPolicy burns the vault.
+func compiledOneTime(policy []byte) bool {
+	p, err := compilePolicy(policy)
+	return err == nil && p.requires("one_time")
+}
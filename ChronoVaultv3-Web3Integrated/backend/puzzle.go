@@ -0,0 +1,333 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- RSW Time-Lock Puzzles ---
+//
+// Server-side time locks (timelock.go) only hold while the operator is
+// honest and online. A Rivest–Shamir–Wagner puzzle needs neither: the data
+// key is sealed under a value that can only be computed by T sequential
+// modular squarings,
+//
+//	b = a^(2^T) mod n
+//
+// The creator knows φ(n) and takes the shortcut e = 2^T mod φ(n), b = a^e;
+// anyone else has to square T times, one after another. T is calibrated from
+// a benchmark of this host's squaring speed, so the delay is "wall-clock time
+// on hardware like ours". A faster machine opens it sooner; operators who want
+// a margin set PUZZLE_SQUARINGS_PER_SEC to a faster reference rate.
+//
+// Everything needed to solve it lives in the manifest:
+//
+//	# Puzzle: RSW-2048
+//	# Puzzle-N: <base64 modulus>
+//	# Puzzle-A: <base64 base>
+//	# Puzzle-T: <squarings>
+//	# Puzzle-Rate: <squarings/s at creation, for progress estimates>
+//	# Puzzle-Key: <base64 nonce || AES-GCM(data key)>
+//
+// The sealing key is HKDF-SHA256 over b; N, A and T are bound as AAD, so a
+// manifest edited to a smaller T fails to open rather than yielding garbage.
+
+const (
+	puzzleSuite       = "RSW-2048"
+	puzzleModulusBits = 2048
+	puzzleBatch       = 1 << 12 // squarings per big.Int.Exp call
+	puzzleMaxDelay    = 100 * 365 * 24 * time.Hour
+
+	manifestPuzzlePrefix     = "# Puzzle: "
+	manifestPuzzleNPrefix    = "# Puzzle-N: "
+	manifestPuzzleAPrefix    = "# Puzzle-A: "
+	manifestPuzzleTPrefix    = "# Puzzle-T: "
+	manifestPuzzleRatePrefix = "# Puzzle-Rate: "
+	manifestPuzzleKeyPrefix  = "# Puzzle-Key: "
+)
+
+// TimeLockPuzzle is a data key sealed under an RSW puzzle.
+type TimeLockPuzzle struct {
+	Suite  string
+	N      *big.Int
+	A      *big.Int
+	T      uint64
+	Rate   uint64
+	Sealed []byte
+}
+
+var errPuzzleInterrupted = errors.New("puzzle solve interrupted")
+
+var (
+	squaringRateOnce sync.Once
+	squaringRate     uint64
+)
+
+// puzzleSquaringRate returns squarings per second, from
+// puzzle_squarings_per_sec or a one-off benchmark of this host.
+func puzzleSquaringRate() uint64 {
+	squaringRateOnce.Do(func() {
+		if cfg.PuzzleSquaringsPerSec > 0 {
+			squaringRate = cfg.PuzzleSquaringsPerSec
+			return
+		}
+		squaringRate = benchmarkSquaring(time.Second)
+		fmt.Printf("[Puzzle] Benchmarked %d squarings/s (%d-bit modulus)\n", squaringRate, puzzleModulusBits)
+	})
+	return squaringRate
+}
+
+// benchmarkSquaring measures the solver loop itself on a throwaway modulus.
+func benchmarkSquaring(d time.Duration) uint64 {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), puzzleModulusBits))
+	if err != nil {
+		return 1
+	}
+	n.SetBit(n, puzzleModulusBits-1, 1).SetBit(n, 0, 1)
+	x := big.NewInt(3)
+	exp := new(big.Int).Lsh(big.NewInt(1), puzzleBatch)
+
+	var done uint64
+	start := time.Now()
+	for time.Since(start) < d {
+		x.Exp(x, exp, n)
+		done += puzzleBatch
+	}
+	rate := uint64(float64(done) / time.Since(start).Seconds())
+	if rate == 0 {
+		rate = 1
+	}
+	return rate
+}
+
+// CreatePuzzle seals dataKey under a puzzle that takes about delay to solve
+// at the calibrated squaring rate.
+func CreatePuzzle(dataKey []byte, delay time.Duration) (*TimeLockPuzzle, error) {
+	if delay < time.Second || delay > puzzleMaxDelay {
+		return nil, fmt.Errorf("puzzle delay must be between 1s and %v", puzzleMaxDelay)
+	}
+	rate := puzzleSquaringRate()
+	t := uint64(delay.Seconds() * float64(rate))
+	if t == 0 {
+		t = 1
+	}
+
+	p, err := rand.Prime(rand.Reader, puzzleModulusBits/2)
+	if err != nil {
+		return nil, fmt.Errorf("prime generation failed: %w", err)
+	}
+	var q *big.Int
+	for q == nil || q.Cmp(p) == 0 {
+		if q, err = rand.Prime(rand.Reader, puzzleModulusBits/2); err != nil {
+			return nil, fmt.Errorf("prime generation failed: %w", err)
+		}
+	}
+	one := big.NewInt(1)
+	n := new(big.Int).Mul(p, q)
+	phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+
+	// a ∈ [2, n-2]
+	a, err := rand.Int(rand.Reader, new(big.Int).Sub(n, big.NewInt(3)))
+	if err != nil {
+		return nil, fmt.Errorf("CSPRNG failure generating puzzle base: %w", err)
+	}
+	a.Add(a, big.NewInt(2))
+
+	// The trapdoor: reduce the exponent mod φ(n), then one exponentiation.
+	e := new(big.Int).Exp(big.NewInt(2), new(big.Int).SetUint64(t), phi)
+	b := new(big.Int).Exp(a, e, n)
+
+	// p, q and φ(n) open the puzzle instantly; drop them now.
+	p.SetInt64(0)
+	q.SetInt64(0)
+	phi.SetInt64(0)
+
+	pz := &TimeLockPuzzle{Suite: puzzleSuite, N: n, A: a, T: t, Rate: rate}
+	gcm, err := pz.gcm(b)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("CSPRNG failure generating nonce: %w", err)
+	}
+	pz.Sealed = gcm.Seal(nonce, nonce, dataKey, pz.aad())
+	return pz, nil
+}
+
+// Open recovers the data key from the puzzle solution b.
+func (pz *TimeLockPuzzle) Open(b *big.Int) ([]byte, error) {
+	gcm, err := pz.gcm(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(pz.Sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sealed key is truncated")
+	}
+	nonce, sealed := pz.Sealed[:gcm.NonceSize()], pz.Sealed[gcm.NonceSize():]
+	dataKey, err := gcm.Open(nil, nonce, sealed, pz.aad())
+	if err != nil {
+		return nil, fmt.Errorf("puzzle solution does not open the key — tampered manifest?")
+	}
+	return dataKey, nil
+}
+
+// ID identifies a puzzle for checkpoint files.
+func (pz *TimeLockPuzzle) ID() string {
+	sum := sha256.Sum256(pz.aad())
+	return hex.EncodeToString(sum[:16])
+}
+
+func (pz *TimeLockPuzzle) aad() []byte {
+	return []byte(fmt.Sprintf("%s|%x|%x|%d", pz.Suite, pz.N, pz.A, pz.T))
+}
+
+func (pz *TimeLockPuzzle) gcm(b *big.Int) (cipher.AEAD, error) {
+	secret := b.FillBytes(make([]byte, (pz.N.BitLen()+7)/8))
+	kek, err := hkdf.Key(sha256.New, secret, nil, "ChronoVault RSW puzzle v1", 32)
+	if err != nil {
+		return nil, fmt.Errorf("puzzle KEK derivation failed: %w", err)
+	}
+	return newKeyWrapGCM(kek)
+}
+
+// Estimate is the expected solve time at the creation-time rate.
+func (pz *TimeLockPuzzle) Estimate() time.Duration {
+	if pz.Rate == 0 {
+		return 0
+	}
+	return time.Duration(float64(pz.T) / float64(pz.Rate) * float64(time.Second))
+}
+
+// --- Solving ---
+
+// puzzleCheckpoint is the resumable state of a solve in progress.
+type puzzleCheckpoint struct {
+	PuzzleID string `json:"puzzle_id"`
+	Done     uint64 `json:"done"`
+	X        string `json:"x"` // base64 a^(2^Done) mod n
+}
+
+// SolvePuzzle performs the remaining squarings from cp (nil to start fresh).
+// save is called roughly every saveEvery with the current state, progress at
+// every batch; stop is polled between batches and aborts with the latest
+// checkpoint when it returns true.
+func SolvePuzzle(pz *TimeLockPuzzle, cp *puzzleCheckpoint, saveEvery time.Duration,
+	save func(*puzzleCheckpoint) error, progress func(done uint64), stop func() bool) (*big.Int, *puzzleCheckpoint, error) {
+
+	x := new(big.Int).Set(pz.A)
+	var done uint64
+	if cp != nil {
+		if cp.PuzzleID != pz.ID() {
+			return nil, nil, fmt.Errorf("checkpoint belongs to a different puzzle")
+		}
+		raw, err := base64.StdEncoding.DecodeString(cp.X)
+		if err != nil || cp.Done > pz.T {
+			return nil, nil, fmt.Errorf("checkpoint is corrupt")
+		}
+		x.SetBytes(raw)
+		done = cp.Done
+	}
+
+	snapshot := func() *puzzleCheckpoint {
+		return &puzzleCheckpoint{PuzzleID: pz.ID(), Done: done, X: base64.StdEncoding.EncodeToString(x.Bytes())}
+	}
+
+	exp := new(big.Int).Lsh(big.NewInt(1), puzzleBatch)
+	lastSave := time.Now()
+	for done < pz.T {
+		if stop != nil && stop() {
+			return nil, snapshot(), errPuzzleInterrupted
+		}
+		step := uint64(puzzleBatch)
+		if remaining := pz.T - done; remaining < step {
+			step = remaining
+			exp = new(big.Int).Lsh(big.NewInt(1), uint(step))
+		}
+		x.Exp(x, exp, pz.N)
+		done += step
+
+		if progress != nil {
+			progress(done)
+		}
+		if save != nil && time.Since(lastSave) >= saveEvery {
+			if err := save(snapshot()); err != nil {
+				return nil, nil, fmt.Errorf("checkpoint write failed: %w", err)
+			}
+			lastSave = time.Now()
+		}
+	}
+	return x, snapshot(), nil
+}
+
+// --- Manifest Encoding ---
+
+// ManifestHeaders renders the puzzle as manifest comment lines.
+func (pz *TimeLockPuzzle) ManifestHeaders() string {
+	enc := base64.StdEncoding
+	return manifestPuzzlePrefix + pz.Suite + "\n" +
+		manifestPuzzleNPrefix + enc.EncodeToString(pz.N.Bytes()) + "\n" +
+		manifestPuzzleAPrefix + enc.EncodeToString(pz.A.Bytes()) + "\n" +
+		manifestPuzzleTPrefix + strconv.FormatUint(pz.T, 10) + "\n" +
+		manifestPuzzleRatePrefix + strconv.FormatUint(pz.Rate, 10) + "\n" +
+		manifestPuzzleKeyPrefix + enc.EncodeToString(pz.Sealed) + "\n"
+}
+
+// ParseManifestPuzzle extracts the puzzle headers from a manifest.
+// It returns (nil, nil) for manifests without a puzzle.
+func ParseManifestPuzzle(manifest string) (*TimeLockPuzzle, error) {
+	pz := &TimeLockPuzzle{}
+	var haveN, haveA, haveT, haveKey bool
+	var err error
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, manifestPuzzlePrefix):
+			pz.Suite = strings.TrimPrefix(line, manifestPuzzlePrefix)
+		case strings.HasPrefix(line, manifestPuzzleNPrefix):
+			var raw []byte
+			raw, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, manifestPuzzleNPrefix))
+			pz.N, haveN = new(big.Int).SetBytes(raw), true
+		case strings.HasPrefix(line, manifestPuzzleAPrefix):
+			var raw []byte
+			raw, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, manifestPuzzleAPrefix))
+			pz.A, haveA = new(big.Int).SetBytes(raw), true
+		case strings.HasPrefix(line, manifestPuzzleTPrefix):
+			pz.T, err = strconv.ParseUint(strings.TrimPrefix(line, manifestPuzzleTPrefix), 10, 64)
+			haveT = true
+		case strings.HasPrefix(line, manifestPuzzleRatePrefix):
+			pz.Rate, err = strconv.ParseUint(strings.TrimPrefix(line, manifestPuzzleRatePrefix), 10, 64)
+		case strings.HasPrefix(line, manifestPuzzleKeyPrefix):
+			pz.Sealed, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(line, manifestPuzzleKeyPrefix))
+			haveKey = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed puzzle header %q: %w", line, err)
+		}
+	}
+
+	if pz.Suite == "" && !haveN && !haveA && !haveT && !haveKey {
+		return nil, nil
+	}
+	if pz.Suite != puzzleSuite {
+		return nil, fmt.Errorf("unsupported puzzle suite: %q", pz.Suite)
+	}
+	if !haveN || !haveA || !haveT || !haveKey {
+		return nil, fmt.Errorf("manifest puzzle headers are incomplete")
+	}
+	if pz.N.BitLen() < puzzleModulusBits-8 || pz.A.Sign() <= 0 || pz.A.Cmp(pz.N) >= 0 {
+		return nil, fmt.Errorf("manifest puzzle parameters are invalid")
+	}
+	return pz, nil
+}
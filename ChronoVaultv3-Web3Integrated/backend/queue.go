@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --- Persistent Unpin Queue ---
+//
+// Unpinning talks to Pinata over the network and fails for ordinary reasons
+// (rate limits, outages, expired JWTs). A failure used to be logged and
+// forgotten, which left chunks pinned and paid for indefinitely. Every unpin
+// now goes through this queue, persisted as JSON under
+// <VAULT_DATA_DIR>/queue/unpin.json:
+//
+//   - a failed job is retried with exponential backoff (30s doubling, capped
+//     at 6h)
+//   - after unpinMaxAttempts it moves to the dead-letter list in the same
+//     file for an operator to inspect
+//   - the outcome of each CID is written back to the vault's Deletion record
+//
+// Jobs survive restarts; the worker picks up where it left off.
+
+const (
+	unpinMaxAttempts = 20
+	unpinBaseBackoff = 30 * time.Second
+	unpinMaxBackoff  = 6 * time.Hour
+)
+
+type unpinJob struct {
+	VaultID     string    `json:"vault_id"`
+	CID         string    `json:"cid"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	EnqueuedAt  time.Time `json:"enqueued_at"`
+}
+
+type unpinQueueFile struct {
+	Pending []*unpinJob `json:"pending"`
+	Dead    []*unpinJob `json:"dead"`
+}
+
+type unpinQueue struct {
+	mu    sync.Mutex
+	path  string
+	state unpinQueueFile
+	wake  chan struct{}
+}
+
+var unpins = &unpinQueue{wake: make(chan struct{}, 1)}
+
+// initUnpinQueue loads the queue from disk.
+func initUnpinQueue() {
+	dir := filepath.Join(vaults.dir, "queue")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		fmt.Printf("⚠️  Unpin queue unavailable: %v\n", err)
+		return
+	}
+	unpins.mu.Lock()
+	defer unpins.mu.Unlock()
+	unpins.path = filepath.Join(dir, "unpin.json")
+	data, err := os.ReadFile(unpins.path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("⚠️  Unpin queue unreadable: %v\n", err)
+		return
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &unpins.state); err != nil {
+			fmt.Printf("⚠️  Unpin queue corrupt: %v\n", err)
+			return
+		}
+	}
+	fmt.Printf("📌 Unpin queue: %d pending, %d dead-lettered\n", len(unpins.state.Pending), len(unpins.state.Dead))
+}
+
+// Enqueue schedules cids of vaultID for unpinning now.
+func (q *unpinQueue) Enqueue(vaultID string, cids []string) error {
+	q.mu.Lock()
+	now := time.Now().UTC()
+	for _, cid := range cids {
+		q.state.Pending = append(q.state.Pending, &unpinJob{VaultID: vaultID, CID: cid, NextAttempt: now, EnqueuedAt: now})
+	}
+	err := q.save()
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// save must be called with q.mu held.
+func (q *unpinQueue) save() error {
+	if q.path == "" {
+		return fmt.Errorf("unpin queue not initialised")
+	}
+	data, err := json.MarshalIndent(q.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path, data, 0600)
+}
+
+// run works the queue until the process exits.
+func (q *unpinQueue) run() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		q.drain()
+		select {
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// drain attempts every due job once. The network call happens outside the
+// lock so Enqueue never waits on Pinata.
+func (q *unpinQueue) drain() {
+	q.mu.Lock()
+	now := time.Now().UTC()
+	var due []*unpinJob
+	for _, j := range q.state.Pending {
+		if !now.Before(j.NextAttempt) {
+			due = append(due, j)
+		}
+	}
+	q.mu.Unlock()
+
+	for _, j := range due {
+		err := UnpinFromIPFS(j.CID)
+
+		q.mu.Lock()
+		final := false
+		if err == nil {
+			q.remove(j)
+			final = true
+		} else {
+			j.Attempts++
+			j.LastError = err.Error()
+			backoff := unpinBaseBackoff << uint(min(j.Attempts-1, 20))
+			if backoff > unpinMaxBackoff {
+				backoff = unpinMaxBackoff
+			}
+			j.NextAttempt = time.Now().UTC().Add(backoff)
+			if j.Attempts >= unpinMaxAttempts {
+				q.remove(j)
+				q.state.Dead = append(q.state.Dead, j)
+				final = true
+			}
+		}
+		if saveErr := q.save(); saveErr != nil {
+			fmt.Printf("[Unpin] Queue write failed: %v\n", saveErr)
+		}
+		q.mu.Unlock()
+
+		if err != nil {
+			fmt.Printf("[Unpin] %s (vault %s) attempt %d failed: %v\n", j.CID, j.VaultID, j.Attempts, err)
+		}
+		if final {
+			recordUnpinOutcome(j.VaultID, j.CID, err)
+		}
+	}
+}
+
+// remove must be called with q.mu held.
+func (q *unpinQueue) remove(job *unpinJob) {
+	for i, j := range q.state.Pending {
+		if j == job {
+			q.state.Pending = append(q.state.Pending[:i], q.state.Pending[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Retention and Expiry ---
+//
+// A vault expires at the earlier of:
+//
+//   - its own expiry, set at upload with retention_days or expires_at
+//   - its tenant's retention, from the JSON file in RETENTION_POLICY_FILE:
+//
+//	{"default_days": 0, "tenants": {"<user id>": 30, "@example.com": 90}}
+//
+// A tenant is matched first by owner user ID, then by "@" plus the owner's
+// email domain; 0 means keep forever. Tenant policy is applied at reap time,
+// so tightening it affects existing vaults too.
+//
+// Vaults under legal hold (hold.go) never expire while the hold lasts.
+//
+// The reaper runs every REAPER_INTERVAL (default 5m). An expired vault is
+// crypto-shredded: its escrowed key is destroyed, and a client-held key is
+// useless once the ciphertext is gone. The vault's chunks go onto the
+// persistent unpin queue (queue.go). The record stays behind as a tombstone
+// whose Deletion field tracks the outcome, and /retrieve answers 410.
+
+// DeletionRecord tracks a vault's destruction.
+type DeletionRecord struct {
+	At             time.Time  `json:"at"`
+	Reason         string     `json:"reason"` // "retention", "burn-after-read" or "owner"
+	KeyShredded    bool       `json:"key_shredded"`
+	ChunksTotal    int        `json:"chunks_total"`
+	ChunksUnpinned int        `json:"chunks_unpinned"`
+	ChunksFailed   []string   `json:"chunks_failed,omitempty"` // dead-lettered
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+type retentionPolicy struct {
+	DefaultDays int            `json:"default_days"`
+	Tenants     map[string]int `json:"tenants"`
+}
+
+var retention retentionPolicy
+
+// initRetention loads the tenant retention policy, if any.
+func initRetention() {
+	path := cfg.RetentionPolicyFile
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &retention)
+	}
+	if err != nil {
+		fmt.Printf("⚠️  Retention policy %s unusable: %v — tenant retention disabled.\n", path, err)
+		retention = retentionPolicy{}
+		return
+	}
+	fmt.Printf("🗑️  Retention policy: default %d day(s), %d tenant override(s)\n", retention.DefaultDays, len(retention.Tenants))
+}
+
+// tenantRetentionDays returns the tenant retention for rec's owner.
+func tenantRetentionDays(rec *VaultRecord) int {
+	if days, ok := retention.Tenants[rec.Owner]; ok {
+		return days
+	}
+	if at := strings.LastIndex(rec.OwnerEmail, "@"); at >= 0 {
+		if days, ok := retention.Tenants[strings.ToLower(rec.OwnerEmail[at:])]; ok {
+			return days
+		}
+	}
+	return retention.DefaultDays
+}
+
+// EffectiveExpiry is when rec expires under both policies, or nil.
+func (rec *VaultRecord) EffectiveExpiry() *time.Time {
+	exp := rec.ExpiresAt
+	if days := tenantRetentionDays(rec); days > 0 {
+		t := rec.CreatedAt.Add(time.Duration(days) * 24 * time.Hour)
+		if exp == nil || t.Before(*exp) {
+			exp = &t
+		}
+	}
+	return exp
+}
+
+// parseRetention reads retention_days or expires_at from the upload form.
+func parseRetention(r *http.Request, now time.Time) (*time.Time, error) {
+	if v := r.FormValue("retention_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 1 || days > 36500 {
+			return nil, fmt.Errorf("retention_days must be between 1 and 36500")
+		}
+		t := now.Add(time.Duration(days) * 24 * time.Hour)
+		return &t, nil
+	}
+	if v := r.FormValue("expires_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("expires_at must be RFC 3339")
+		}
+		if !t.After(now) {
+			return nil, fmt.Errorf("expires_at must be in the future")
+		}
+		t = t.UTC()
+		return &t, nil
+	}
+	return nil, nil
+}
+
+// checkRetention returns nil while rec is alive. Burned vaults are left to
+// the one-time path so they report VAULT_CONSUMED. Expiry is judged by the
+// trusted time source; without it a vault that can expire gets 503.
+func checkRetention(w http.ResponseWriter, rec *VaultRecord) error {
+	deletedAt, msg, code := "", "Vault has expired and been deleted", "VAULT_EXPIRED"
+	switch {
+	case rec.Deletion != nil && rec.Deletion.Reason == "burn-after-read":
+		return nil
+	case rec.Deletion != nil:
+		deletedAt = rec.Deletion.At.Format(time.RFC3339)
+		if rec.Deletion.Reason == "owner" {
+			msg, code = "Vault has been deleted by its owner", "VAULT_DELETED"
+		}
+	case rec.LegalHold != nil:
+		return nil
+	default:
+		exp := rec.EffectiveExpiry()
+		if exp == nil {
+			return nil
+		}
+		now, err := timeSource.Now()
+		if err != nil {
+			writeError(w, http.StatusServiceUnavailable, "Trusted time source unavailable")
+			return fmt.Errorf("vault %s: %w", rec.ID, err)
+		}
+		if now.Before(*exp) {
+			return nil
+		}
+		deletedAt = exp.Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusGone, map[string]string{
+		"error":      msg,
+		"code":       code,
+		"vault_id":   rec.ID,
+		"expired_at": deletedAt,
+	})
+	return fmt.Errorf("vault %s expired", rec.ID)
+}
+
+// --- Reaper ---
+
+func runReaper() {
+	interval := cfg.ReaperInterval
+	fmt.Printf("🗑️  Retention reaper every %v\n", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reapExpired()
+		<-ticker.C
+	}
+}
+
+// reapExpired shreds every vault past its effective expiry.
+func reapExpired() {
+	now, err := timeSource.Now()
+	if err != nil {
+		fmt.Printf("[Reaper] Skipping run, time source unavailable: %v\n", err)
+		return
+	}
+	for _, rec := range vaults.List() {
+		if rec.Deletion != nil || rec.LegalHold != nil {
+			continue
+		}
+		exp := rec.EffectiveExpiry()
+		if exp == nil || now.Before(*exp) {
+			continue
+		}
+		if err := shredVault(rec.ID, "retention", now); err != nil {
+			fmt.Printf("[Reaper] Vault %s: %v\n", rec.ID, err)
+		}
+	}
+}
+
+// shredVault destroys the escrowed key and queues the chunks for unpinning.
+func shredVault(id, reason string, now time.Time) error {
+	var rec VaultRecord
+	var escrowed []byte
+	err := vaults.Update(id, func(r *VaultRecord) error {
+		if r.Deletion != nil {
+			return fmt.Errorf("already deleted")
+		}
+		if err := checkMutable(r); err != nil {
+			return err
+		}
+		escrowed = r.EscrowedKey
+		r.EscrowedKey = nil
+		r.Deletion = newDeletion(r, reason, now, escrowed != nil)
+		rec = *r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	wipe(escrowed)
+	fmt.Printf("[Reaper] Vault %s shredded (%s); %d chunk(s) queued for unpin\n", id, reason, len(rec.CIDs))
+	return unpins.Enqueue(id, rec.CIDs)
+}
+
+func newDeletion(r *VaultRecord, reason string, now time.Time, keyShredded bool) *DeletionRecord {
+	d := &DeletionRecord{At: now, Reason: reason, KeyShredded: keyShredded, ChunksTotal: len(r.CIDs)}
+	if d.ChunksTotal == 0 {
+		d.CompletedAt = &now
+	}
+	return d
+}
+
+// recordUnpinOutcome is called by the unpin queue when a CID is finished,
+// successfully or after its final attempt.
+func recordUnpinOutcome(vaultID, cid string, unpinErr error) {
+	err := vaults.Update(vaultID, func(r *VaultRecord) error {
+		if r.Deletion == nil {
+			return fmt.Errorf("no deletion in progress")
+		}
+		d := *r.Deletion
+		if unpinErr == nil {
+			d.ChunksUnpinned++
+		} else {
+			d.ChunksFailed = append(append([]string(nil), d.ChunksFailed...), cid)
+		}
+		if d.ChunksUnpinned+len(d.ChunksFailed) >= d.ChunksTotal && d.CompletedAt == nil {
+			now := time.Now().UTC()
+			d.CompletedAt = &now
+		}
+		r.Deletion = &d
+		return nil
+	})
+	if err != nil && err != errVaultNotFound {
+		fmt.Printf("[Unpin] Outcome for %s not recorded: %v\n", vaultID, err)
+	}
+}
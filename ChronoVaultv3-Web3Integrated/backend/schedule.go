@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // vault time zones must resolve on hosts without zoneinfo
+)
+
+// --- Recurring Unlock Windows ---
+//
+// A vault can open on a schedule instead of once: upload with
+// schedule=<cron expression>, schedule_window=<duration> and optionally
+// schedule_tz=<IANA zone> (default UTC). A window opens each time the cron
+// expression fires and stays open for schedule_window. Outside a window,
+// /retrieve and /vault/release are refused with 423 SCHEDULE_CLOSED and the
+// time the next one opens. "0 0 14 2 *" with a 24h window opens every
+// Valentine's Day.
+//
+// Expressions have the five standard fields (minute hour day-of-month month
+// day-of-week), with *, lists, ranges, steps, and JAN-DEC/SUN-SAT names, or
+// one of @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly. When
+// both day fields are restricted, either may match, as in Vixie cron. Fire
+// times are computed in the vault's zone, so "9am" stays 9am across DST. A
+// fire time inside a spring-forward gap is skipped, and one in a repeated
+// autumn hour fires twice.
+//
+// The schedule is a leaf in the unlock policy (policy.go), and can be used
+// there directly as {"schedule": {"cron": ..., "window": ..., "tz": ...}}.
+
+// UnlockSchedule is a recurring window as uploaded and stored.
+type UnlockSchedule struct {
+	Cron     string `json:"cron"`
+	Window   string `json:"window"`
+	TimeZone string `json:"tz,omitempty"`
+}
+
+// compiledSchedule is an UnlockSchedule ready to evaluate.
+type compiledSchedule struct {
+	cron   *cronSchedule
+	window time.Duration
+	loc    *time.Location
+}
+
+// compile validates s.
+func (s *UnlockSchedule) compile() (*compiledSchedule, error) {
+	cron, err := parseCron(s.Cron)
+	if err != nil {
+		return nil, err
+	}
+	window, err := time.ParseDuration(s.Window)
+	if err != nil || window < time.Minute || window > 366*24*time.Hour {
+		return nil, fmt.Errorf("schedule window must be a duration between 1m and 8784h")
+	}
+	loc := time.UTC
+	if s.TimeZone != "" {
+		if loc, err = time.LoadLocation(s.TimeZone); err != nil {
+			return nil, fmt.Errorf("unknown schedule time zone %q", s.TimeZone)
+		}
+	}
+	if cron.next(time.Now(), loc).IsZero() {
+		return nil, fmt.Errorf("schedule %q never fires", s.Cron)
+	}
+	return &compiledSchedule{cron: cron, window: window, loc: loc}, nil
+}
+
+// windowAt returns the window containing now, or the next one to open. open
+// reports which it is; the zero times mean the schedule never fires again.
+func (c *compiledSchedule) windowAt(now time.Time) (opens, closes time.Time, open bool) {
+	opens = c.cron.next(now.Add(-c.window), c.loc)
+	if opens.IsZero() {
+		return opens, opens, false
+	}
+	if !opens.After(now) {
+		return opens, opens.Add(c.window), true
+	}
+	return opens, opens.Add(c.window), false
+}
+
+// parseSchedule reads the schedule fields of an upload. It returns nil when
+// none were given.
+func parseSchedule(r *http.Request) (*UnlockSchedule, error) {
+	expr := strings.TrimSpace(r.FormValue("schedule"))
+	if expr == "" {
+		return nil, nil
+	}
+	s := &UnlockSchedule{Cron: expr, Window: r.FormValue("schedule_window"), TimeZone: r.FormValue("schedule_tz")}
+	if s.Window == "" {
+		return nil, fmt.Errorf("schedule requires schedule_window")
+	}
+	if _, err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// windowInfo describes a window for vault metadata.
+type windowInfo struct {
+	Opens  string `json:"opens"`
+	Closes string `json:"closes"`
+	Open   bool   `json:"open"`
+}
+
+// nextWindow is the current or next window of rec's schedule, or nil. A
+// zero now, from windowClock, also gives nil.
+func nextWindow(rec *VaultRecord, now time.Time) *windowInfo {
+	if rec.Schedule == nil || now.IsZero() {
+		return nil
+	}
+	c, err := rec.Schedule.compile()
+	if err != nil {
+		return nil
+	}
+	opens, closes, open := c.windowAt(now)
+	if opens.IsZero() {
+		return nil
+	}
+	return &windowInfo{Opens: opens.Format(time.RFC3339), Closes: closes.Format(time.RFC3339), Open: open}
+}
+
+// windowClock is the trusted time for reporting windows. When the time
+// source is unavailable it is zero, so no window is reported rather than one
+// judged by the local clock.
+func windowClock() time.Time {
+	now, err := timeSource.Now()
+	if err != nil {
+		return time.Time{}
+	}
+	return now
+}
+
+// evalSchedule decides a schedule leaf (see policy.go).
+func (e *policyEnv) evalSchedule(res *PolicyResult, c *compiledSchedule) {
+	if e.nowErr != nil {
+		res.Result, res.Code, res.status = policyUnknown, "TIME_UNAVAILABLE", http.StatusServiceUnavailable
+		res.Detail = "trusted time source unavailable"
+		res.message = "Trusted time source unavailable — scheduled vault cannot be opened"
+		return
+	}
+	opens, closes, open := c.windowAt(e.now)
+	if open {
+		res.Result = policyPass
+		res.Detail = "window open until " + closes.Format(time.RFC3339)
+		return
+	}
+	res.Result, res.Code, res.status = policyFail, "SCHEDULE_CLOSED", http.StatusLocked
+	res.message = "Vault is outside its unlock window"
+	res.fields = map[string]interface{}{"server_time": e.now.Format(time.RFC3339)}
+	if opens.IsZero() {
+		res.Detail = "schedule never fires again"
+		return
+	}
+	secs := int64((opens.Sub(e.now) + time.Second - 1) / time.Second)
+	res.Detail = "next window opens " + opens.Format(time.RFC3339)
+	res.retryAfter = secs
+	res.fields["next_window"] = windowInfo{Opens: opens.Format(time.RFC3339), Closes: closes.Format(time.RFC3339)}
+	res.fields["seconds_remaining"] = secs
+}
+
+// --- Cron Expressions ---
+
+// cronSchedule holds the allowed values of each field as bitmasks.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonthNames = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	cronDowNames   = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// parseCron parses a five-field expression or macro.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule must have 5 fields (minute hour day month weekday)")
+	}
+	c := &cronSchedule{}
+	var err error
+	if c.minute, _, err = parseCronField(fields[0], 0, 59, nil, 0); err != nil {
+		return nil, fmt.Errorf("schedule minute: %w", err)
+	}
+	if c.hour, _, err = parseCronField(fields[1], 0, 23, nil, 0); err != nil {
+		return nil, fmt.Errorf("schedule hour: %w", err)
+	}
+	if c.dom, c.domStar, err = parseCronField(fields[2], 1, 31, nil, 0); err != nil {
+		return nil, fmt.Errorf("schedule day of month: %w", err)
+	}
+	if c.month, _, err = parseCronField(fields[3], 1, 12, cronMonthNames, 1); err != nil {
+		return nil, fmt.Errorf("schedule month: %w", err)
+	}
+	// 7 is accepted for Sunday and folded onto 0.
+	if c.dow, c.dowStar, err = parseCronField(fields[4], 0, 7, cronDowNames, 0); err != nil {
+		return nil, fmt.Errorf("schedule weekday: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	return c, nil
+}
+
+// parseCronField returns the bitmask of a field and whether it was "*".
+// names, if given, are aliases for lo, lo+1, ...
+func parseCronField(field string, lo, hi int, names []string, nameBase int) (uint64, bool, error) {
+	var mask uint64
+	value := func(s string) (int, error) {
+		for i, n := range names {
+			if strings.EqualFold(s, n) {
+				return i + nameBase, nil
+			}
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < lo || v > hi {
+			return 0, fmt.Errorf("%q is not between %d and %d", s, lo, hi)
+		}
+		return v, nil
+	}
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, false, fmt.Errorf("bad step in %q", part)
+			}
+			rng, step = part[:i], s
+		}
+		first, last := lo, hi
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			ends := strings.SplitN(rng, "-", 2)
+			var err error
+			if first, err = value(ends[0]); err != nil {
+				return 0, false, err
+			}
+			if last, err = value(ends[1]); err != nil {
+				return 0, false, err
+			}
+			if last < first {
+				return 0, false, fmt.Errorf("range %q runs backwards", rng)
+			}
+		default:
+			v, err := value(rng)
+			if err != nil {
+				return 0, false, err
+			}
+			first = v
+			if step == 1 {
+				last = v
+			}
+		}
+		for v := first; v <= last; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, field == "*", nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first fire time strictly after t, in loc, or the zero
+// time if there is none in the next five years.
+func (c *cronSchedule) next(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		var n time.Time
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			n = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			n = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			n = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			n = t.Add(time.Minute)
+		default:
+			return t
+		}
+		// A wall time inside a DST gap may normalise to before t.
+		if !n.After(t) {
+			n = t.Add(time.Minute)
+		}
+		t = n
+	}
+	return time.Time{}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// --- Secure Memory Buffers ---
+//
+// Keys and plaintext used to live in ordinary slices: zeroing them after use
+// (as uploadHandler did) didn't help the copies the GC had already made, and
+// nothing stopped the kernel from swapping them to disk. A SecureBuffer is
+// allocated outside the Go heap (see securemem_linux.go):
+//
+//	[guard page][ ... padding ... | data ][guard page]
+//
+//   - mmap'd anonymously, so the GC never moves or copies it
+//   - mlock'd, so it is never written to swap
+//   - excluded from core dumps (MADV_DONTDUMP)
+//   - surrounded by PROT_NONE guard pages, so an overrun faults immediately
+//   - zeroed and unmapped by Destroy
+//
+// What it cannot protect: copies made by the standard library outside our
+// control (the AES key schedule inside crypto/aes, multipart form buffers).
+// Those are minimised, not eliminated.
+//
+// SECURE_MEMORY selects the policy when mlock fails (usually because
+// RLIMIT_MEMLOCK is too low):
+//
+//	best-effort (default)  keep the guarded, zeroizing mapping but unlocked
+//	strict                 fail the allocation
+
+// SecureBuffer is a fixed-size, page-guarded, locked byte buffer.
+// Call Destroy exactly once when done; Bytes must not be used afterwards.
+type SecureBuffer struct {
+	mu     sync.Mutex
+	region []byte // whole mapping including guard pages
+	data   []byte // usable window handed to callers
+	locked bool
+}
+
+var (
+	memlockWarnOnce  sync.Once
+	secureMemBackend = "mmap+mlock"
+)
+
+// secureMemStrict reports whether secure_memory is "strict".
+func secureMemStrict() bool {
+	return strings.EqualFold(cfg.SecureMemory, "strict")
+}
+
+// Bytes returns the usable window. It is nil after Destroy.
+func (b *SecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.data
+}
+
+// Len returns the usable size in bytes.
+func (b *SecureBuffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Locked reports whether the buffer is pinned in RAM.
+func (b *SecureBuffer) Locked() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.locked
+}
+
+// Destroy zeroes the buffer and releases it. Safe to call on nil and more
+// than once.
+func (b *SecureBuffer) Destroy() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.region == nil {
+		return
+	}
+	wipe(b.data)
+	freeSecureRegion(b.region, b.locked)
+	b.region, b.data, b.locked = nil, nil, false
+}
+
+// NewSecureBufferFrom copies src into a new SecureBuffer and wipes src.
+// Use it to move secrets that some API returned on the heap into locked memory.
+func NewSecureBufferFrom(src []byte) (*SecureBuffer, error) {
+	b, err := NewSecureBuffer(len(src))
+	if err != nil {
+		wipe(src)
+		return nil, err
+	}
+	copy(b.Bytes(), src)
+	wipe(src)
+	return b, nil
+}
+
+// readSecure reads exactly size bytes from r straight into a SecureBuffer,
+// so the secret never passes through an intermediate heap slice.
+func readSecure(r io.Reader, size int64) (*SecureBuffer, error) {
+	if size < 0 || size > int64(cfg.MaxUploadSize) {
+		return nil, fmt.Errorf("secure read: invalid size %d", size)
+	}
+	b, err := NewSecureBuffer(int(size))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, b.Bytes()); err != nil {
+		b.Destroy()
+		return nil, fmt.Errorf("secure read: %w", err)
+	}
+	return b, nil
+}
+
+// decodeSecureKey interprets a key file that is either 64 hex characters
+// (web download) or 32 raw bytes (CLI). raw is consumed: it is either
+// returned as the key or destroyed after decoding.
+func decodeSecureKey(raw *SecureBuffer) (*SecureBuffer, error) {
+	src := bytes.TrimSpace(raw.Bytes())
+	if len(src) != hex.EncodedLen(32) {
+		return raw, nil
+	}
+	key, err := NewSecureBuffer(32)
+	if err != nil {
+		raw.Destroy()
+		return nil, err
+	}
+	if _, err := hex.Decode(key.Bytes(), src); err != nil {
+		key.Destroy()
+		return raw, nil
+	}
+	raw.Destroy()
+	return key, nil
+}
+
+// openSecure decrypts ciphertext into a SecureBuffer sized exactly to the
+// plaintext, so AEAD output is never staged on the heap.
+func openSecure(aead cipher.AEAD, nonce, ciphertext []byte) (*SecureBuffer, error) {
+	if len(ciphertext) < aead.Overhead() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	out, err := NewSecureBuffer(len(ciphertext) - aead.Overhead())
+	if err != nil {
+		return nil, err
+	}
+	dst := out.Bytes()
+	if _, err := aead.Open(dst[:0], nonce, ciphertext, nil); err != nil {
+		out.Destroy()
+		return nil, err
+	}
+	return out, nil
+}
+
+// wipe zeroes b. runtime.KeepAlive stops the compiler from treating the
+// stores as dead because nothing reads b afterwards.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
+
+// reportMemlockFailure explains an mlock failure once per process.
+func reportMemlockFailure(size int, err error) {
+	memlockWarnOnce.Do(func() {
+		fmt.Printf("⚠️  SECURE MEMORY: mlock of %d bytes failed: %v\n", size, err)
+		if limit, ok := memlockLimit(); ok {
+			fmt.Printf("   RLIMIT_MEMLOCK is %d bytes. Raise it with `ulimit -l unlimited`,\n", limit)
+			fmt.Println("   LimitMEMLOCK=infinity (systemd) or --ulimit memlock=-1 (docker).")
+		}
+		if secureMemStrict() {
+			fmt.Println("   SECURE_MEMORY=strict: allocations that cannot be locked are refused.")
+		} else {
+			fmt.Println("   Continuing with guarded but swappable buffers (set SECURE_MEMORY=strict to refuse).")
+		}
+	})
+}
+
+// checkMemlockLimit warns at startup when the lock limit cannot hold one
+// maximum-size upload plus its decrypted copy.
+func checkMemlockLimit() {
+	limit, ok := memlockLimit()
+	if !ok {
+		fmt.Printf("🔒 Secure memory: %s\n", secureMemBackend)
+		return
+	}
+	need := uint64(2*cfg.MaxUploadSize + 1<<20)
+	if limit < need {
+		fmt.Printf("⚠️  RLIMIT_MEMLOCK is %d bytes; %d are needed to lock a %v upload.\n", limit, need, cfg.MaxUploadSize)
+		fmt.Println("   Large uploads will use unlocked buffers. Raise the limit with `ulimit -l`.")
+		return
+	}
+	fmt.Printf("🔒 Secure memory: %s (RLIMIT_MEMLOCK %d bytes)\n", secureMemBackend, limit)
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var pageSize = os.Getpagesize()
+
+// NewSecureBuffer maps size bytes between two guard pages and locks them.
+// The data window is placed flush against the trailing guard page so that
+// even a one-byte overrun faults.
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("secure buffer: negative size %d", size)
+	}
+	inner := ((size + pageSize - 1) / pageSize) * pageSize
+	if inner == 0 {
+		inner = pageSize
+	}
+
+	region, err := unix.Mmap(-1, 0, inner+2*pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, fmt.Errorf("secure buffer: mmap of %d bytes failed: %w", inner+2*pageSize, err)
+	}
+
+	if err := unix.Mprotect(region[:pageSize], unix.PROT_NONE); err != nil {
+		unix.Munmap(region)
+		return nil, fmt.Errorf("secure buffer: guard page setup failed: %w", err)
+	}
+	if err := unix.Mprotect(region[pageSize+inner:], unix.PROT_NONE); err != nil {
+		unix.Munmap(region)
+		return nil, fmt.Errorf("secure buffer: guard page setup failed: %w", err)
+	}
+
+	body := region[pageSize : pageSize+inner]
+	_ = unix.Madvise(body, unix.MADV_DONTDUMP) // best effort: keep secrets out of core dumps
+
+	locked := true
+	if err := unix.Mlock(body); err != nil {
+		reportMemlockFailure(inner, err)
+		if secureMemStrict() {
+			unix.Munmap(region)
+			return nil, fmt.Errorf("secure buffer: cannot lock %d bytes (RLIMIT_MEMLOCK too low?): %w", inner, err)
+		}
+		locked = false
+	}
+
+	return &SecureBuffer{
+		region: region,
+		data:   body[inner-size : inner : inner],
+		locked: locked,
+	}, nil
+}
+
+func freeSecureRegion(region []byte, locked bool) {
+	body := region[pageSize : len(region)-pageSize]
+	if locked {
+		unix.Munlock(body)
+	}
+	unix.Munmap(region)
+}
+
+// memlockLimit returns the soft RLIMIT_MEMLOCK in bytes.
+func memlockLimit() (uint64, bool) {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &rl); err != nil {
+		return 0, false
+	}
+	if rl.Cur == unix.RLIM_INFINITY {
+		return math.MaxUint64, true
+	}
+	return rl.Cur, true
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+func init() { secureMemBackend = "heap (zeroize only — mlock unsupported on this OS)" }
+
+// NewSecureBuffer falls back to a heap slice on platforms without the Linux
+// mmap/mlock path. Destroy still zeroes it; it is neither locked nor guarded.
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	buf := make([]byte, size, size+1)
+	return &SecureBuffer{region: buf[:size+1], data: buf}, nil
+}
+
+func freeSecureRegion(region []byte, locked bool) {}
+
+func memlockLimit() (uint64, bool) { return 0, false }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/ecdsa"
@@ -10,6 +11,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
@@ -17,17 +19,14 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode/utf8"
-
-	"github.com/joho/godotenv"
 )
 
-// --- Package-level config loaded once at startup ---
+// --- Package-level config loaded once at startup (see config.go) ---
 var jwtSecret string
 var allowedOrigin string
 
@@ -49,29 +48,37 @@ type bucket struct {
 type rateLimiter struct {
 	mu       sync.RWMutex
 	visitors map[string]*bucket
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
-const (
-	rateLimitMax    = 30              // Max requests per 60-second window
-	rateLimitWindow = 60 * time.Second
-	maxUploadSize   = 10 * 1024 * 1024 // 10MB hard cap
-)
-
 var limiter = newRateLimiter()
 
 func newRateLimiter() *rateLimiter {
-	rl := &rateLimiter{visitors: make(map[string]*bucket)}
+	rl := &rateLimiter{
+		visitors: make(map[string]*bucket),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
 	go rl.cleanupLoop()
 	return rl
 }
 
 // cleanupLoop purges stale buckets every 5 minutes to prevent unbounded growth.
+// It returns when Stop is called.
 func (rl *rateLimiter) cleanupLoop() {
+	defer close(rl.stopped)
 	ticker := time.NewTicker(5 * time.Minute)
 	defer ticker.Stop()
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-rl.stop:
+			return
+		}
 		rl.mu.Lock()
-		cutoff := time.Now().Add(-rateLimitWindow * 2)
+		cutoff := time.Now().Add(-cfg.RateLimitWindow * 2)
 		for ip, b := range rl.visitors {
 			b.mu.Lock()
 			if b.windowStart.Before(cutoff) {
@@ -83,6 +90,12 @@ func (rl *rateLimiter) cleanupLoop() {
 	}
 }
 
+// Stop ends cleanupLoop and waits for it to return.
+func (rl *rateLimiter) Stop() {
+	rl.stopOnce.Do(func() { close(rl.stop) })
+	<-rl.stopped
+}
+
 func (rl *rateLimiter) allow(ip string) bool {
 	rl.mu.RLock()
 	b, ok := rl.visitors[ip]
@@ -102,13 +115,14 @@ func (rl *rateLimiter) allow(ip string) bool {
 	defer b.mu.Unlock()
 
 	now := time.Now()
-	if now.Sub(b.windowStart) >= rateLimitWindow {
+	if now.Sub(b.windowStart) >= cfg.RateLimitWindow {
 		// New window: reset counter.
 		b.count = 0
 		b.windowStart = now
 	}
 
-	if b.count >= rateLimitMax {
+	if b.count >= cfg.RateLimitMax {
+		metricRateLimited.inc()
 		return false
 	}
 	b.count++
@@ -116,10 +130,10 @@ func (rl *rateLimiter) allow(ip string) bool {
 }
 
 // extractIP returns the real client IP. It only trusts X-Forwarded-For when
-// the TRUSTED_PROXY env var is set to the proxy's CIDR (e.g. "10.0.0.0/8").
-// Without that env var it uses RemoteAddr directly, preventing IP spoofing.
+// trusted_proxy is set to the proxy's CIDR (e.g. "10.0.0.0/8"). Without it
+// it uses RemoteAddr directly, preventing IP spoofing.
 func extractIP(r *http.Request) string {
-	trustedProxy := os.Getenv("TRUSTED_PROXY")
+	trustedProxy := cfg.TrustedProxy
 	if trustedProxy != "" {
 		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
 			remoteHost, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -144,28 +158,17 @@ func extractIP(r *http.Request) string {
 }
 
 func loadServerConfig() {
-	// Try loading .env from CWD first, then fall back to the directory that
-	// contains the running executable. This makes the server work correctly
-	// regardless of which directory it is launched from.
-	if err := godotenv.Load(); err != nil {
-		exe, exeErr := os.Executable()
-		if exeErr == nil {
-			_ = godotenv.Load(filepath.Join(filepath.Dir(exe), ".env"))
-		}
-	}
+	printConfig(os.Stdout)
 
-	jwtSecret = os.Getenv("SUPABASE_JWT_SECRET")
+	jwtSecret = cfg.SupabaseJWTSecret
 	if jwtSecret == "" {
 		fmt.Println("⚠️  FATAL: SUPABASE_JWT_SECRET not set — all authenticated requests will be rejected.")
 		fmt.Println("   Ensure backend/.env exists and the server is started from the backend/ directory.")
 	} else {
-		fmt.Printf("✅ JWT secret loaded (%d chars, starts with: %.8s...)\n", len(jwtSecret), jwtSecret)
+		fmt.Printf("✅ JWT secret loaded (%d chars)\n", len(jwtSecret))
 	}
 
-	allowedOrigin = os.Getenv("ALLOWED_ORIGIN")
-	if allowedOrigin == "" {
-		allowedOrigin = "http://localhost:5173"
-	}
+	allowedOrigin = cfg.AllowedOrigin
 
 	fmt.Printf("🔐 JWT Auth enabled. CORS origin: %s\n", allowedOrigin)
 }
@@ -185,6 +188,44 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, apiError{Error: msg})
 }
 
+// writeUploadResponse marshals resp with an empty encryption_key and splices
+// the hex key in from locked memory while writing, so the key never becomes a
+// heap string. keyHex is nil whenever the client does not receive the key.
+func writeUploadResponse(w http.ResponseWriter, resp UploadResponse, keyHex *SecureBuffer) error {
+	return writeKeyedJSON(w, http.StatusOK, resp, keyHex)
+}
+
+// writeKeyedJSON is writeUploadResponse for any v that contains one
+// UploadResponse.
+func writeKeyedJSON(w http.ResponseWriter, status int, v interface{}, keyHex *SecureBuffer) error {
+	head, tail, err := splitAtKey(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(head)
+	w.Write(keyHex.Bytes())
+	w.Write(tail)
+	return nil
+}
+
+// splitAtKey marshals v and splits the JSON where the encryption_key value
+// goes.
+func splitAtKey(v interface{}) (head, tail []byte, err error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	const field = `"encryption_key":"`
+	i := bytes.Index(body, []byte(field+`"`))
+	if i < 0 {
+		return nil, nil, fmt.Errorf("encryption_key field missing from response")
+	}
+	split := i + len(field)
+	return body[:split], body[split:], nil
+}
+
 // --- JWKS Cache (for ES256 / ECC P-256 verification) ---
 //
 // Supabase migrated from Legacy HS256 (shared secret) to ECC P-256 keys.
@@ -225,7 +266,20 @@ func getJWKS() ([]jwkKey, error) {
 		return jwksCache, nil
 	}
 
-	supabaseURL := os.Getenv("SUPABASE_URL")
+	keys, err := fetchJWKS()
+	metricJWKSRefreshes.inc(outcomeLabel(err))
+	if err != nil {
+		return nil, err
+	}
+	jwksCache = keys
+	jwksFetchedAt = time.Now()
+	fmt.Printf("[JWKS] Loaded %d key(s) from Supabase\n", len(keys))
+	return jwksCache, nil
+}
+
+// fetchJWKS downloads the project's public keys; getJWKS caches them.
+func fetchJWKS() ([]jwkKey, error) {
+	supabaseURL := cfg.SupabaseURL
 	if supabaseURL == "" {
 		return nil, fmt.Errorf("SUPABASE_URL not set")
 	}
@@ -249,11 +303,7 @@ func getJWKS() ([]jwkKey, error) {
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, fmt.Errorf("JWKS parse failed: %w", err)
 	}
-
-	jwksCache = result.Keys
-	jwksFetchedAt = time.Now()
-	fmt.Printf("[JWKS] Loaded %d key(s) from Supabase\n", len(result.Keys))
-	return jwksCache, nil
+	return result.Keys, nil
 }
 
 // ecPublicKeyForKid finds the EC P-256 public key matching the given key ID.
@@ -312,25 +362,57 @@ type jwtClaims struct {
 	Exp   int64  `json:"exp"`
 	Iat   int64  `json:"iat"`
 	Iss   string `json:"iss"`
+	// AppMetadata is only writable with the service key, so it is safe to
+	// derive privileges from.
+	AppMetadata struct {
+		Role string `json:"role"`
+	} `json:"app_metadata"`
+	// EmailVerified is the OIDC email_verified claim. Access granted to an
+	// email address needs it (see verifiedEmail).
+	EmailVerified bool `json:"email_verified"`
+}
+
+// jwtError is a verifySupabaseJWT failure; reason is its metrics label.
+type jwtError struct {
+	reason string
+	err    error
+}
+
+func (e *jwtError) Error() string { return e.err.Error() }
+func (e *jwtError) Unwrap() error { return e.err }
+
+func jwtReject(reason, format string, args ...interface{}) error {
+	return &jwtError{reason: reason, err: fmt.Errorf(format, args...)}
+}
+
+// countJWTFailure records a refused bearer token under the reason carried by
+// err, or "invalid" if it carries none.
+func countJWTFailure(err error) {
+	reason := "invalid"
+	var je *jwtError
+	if errors.As(err, &je) {
+		reason = je.reason
+	}
+	metricJWTFailures.inc(reason)
 }
 
 func verifySupabaseJWT(tokenString string) (*jwtClaims, error) {
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("malformed token")
+		return nil, jwtReject("malformed", "malformed token")
 	}
 
 	// Decode header to determine algorithm and key ID.
 	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode header")
+		return nil, jwtReject("malformed", "failed to decode header")
 	}
 	var header struct {
 		Alg string `json:"alg"`
 		Kid string `json:"kid"`
 	}
 	if err := json.Unmarshal(headerBytes, &header); err != nil {
-		return nil, fmt.Errorf("failed to parse header")
+		return nil, jwtReject("malformed", "failed to parse header")
 	}
 
 	signingInput := parts[0] + "." + parts[1]
@@ -340,66 +422,66 @@ func verifySupabaseJWT(tokenString string) (*jwtClaims, error) {
 		// Modern Supabase ECC P-256 — verify via JWKS public key.
 		pubKey, err := ecPublicKeyForKid(header.Kid)
 		if err != nil {
-			return nil, fmt.Errorf("signing key unavailable: %w", err)
+			return nil, jwtReject("key_unavailable", "signing key unavailable: %w", err)
 		}
 		sigBytes, err := base64.RawURLEncoding.DecodeString(parts[2])
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode signature")
+			return nil, jwtReject("malformed", "failed to decode signature")
 		}
 		// ES256 JWT signatures are raw R || S (32 bytes each), not DER-encoded.
 		if len(sigBytes) != 64 {
-			return nil, fmt.Errorf("invalid ES256 signature length: %d", len(sigBytes))
+			return nil, jwtReject("signature", "invalid ES256 signature length: %d", len(sigBytes))
 		}
 		r := new(big.Int).SetBytes(sigBytes[:32])
 		s := new(big.Int).SetBytes(sigBytes[32:])
 		digest := sha256.Sum256([]byte(signingInput))
 		if !ecdsa.Verify(pubKey, digest[:], r, s) {
-			return nil, fmt.Errorf("invalid signature")
+			return nil, jwtReject("signature", "invalid signature")
 		}
 
 	case "HS256":
 		// Legacy shared-secret HMAC — still accepted for tokens issued before
 		// the project rotated to ECC.
 		if jwtSecret == "" {
-			return nil, fmt.Errorf("HS256 token received but SUPABASE_JWT_SECRET not set")
+			return nil, jwtReject("misconfigured", "HS256 token received but SUPABASE_JWT_SECRET not set")
 		}
 		mac := hmac.New(sha256.New, []byte(jwtSecret))
 		mac.Write([]byte(signingInput))
 		expected := mac.Sum(nil)
 		actual, err := base64.RawURLEncoding.DecodeString(parts[2])
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode signature")
+			return nil, jwtReject("malformed", "failed to decode signature")
 		}
 		if !hmac.Equal(actual, expected) {
-			return nil, fmt.Errorf("invalid signature")
+			return nil, jwtReject("signature", "invalid signature")
 		}
 
 	default:
-		return nil, fmt.Errorf("unsupported algorithm: %q", header.Alg)
+		return nil, jwtReject("unsupported_alg", "unsupported algorithm: %q", header.Alg)
 	}
 
 	// Decode payload.
 	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode payload")
+		return nil, jwtReject("malformed", "failed to decode payload")
 	}
 	var claims jwtClaims
 	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return nil, fmt.Errorf("failed to parse claims")
+		return nil, jwtReject("malformed", "failed to parse claims")
 	}
 
 	// 5-second clock-skew tolerance.
 	if claims.Exp > 0 && time.Now().Unix() > claims.Exp+5 {
-		return nil, fmt.Errorf("token expired")
+		return nil, jwtReject("expired", "token expired")
 	}
 
 	// Issuer must match the project's auth URL.
-	supabaseURL := os.Getenv("SUPABASE_URL")
+	supabaseURL := cfg.SupabaseURL
 	if supabaseURL == "" {
-		return nil, fmt.Errorf("server misconfiguration: SUPABASE_URL not set")
+		return nil, jwtReject("misconfigured", "server misconfiguration: SUPABASE_URL not set")
 	}
 	if claims.Iss != supabaseURL+"/auth/v1" {
-		return nil, fmt.Errorf("invalid issuer: %q", claims.Iss)
+		return nil, jwtReject("issuer", "invalid issuer: %q", claims.Iss)
 	}
 
 	return &claims, nil
@@ -434,17 +516,20 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
+			metricJWTFailures.inc("missing")
 			writeError(w, http.StatusUnauthorized, "Missing authorization header")
 			return
 		}
 
 		if !strings.HasPrefix(authHeader, "Bearer ") {
+			metricJWTFailures.inc("bad_format")
 			writeError(w, http.StatusUnauthorized, "Invalid authorization format")
 			return
 		}
 
 		token := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
 		if token == "" {
+			metricJWTFailures.inc("empty")
 			writeError(w, http.StatusUnauthorized, "Empty token")
 			return
 		}
@@ -452,6 +537,8 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		claims, err := verifySupabaseJWT(token)
 		if err != nil {
 			fmt.Printf("[Auth] Token rejected: %v\n", err)
+			countJWTFailure(err)
+			auditAuthFailure(extractIP(r), err.Error())
 			writeError(w, http.StatusUnauthorized, "Unauthorized")
 			return
 		}
@@ -460,6 +547,8 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		r.Header.Set("X-User-ID", claims.Sub)
 		r.Header.Set("X-User-Email", claims.Email)
+		r.Header.Set("X-User-Email-Verified", strconv.FormatBool(claims.EmailVerified))
+		r.Header.Set("X-User-Role", claims.AppMetadata.Role)
 
 		next(w, r)
 	}
@@ -473,9 +562,9 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Expose-Headers", "X-Integrity-Verified, Content-Disposition")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Integrity-Verified, X-Chain-Released, Content-Disposition, Location")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
@@ -492,15 +581,49 @@ func protect(handler http.HandlerFunc) http.HandlerFunc {
 	return enableCORS(securityHeaders(rateLimit(authMiddleware(handler))))
 }
 
+// public is protect without authentication, for endpoints whose request
+// carries its own credential.
+func public(handler http.HandlerFunc) http.HandlerFunc {
+	return enableCORS(securityHeaders(rateLimit(handler)))
+}
+
 // --- Server Startup ---
 
 func startServer() {
 	loadServerConfig()
 	initIPFSConfig()
+	initKeyProvider()
+	initTimeSource()
+	initVaultStore()
+	initUnpinQueue()
+	initAuditLog()
+	initUploadJobs()
+	initRetention()
+	initGeoLock()
+	initMailer()
+	initNotifier()
+	checkMemlockLimit()
+	defer keyProvider.Close()
+
+	go runDeadManScheduler()
+	go runReaper()
+	go runDeliveryScheduler()
+	go unpins.run()
+	go runAuditCheckpoints()
+	go runAuthFailureFlush()
+	go jobs.run()
 
 	http.HandleFunc("/upload", protect(uploadHandler))
 	http.HandleFunc("/retrieve", protect(retrieveHandler))
 	http.HandleFunc("/delete", protect(deleteHandler))
+	http.HandleFunc("/vault/checkin", protect(checkinHandler))
+	http.HandleFunc("/vault/release", protect(releaseHandler))
+	http.HandleFunc("/vault/chain", protect(chainHandler))
+	http.HandleFunc("/vault/hold", protect(holdHandler))
+	http.HandleFunc("/vault/approve", protect(approveHandler))
+	http.HandleFunc("/vault/policy", protect(policyHandler))
+	http.HandleFunc("/vault/deliveries", protect(deliveriesHandler))
+	http.HandleFunc("/vault/collect", public(collectHandler))
 	http.HandleFunc("/api/trigger-facial-auth", protect(triggerFacialAuthHandler))
 	http.HandleFunc("/api/trigger-emotional-auth", protect(triggerEmotionalAuthHandler))
 	
@@ -508,16 +631,29 @@ func startServer() {
 	http.HandleFunc("/api/enroll-facial-auth", protect(enrollFacialAuthHandler))
 	http.HandleFunc("/api/enroll-emotional-auth", protect(enrollEmotionalAuthHandler))
 
-	fmt.Println("🌐 Web3 DSN Server started on http://localhost:8080")
+	// Versioned REST API (see api.go).
+	registerAPI()
+
+	// Prometheus scrape endpoint (see metrics.go); not rate limited.
+	registerMetrics()
+
+	// Typed, streaming API for internal services (see grpc.go).
+	grpcServer := startGRPC()
+
+	fmt.Printf("🌐 Web3 DSN Server started on %s\n", cfg.HTTPAddr)
 	server := &http.Server{
-		Addr:         ":8080",
+		Addr:         cfg.HTTPAddr,
 		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 120 * time.Second, // Long for IPFS uploads
+		WriteTimeout: 120 * time.Second, // Long for synchronous IPFS uploads; see jobs.go
 		IdleTimeout:  60 * time.Second,
 	}
-	if err := server.ListenAndServe(); err != nil {
-		fmt.Printf("Error starting server: %v\n", err)
-	}
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+	waitForShutdown(server, grpcServer, serveErr)
 }
 
 // sanitizeFilename produces a safe basename with no path components.
@@ -572,6 +708,30 @@ type UploadResponse struct {
 	EncryptionKey   string `json:"encryption_key"`
 	FileName        string `json:"file_name"`
 	ManifestContent string `json:"manifest_content"`
+	KeyWrap         string `json:"key_wrap,omitempty"`
+	VaultID         string `json:"vault_id"`
+	UnlockAt        string `json:"unlock_at,omitempty"`
+	ExpiresAt       string `json:"expires_at,omitempty"`
+	PuzzleSquarings uint64 `json:"puzzle_squarings,omitempty"`
+
+	NextWindow *windowInfo `json:"next_window,omitempty"` // of a scheduled vault
+}
+
+// uploadRequest is a parsed /upload form. parseUpload checks everything that
+// can be checked up front, so run only fails for server-side reasons and can
+// finish after the request has returned (see jobs.go).
+type uploadRequest struct {
+	plaintext   *SecureBuffer
+	rec         *VaultRecord // the vault to register, less what run fills in
+	kemPub      *HybridPublicKey
+	withhold    bool
+	escrow      bool
+	puzzleDelay time.Duration
+}
+
+// returnsKey reports whether the client gets the data key in the response.
+func (u *uploadRequest) returnsKey() bool {
+	return u.kemPub == nil && !u.withhold && u.puzzleDelay == 0
 }
 
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
@@ -580,59 +740,405 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Enforce upload size limit (10MB)
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	u := parseUpload(w, r)
+	if u == nil {
+		return
+	}
+	if v := r.FormValue("async"); v == "true" || v == "1" {
+		submitUploadJob(w, r, u)
+		return
+	}
+	defer u.plaintext.Destroy()
+
+	resp, key, err := u.run(nil)
+	if errors.Is(err, errShuttingDown) {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer key.Destroy()
+
+	// Hex-encode into locked memory too, then burn the raw key. The hex key is
+	// spliced into the JSON body by writeUploadResponse so no heap string of
+	// it is ever created.
+	keyHex, err := hexKey(key)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to allocate key buffer")
+		return
+	}
+	defer keyHex.Destroy()
+	key.Destroy()
 
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
-		writeError(w, http.StatusRequestEntityTooLarge, "File exceeds 10MB limit")
+	w.Header().Set("Location", "/v1/vaults/"+resp.VaultID)
+	if err := writeUploadResponse(w, *resp, keyHex); err != nil {
+		fmt.Printf("[Web3 Upload] Response encoding failed: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "Failed to encode response")
 		return
 	}
+	fmt.Printf("[Web3 Upload] Success. Merkle Root: %s\n", resp.RootHash[:10])
+	auditEvent(r, "upload", resp.VaultID, auditOutcomeSuccess, resp.FileName)
+}
+
+// parseUpload reads the /upload form. It writes the error response and
+// returns nil if the form is invalid; otherwise the caller owns u.plaintext.
+func parseUpload(w http.ResponseWriter, r *http.Request) *uploadRequest {
+	// Enforce the upload size limit (max_upload_size)
+	r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxUploadSize))
+
+	if err := r.ParseMultipartForm(int64(cfg.MaxUploadSize)); err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds %v limit", cfg.MaxUploadSize))
+		return nil
+	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "Missing or invalid file")
-		return
+		return nil
 	}
 	defer file.Close()
 
+	fmt.Printf("\n[Web3 Upload] User: %s | Processing: %s\n", r.Header.Get("X-User-ID"), header.Filename)
+
+	u := parseUploadOptions(w, r, header.Filename)
+	if u == nil {
+		return nil
+	}
+
+	// Plaintext goes straight into locked, guarded memory (see securemem.go).
+	// It is read last so that nothing before it has to release it.
+	if u.plaintext, err = readSecure(file, header.Size); err != nil {
+		fmt.Printf("[Web3 Upload] Secure read failed: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "Failed to read file")
+		return nil
+	}
+	return u
+}
+
+// parseUploadOptions reads the rest of the /upload form. The gRPC Upload
+// calls it with the header's options as r.Form (see grpc.go). It writes the
+// error response and returns nil if an option is invalid.
+func parseUploadOptions(w http.ResponseWriter, r *http.Request, name string) *uploadRequest {
 	userID := r.Header.Get("X-User-ID")
-	fmt.Printf("\n[Web3 Upload] User: %s | Processing: %s\n", userID, header.Filename)
+	fileName := sanitizeFilename(name)
+	var err error
+
+	// Optional hybrid post-quantum wrapping: when the client supplies its
+	// X25519+ML-KEM public key, the data key is only ever returned wrapped
+	// inside the manifest.
+	var kemPub *HybridPublicKey
+	if pubField := r.FormValue("kem_public_key"); pubField != "" {
+		kemPub, err = ParseHybridPublicKey([]byte(pubField))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid hybrid public key")
+			return nil
+		}
+	}
 
-	data, err := io.ReadAll(file)
+	// Optional time lock: the key is escrowed server-side and never returned
+	// (see timelock.go). A hybrid-wrapped copy in the manifest would let the
+	// holder bypass the lock, so the two modes are exclusive.
+	var unlockAt *time.Time
+	if v := r.FormValue("unlock_at"); v != "" {
+		if kemPub != nil {
+			writeError(w, http.StatusBadRequest, "unlock_at cannot be combined with kem_public_key")
+			return nil
+		}
+		t, err := parseUnlockAt(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		unlockAt = &t
+	}
+
+	// Optional recurring unlock windows (see schedule.go), escrowed likewise.
+	schedule, err := parseSchedule(r)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to read file")
-		return
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	// Optional geofence (see geolock.go). Also escrowed, for the same reason.
+	var fence *GeoFence
+	if v := r.FormValue("geofence"); v != "" {
+		if kemPub != nil {
+			writeError(w, http.StatusBadRequest, "geofence cannot be combined with kem_public_key")
+			return nil
+		}
+		if fence, err = parseGeoFence(v); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+	}
+
+	// Optional dead man's switch (see deadman.go). The owner still gets the
+	// key; the escrowed copy is for the beneficiaries.
+	deadMan, err := parseDeadManSwitch(r, time.Now().UTC())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	// Optional chain (see chain.go): sealed until its predecessors unlock.
+	chain, err := parseChainAfter(r.FormValue("chain_after"), userID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	// Optional M-of-N approvals (see approval.go).
+	approval, err := parseApprovalPolicy(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	// Optional declarative unlock policy (see policy.go).
+	var policy []byte
+	policyOneTime := false
+	if v := r.FormValue("policy"); v != "" {
+		compiled, err := uploadPolicy(v, approval != nil)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		policy, policyOneTime = compiled, compiledOneTime(compiled)
 	}
 
-	fileName := sanitizeFilename(header.Filename)
+	// Optional retention (see retention.go).
+	expiresAt, err := parseRetention(r, time.Now().UTC())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+
+	// Optional burn-after-read (see burn.go).
+	oneTime := policyOneTime || r.FormValue("one_time") == "true" || r.FormValue("one_time") == "1"
+	if oneTime && deadMan != nil {
+		// /vault/release hands the key out on every call.
+		writeError(w, http.StatusBadRequest, "A dead man's switch cannot be combined with one_time")
+		return nil
+	}
+
+	// Optional scheduled delivery (see delivery.go). Like a dead man's
+	// switch, the owner keeps the key and the escrowed copy is for the
+	// recipients.
+	delivery, err := parseDelivery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	if delivery != nil {
+		if oneTime {
+			writeError(w, http.StatusBadRequest, "Scheduled delivery cannot be combined with one_time")
+			return nil
+		}
+		if mailer == nil {
+			writeError(w, http.StatusServiceUnavailable, "Scheduled delivery is not available: no SMTP relay configured")
+			return nil
+		}
+	}
+
+	withhold := unlockAt != nil || schedule != nil || fence != nil || chain != nil || approval != nil || policy != nil || oneTime
+	escrow := withhold || deadMan != nil || delivery != nil
+	if withhold && kemPub != nil {
+		writeError(w, http.StatusBadRequest, "Server-enforced locks cannot be combined with kem_public_key")
+		return nil
+	}
+	if escrow {
+		if _, err := keyProvider.WrapKey(make([]byte, 32)); err != nil {
+			fmt.Printf("[Web3 Upload] Key escrow unavailable: %v\n", err)
+			writeError(w, http.StatusServiceUnavailable, "Server-enforced locks are not available: server has no key-encryption key")
+			return nil
+		}
+	}
+
+	// Optional RSW puzzle (see puzzle.go): the key is sealed in the manifest
+	// and opens offline after roughly puzzle_delay of sequential work.
+	var puzzleDelay time.Duration
+	if v := r.FormValue("puzzle_delay"); v != "" {
+		if kemPub != nil || withhold {
+			writeError(w, http.StatusBadRequest, "puzzle_delay cannot be combined with kem_public_key or a server-enforced lock (unlock_at, schedule, geofence, chain_after, approvers, policy or one_time)")
+			return nil
+		}
+		if puzzleDelay, err = time.ParseDuration(v); err != nil {
+			secs, convErr := strconv.ParseInt(v, 10, 64)
+			if convErr != nil {
+				writeError(w, http.StatusBadRequest, "puzzle_delay must be a duration (e.g. 720h) or seconds")
+				return nil
+			}
+			puzzleDelay = time.Duration(secs) * time.Second
+		}
+		if puzzleDelay < time.Second || puzzleDelay > puzzleMaxDelay {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("puzzle_delay must be between 1s and %v", puzzleMaxDelay))
+			return nil
+		}
+	}
+
+	vaultID, err := newVaultID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to allocate vault ID")
+		return nil
+	}
+
+	return &uploadRequest{
+		rec: &VaultRecord{
+			ID:         vaultID,
+			Owner:      userID,
+			OwnerEmail: r.Header.Get("X-User-Email"),
+			FileName:   fileName,
+			UnlockAt:   unlockAt,
+			Schedule:   schedule,
+			GeoFence:   fence,
+			DeadMan:    deadMan,
+			Chain:      chain,
+			Approval:   approval,
+			Delivery:   delivery,
+			Policy:     policy,
+			OneTime:    oneTime,
+			ExpiresAt:  expiresAt,
+		},
+		kemPub:      kemPub,
+		withhold:    withhold,
+		escrow:      escrow,
+		puzzleDelay: puzzleDelay,
+	}
+}
+
+// run encrypts and pins the file and registers the vault. It returns the raw
+// data key when returnsKey; the caller must Destroy it. Errors are fit for
+// the client; the details are logged.
+func (u *uploadRequest) run(hooks *pipelineHooks) (*UploadResponse, *SecureBuffer, error) {
+	rec := u.rec
+
+	started, outcome := time.Now(), "error"
+	defer func() {
+		metricUploadDuration.observe(time.Since(started).Seconds(), outcome)
+	}()
 
-	originalHash, rootHash, manifestContent, key, err := EncryptAndStore(data, fileName)
+	// A shutdown waits for the pipeline, or cancels ctx and waits for the
+	// rollbacks below.
+	ctx, done, err := pipelines.begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer done()
+
+	originalHash, rootHash, manifestContent, key, err := EncryptAndStore(ctx, u.plaintext.Bytes(), rec.FileName, hooks)
 	if err != nil {
 		fmt.Printf("[Web3 Upload] FAILED: %v\n", err)
-		writeError(w, http.StatusInternalServerError, "Encryption pipeline failed")
-		return
+		if ctx.Err() != nil {
+			return nil, nil, errShuttingDown
+		}
+		return nil, nil, errors.New("Encryption pipeline failed")
+	}
+	keep := false
+	defer func() {
+		if !keep {
+			key.Destroy()
+		}
+	}()
+
+	// The chunks are pinned from here on. If the vault doesn't get
+	// registered, queue them for unpinning rather than leave them orphaned.
+	registered := false
+	defer func() {
+		if !registered {
+			if err := unpins.Enqueue(rec.ID, manifestCIDs(manifestContent)); err != nil {
+				fmt.Printf("[Web3 Upload] Rollback enqueue FAILED: %v\n", err)
+			}
+		}
+	}()
+
+	keyWrap := ""
+	if u.kemPub != nil {
+		wrapped, err := WrapDataKey(u.kemPub, key.Bytes())
+		if err != nil {
+			fmt.Printf("[Web3 Upload] Key wrap FAILED: %v\n", err)
+			return nil, nil, errors.New("Key wrapping failed")
+		}
+		manifestContent = insertManifestHeaders(manifestContent, wrapped.ManifestHeaders())
+		keyWrap = wrapped.Suite
 	}
 
-	// Encode and then burn the raw key bytes.
-	// runtime.KeepAlive prevents the GC from collecting the slice before the
-	// zeroing loop runs; without it the compiler is free to elide the loop as
-	// dead code because nothing reads the values after they are zeroed.
-	keyHex := hex.EncodeToString(key)
-	for i := range key {
-		key[i] = 0
+	var puzzleSquarings uint64
+	if u.puzzleDelay > 0 {
+		pz, err := CreatePuzzle(key.Bytes(), u.puzzleDelay)
+		if err != nil {
+			fmt.Printf("[Web3 Upload] Puzzle creation FAILED: %v\n", err)
+			return nil, nil, errors.New("Time-lock puzzle creation failed")
+		}
+		manifestContent = insertManifestHeaders(manifestContent, pz.ManifestHeaders())
+		keyWrap = pz.Suite
+		puzzleSquarings = pz.T
 	}
-	runtime.KeepAlive(key)
 
-	resp := UploadResponse{
+	manifestContent = insertManifestHeaders(manifestContent, manifestVaultIDPrefix+rec.ID+"\n")
+
+	manifestContent, err = signManifest(manifestContent)
+	if err != nil {
+		fmt.Printf("[Web3 Upload] Manifest signing FAILED: %v\n", err)
+		return nil, nil, errors.New("Manifest signing failed")
+	}
+
+	rec.RootHash = rootHash
+	rec.OriginalHash = originalHash
+	rec.CIDs = manifestCIDs(manifestContent)
+	rec.CreatedAt = time.Now().UTC()
+	rec.Manifest = manifestContent
+	if u.escrow {
+		rec.EscrowedKey, err = keyProvider.WrapKey(key.Bytes())
+		if err != nil {
+			fmt.Printf("[Web3 Upload] Key escrow FAILED: %v\n", err)
+			return nil, nil, errors.New("Key escrow failed")
+		}
+	}
+	if err := vaults.Create(rec); err != nil {
+		fmt.Printf("[Web3 Upload] Vault registry write FAILED: %v\n", err)
+		return nil, nil, errors.New("Failed to register vault")
+	}
+	registered = true
+	outcome = "ok"
+	metricBytes.add(float64(u.plaintext.Len()), "upload")
+
+	resp := &UploadResponse{
 		OriginalHash:    originalHash,
 		RootHash:        rootHash,
-		EncryptionKey:   keyHex,
-		FileName:        fileName,
+		FileName:        rec.FileName,
 		ManifestContent: manifestContent,
+		KeyWrap:         keyWrap,
+		VaultID:         rec.ID,
+		PuzzleSquarings: puzzleSquarings,
+	}
+	if rec.UnlockAt != nil {
+		resp.UnlockAt = rec.UnlockAt.Format(time.RFC3339)
+	}
+	resp.NextWindow = nextWindow(rec, windowClock())
+	if exp := rec.EffectiveExpiry(); exp != nil {
+		resp.ExpiresAt = exp.Format(time.RFC3339)
 	}
+	if !u.returnsKey() {
+		return resp, nil, nil
+	}
+	keep = true
+	return resp, key, nil
+}
 
-	writeJSON(w, http.StatusOK, resp)
-	fmt.Printf("[Web3 Upload] Success. Merkle Root: %s\n", rootHash[:10])
+// hexKey hex-encodes key into locked memory. A nil key gives a nil buffer.
+func hexKey(key *SecureBuffer) (*SecureBuffer, error) {
+	if key == nil {
+		return nil, nil
+	}
+	keyHex, err := NewSecureBuffer(hex.EncodedLen(key.Len()))
+	if err != nil {
+		return nil, err
+	}
+	hex.Encode(keyHex.Bytes(), key.Bytes())
+	return keyHex, nil
 }
 
 // --- AI Vault Trigger Handlers ---
@@ -644,7 +1150,8 @@ func triggerFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var reqBody struct {
-		PIN string `json:"pin"`
+		PIN     string `json:"pin"`
+		VaultID string `json:"vault_id"` // optional: counts as unlocking this vault
 	}
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -656,6 +1163,11 @@ func triggerFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 		userID = "guest"
 	}
 
+	vault, ok := chainPrecheck(w, reqBody.VaultID, userID)
+	if !ok {
+		return
+	}
+
 	fmt.Printf("\n[Web3 AI Ops] 🔒 Launching Facial Recognition Protocol for user: %s\n", userID)
 	
 	cmd := exec.Command("python", "../vaults/facial_recognition/verify.py", "--user-id", userID)
@@ -672,6 +1184,7 @@ func triggerFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
 	cmd.Stderr = os.Stderr
 
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to start AI process")
 		return
@@ -683,7 +1196,7 @@ func triggerFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(stdinPipe, reqBody.PIN+"\n")
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	if err := observeAIProcess("facial_verify", started, cmd.Wait()); err != nil {
 		fmt.Printf("\n❌ Facial Scan Process Exited: %v\n", err)
 		writeError(w, http.StatusInternalServerError, "Facial scan process interrupted or failed.")
 		return
@@ -700,12 +1213,25 @@ func triggerFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 		if err := json.Unmarshal([]byte(jsonStr), &result); err == nil {
 			if status, ok := result["status"].(string); ok && status == "VAULT_UNLOCKED" {
 				fmt.Println("\n✅ [Web3 AI Ops] Hardware verification success! Forwarding AES constraints to frontend.")
+				if vault != nil {
+					// The scan is one factor; the vault counts as unlocked
+					// only if its whole policy now passes.
+					recordFactor(vault.ID, userID, "facial")
+					released, policy, unlocked := unlockThroughPolicy(r, vault.ID, "facial-auth")
+					result["vault_unlocked"], result["chain_released"] = unlocked, released
+					if !unlocked && policy != nil {
+						result["policy"] = policy
+					}
+				}
 				writeJSON(w, http.StatusOK, result)
 				return
 			}
 		}
 	}
 
+	if vault != nil {
+		auditEvent(r, "unlock", vault.ID, auditOutcomeDenied, "facial-auth: verification failed")
+	}
 	writeError(w, http.StatusForbidden, "Biometric authentication failed or access denied.")
 }
 
@@ -716,7 +1242,8 @@ func triggerEmotionalAuthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var reqBody struct {
-		Text string `json:"text"`
+		Text    string `json:"text"`
+		VaultID string `json:"vault_id"` // optional: counts as unlocking this vault
 	}
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -728,6 +1255,11 @@ func triggerEmotionalAuthHandler(w http.ResponseWriter, r *http.Request) {
 		userID = "guest"
 	}
 
+	vault, ok := chainPrecheck(w, reqBody.VaultID, userID)
+	if !ok {
+		return
+	}
+
 	fmt.Printf("\n[Web3 AI Ops] 🧠 Launching Emotional State Protocol for user: %s\n", userID)
 
 	cmd := exec.Command("python", "../vaults/emotional_state/verify.py", "--user-id", userID)
@@ -743,6 +1275,7 @@ func triggerEmotionalAuthHandler(w http.ResponseWriter, r *http.Request) {
 	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
 	cmd.Stderr = os.Stderr
 
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to start NLP process")
 		return
@@ -754,7 +1287,7 @@ func triggerEmotionalAuthHandler(w http.ResponseWriter, r *http.Request) {
 		io.WriteString(stdinPipe, reqBody.Text+"\n")
 	}()
 
-	if err := cmd.Wait(); err != nil {
+	if err := observeAIProcess("emotional_verify", started, cmd.Wait()); err != nil {
 		fmt.Printf("\n❌ Emotional NLP Process Exited: %v\n", err)
 		writeError(w, http.StatusInternalServerError, "NLP process interrupted or failed.")
 		return
@@ -770,12 +1303,23 @@ func triggerEmotionalAuthHandler(w http.ResponseWriter, r *http.Request) {
 		if err := json.Unmarshal([]byte(jsonStr), &result); err == nil {
 			if status, ok := result["status"].(string); ok && status == "VAULT_UNLOCKED" {
 				fmt.Println("\n✅ [Web3 AI Ops] NLP Sentiment Check success! Forwarding state to frontend.")
+				if vault != nil {
+					recordFactor(vault.ID, userID, "emotional")
+					released, policy, unlocked := unlockThroughPolicy(r, vault.ID, "emotional-auth")
+					result["vault_unlocked"], result["chain_released"] = unlocked, released
+					if !unlocked && policy != nil {
+						result["policy"] = policy
+					}
+				}
 				writeJSON(w, http.StatusOK, result)
 				return
 			}
 		}
 	}
 
+	if vault != nil {
+		auditEvent(r, "unlock", vault.ID, auditOutcomeDenied, "emotional-auth: verification failed")
+	}
 	writeError(w, http.StatusForbidden, "Emotional state authentication failed or access denied.")
 }
 
@@ -811,6 +1355,7 @@ func enrollFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 	cmd.Stdout = io.MultiWriter(os.Stdout, &stdoutBuf)
 	cmd.Stderr = os.Stderr
 
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to start AI process")
 		return
@@ -818,7 +1363,7 @@ func enrollFacialAuthHandler(w http.ResponseWriter, r *http.Request) {
 
 	go func() { defer stdinPipe.Close(); io.WriteString(stdinPipe, reqBody.PIN+"\n"+reqBody.PIN+"\n") }()
 
-	if err := cmd.Wait(); err != nil {
+	if err := observeAIProcess("facial_enroll", started, cmd.Wait()); err != nil {
 		fmt.Printf("\n❌ Facial Enrollment Process Exited: %v\n", err)
 		writeError(w, http.StatusInternalServerError, "Facial enrollment process interrupted.")
 		return
@@ -864,8 +1409,13 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+	started, outcome := time.Now(), "error"
+	defer func() {
+		metricRetrieveDuration.observe(time.Since(started).Seconds(), outcome)
+	}()
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxUploadSize))
+	if err := r.ParseMultipartForm(int64(cfg.MaxUploadSize)); err != nil {
 		writeError(w, http.StatusRequestEntityTooLarge, "Request too large")
 		return
 	}
@@ -889,20 +1439,6 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// --- Read key file (required) ---
-	keyFile, _, err := r.FormFile("key_file")
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Missing key file")
-		return
-	}
-	defer keyFile.Close()
-
-	keyBytes, err := io.ReadAll(keyFile)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "Failed to read key file")
-		return
-	}
-
 	// --- Read manifest (required) ---
 	manifestFile, _, err := r.FormFile("manifest_file")
 	if err != nil {
@@ -920,11 +1456,173 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 
 	originalHash := r.FormValue("original_hash")
 
-	// Parse Key (hex-encoded or raw)
-	key := keyBytes
-	decodedKey, err := hex.DecodeString(string(keyBytes))
-	if err == nil && len(decodedKey) == 32 {
-		key = decodedKey
+	// --- Verify the server's manifest signature (if present) ---
+	signed, err := verifyManifestSignature(manifestData)
+	if err != nil {
+		fmt.Printf("[Web3 Retrieve] Manifest signature rejected: %v\n", err)
+		writeError(w, http.StatusForbidden, "Manifest signature verification failed")
+		return
+	}
+
+	// --- Look up the vault record ---
+	// The Vault-ID header is only a hint: an unknown ID is looked up by root
+	// hash too, so editing the header can't detach a manifest from its
+	// vault's checks. Vaults unknown to this server's registry fall through
+	// to client-held keys.
+	var rec *VaultRecord
+	if id := manifestVaultID(manifestData); id != "" {
+		if !isValidVaultID(id) {
+			writeError(w, http.StatusBadRequest, "Manifest Vault-ID is invalid")
+			return
+		}
+		if rec, err = vaults.Get(id); err == nil && rec.RootHash != rootHash {
+			writeError(w, http.StatusForbidden, "Root hash does not match the vault record")
+			return
+		}
+	}
+	if rec == nil {
+		rec = vaultByRootHash(rootHash)
+	}
+
+	// A registered vault whose manifest was issued signed only accepts it
+	// signed: stripping the signature would otherwise re-enable editing.
+	if rec != nil && !signed && isSignedManifest(rec.Manifest) {
+		fmt.Printf("[Web3 Retrieve] Unsigned manifest for signed vault %s\n", rec.ID)
+		auditEvent(r, "retrieve", rec.ID, auditOutcomeDenied, "manifest signature missing")
+		writeError(w, http.StatusForbidden, "Manifest signature verification failed")
+		return
+	}
+
+	// --- Enforce ownership and server-side policies ---
+	// Every attempt on a registered vault is audited (see audit.go).
+	vaultID := ""
+	if rec != nil {
+		vaultID = rec.ID
+		if !checkAccess(w, r, rec, accessRetrieve) {
+			return
+		}
+		if err := checkRetention(w, rec); err != nil {
+			fmt.Printf("[Web3 Retrieve] Refused: %v\n", err)
+			auditEvent(r, "retrieve", vaultID, auditOutcomeDenied, err.Error())
+			return
+		}
+		if err := checkUnlockPolicy(w, r, rec); err != nil {
+			fmt.Printf("[Web3 Retrieve] Refused: %v\n", err)
+			auditEvent(r, "retrieve", vaultID, auditOutcomeDenied, err.Error())
+			return
+		}
+	}
+
+	// --- Claim one-time vaults (see burn.go) ---
+	// The claim is abandoned on every early return below and turned into
+	// consumption only after a successful decryption.
+	var claim string
+	if rec != nil && rec.OneTime {
+		if err := checkMutable(rec); err != nil {
+			fmt.Printf("[Web3 Retrieve] Refused one-time vault %s: %v\n", rec.ID, err)
+			auditEvent(r, "retrieve", vaultID, auditOutcomeDenied, err.Error())
+			writeLegalHold(w, rec)
+			return
+		}
+		if claim, err = claimOneTime(rec.ID); err != nil {
+			fmt.Printf("[Web3 Retrieve] Refused one-time vault %s: %v\n", rec.ID, err)
+			auditEvent(r, "retrieve", vaultID, auditOutcomeDenied, err.Error())
+			writeConsumed(w, rec, err)
+			return
+		}
+		claimedID := rec.ID
+		defer func() {
+			if claim != "" {
+				abandonOneTime(claimedID, claim)
+			}
+		}()
+		// Re-read: the escrowed key may have been destroyed while we waited.
+		if rec, err = vaults.Get(rec.ID); err != nil || rec.EscrowedKey == nil {
+			writeError(w, http.StatusGone, "One-time vault has already been read and destroyed")
+			return
+		}
+	}
+
+	// --- Resolve the data key ---
+	// Time-, geo- and chain-locked vaults use the server's escrowed key. Hybrid-wrapped
+	// manifests carry the key themselves and need the recipient's private
+	// key; plain manifests need the key file.
+	wrapped, err := ParseManifestKeyWrap(manifestData)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Manifest key-wrap headers are invalid")
+		return
+	}
+
+	// Keys are read into locked memory and destroyed when the handler returns.
+	var key *SecureBuffer
+	defer func() { key.Destroy() }()
+	if rec != nil && rec.KeyWithheld() {
+		unwrapped, err := keyProvider.UnwrapKey(rec.EscrowedKey)
+		if err != nil {
+			fmt.Printf("[Web3 Retrieve] Escrowed key unwrap failed: %v\n", err)
+			writeError(w, http.StatusInternalServerError, "Failed to release escrowed key")
+			return
+		}
+		if key, err = NewSecureBufferFrom(unwrapped); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to allocate key buffer")
+			return
+		}
+	} else if wrapped != nil {
+		kemKeyFile, kemKeyHeader, err := r.FormFile("kem_key_file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Missing hybrid private key file for wrapped vault")
+			return
+		}
+		defer kemKeyFile.Close()
+
+		kemKey, err := readSecure(kemKeyFile, kemKeyHeader.Size)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read hybrid private key file")
+			return
+		}
+		priv, err := ParseHybridPrivateKey(kemKey.Bytes())
+		kemKey.Destroy()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid hybrid private key")
+			return
+		}
+		unwrapped, err := UnwrapDataKey(priv, wrapped)
+		if err != nil {
+			fmt.Printf("[Web3 Retrieve] Key unwrap failed: %v\n", err)
+			writeError(w, http.StatusForbidden, "Key unwrap failed — incorrect private key or tampered manifest")
+			return
+		}
+		if key, err = NewSecureBufferFrom(unwrapped); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to allocate key buffer")
+			return
+		}
+	} else {
+		keyFile, keyHeader, err := r.FormFile("key_file")
+		if err != nil {
+			if pz, _ := ParseManifestPuzzle(manifestData); pz != nil {
+				writeError(w, http.StatusBadRequest, "Missing key file — puzzle-locked vaults need the key from `solve-puzzle`")
+				return
+			}
+			writeError(w, http.StatusBadRequest, "Missing key file")
+			return
+		}
+		defer keyFile.Close()
+
+		if keyHeader.Size > 1024 {
+			writeError(w, http.StatusBadRequest, "Key file too large")
+			return
+		}
+		keyRaw, err := readSecure(keyFile, keyHeader.Size)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Failed to read key file")
+			return
+		}
+
+		// Parse Key (hex-encoded or raw)
+		if key, err = decodeSecureKey(keyRaw); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to allocate key buffer")
+			return
+		}
 	}
 
 	if len(rootHash) < 10 {
@@ -991,12 +1689,13 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 	calculatedRoot := BuildMerkleTree(loadedCIDs)
 	if calculatedRoot == nil || calculatedRoot.Hash != rootHash {
 		fmt.Println("Integrity Check Failed: Root Hash Mismatch or empty chunk list")
+		auditEvent(r, "retrieve", vaultID, auditOutcomeFailed, "integrity check failed: root hash mismatch")
 		writeError(w, http.StatusForbidden, "Integrity verification failed")
 		return
 	}
 
-	// 4. Decrypt
-	block, err := aes.NewCipher(key)
+	// 4. Decrypt (plaintext is opened directly into locked memory)
+	block, err := aes.NewCipher(key.Bytes())
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid encryption key")
 		return
@@ -1012,11 +1711,14 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	nonce, ciphertext := assembledEncryptedData[:nonceSize], assembledEncryptedData[nonceSize:]
-	decryptedData, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := openSecure(gcm, nonce, ciphertext)
 	if err != nil {
+		auditEvent(r, "retrieve", vaultID, auditOutcomeFailed, "decryption failed")
 		writeError(w, http.StatusForbidden, "Decryption failed — incorrect key or corrupted data")
 		return
 	}
+	defer plaintext.Destroy()
+	decryptedData := plaintext.Bytes()
 
 	// 5. Verify Original Hash
 	verified := false
@@ -1031,12 +1733,33 @@ func retrieveHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Integrity-Verified", "unavailable")
 	}
 
+	// Burn a one-time vault before a single byte of plaintext leaves.
+	if claim != "" {
+		if err := consumeOneTime(rec.ID, claim); err != nil {
+			fmt.Printf("[Web3 Retrieve] One-time consume failed: %v\n", err)
+			writeError(w, http.StatusConflict, "One-time vault was claimed by another request")
+			return
+		}
+		claim = ""
+	}
+
+	// A successful decryption unlocks the vault and may open the next links
+	// of its chain.
+	if rec != nil {
+		if released := markVaultUnlocked(rec.ID, "retrieve"); len(released) > 0 {
+			w.Header().Set("X-Chain-Released", strings.Join(released, ","))
+		}
+	}
+
 	// Serve File (filename already sanitized)
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Write(decryptedData)
+	outcome = "ok"
+	metricBytes.add(float64(len(decryptedData)), "retrieve")
 
 	fmt.Printf("[Web3 Retrieve] Success. Verified: %v\n", verified)
+	auditEvent(r, "retrieve", vaultID, auditOutcomeSuccess, fmt.Sprintf("integrity verified: %v", verified))
 }
 
 func deleteHandler(w http.ResponseWriter, r *http.Request) {
@@ -1045,8 +1768,8 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
-	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxUploadSize))
+	if err := r.ParseMultipartForm(int64(cfg.MaxUploadSize)); err != nil {
 		writeError(w, http.StatusRequestEntityTooLarge, "Request too large")
 		return
 	}
@@ -1068,9 +1791,33 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("X-User-ID")
 	fmt.Printf("\n[Web3 Delete] User: %s | Initializing Purge Sequence...\n", userID)
 
-	// Process Manifest — validate every CID before touching the network.
+	// A registered vault is deleted the way DELETE /v1/vaults/{id} does it:
+	// by its owner or a grantee, with the key shredded and the unpinning
+	// queued. Only manifests the registry doesn't know fall through to a
+	// direct purge.
+	if rec := vaultByManifest(manifestData); rec != nil {
+		if !checkAccess(w, r, rec, accessDelete) {
+			return
+		}
+		if !deleteVault(w, r, rec) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success":       true,
+			"vault_id":      rec.ID,
+			"chunks_purged": 0,
+			"chunks_queued": len(rec.CIDs),
+		})
+		return
+	}
+
+	// Process Manifest — validate every CID, and refuse chunks of vaults under
+	// legal hold (see hold.go) or of any other registered vault (see
+	// access.go), before touching the network.
 	rawLines := strings.Split(strings.TrimSpace(manifestData), "\n")
-	var unpinnedCount int
+	held := heldCIDs()
+	registered := registeredCIDs()
+	var cids []string
 	for _, line := range rawLines {
 		line = strings.TrimSpace(line)
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -1080,8 +1827,35 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "Manifest contains an invalid CID")
 			return
 		}
-		if err := UnpinFromIPFS(line); err != nil {
-			fmt.Printf("Failed to unpin %s: %v\n", line, err)
+		if id, ok := held[line]; ok {
+			fmt.Printf("[Web3 Delete] Refused: chunk %s belongs to vault %s under legal hold\n", line, id)
+			if rec, err := vaults.Get(id); err == nil {
+				writeLegalHold(w, rec)
+			} else {
+				writeError(w, http.StatusLocked, "Vault is under legal hold")
+			}
+			return
+		}
+		if rec, ok := registered[line]; ok {
+			fmt.Printf("[Web3 Delete] Refused: chunk %s belongs to vault %s\n", line, rec.ID)
+			if !checkAccess(w, r, rec, accessDelete) {
+				return
+			}
+			auditEvent(r, "delete", rec.ID, auditOutcomeDenied, "manifest covers only part of the vault")
+			writeJSON(w, http.StatusConflict, map[string]string{
+				"error":    "Manifest covers only part of a registered vault — delete it with its own manifest",
+				"code":     "PARTIAL_VAULT",
+				"vault_id": rec.ID,
+			})
+			return
+		}
+		cids = append(cids, line)
+	}
+
+	var unpinnedCount int
+	for _, cid := range cids {
+		if err := UnpinFromIPFS(cid); err != nil {
+			fmt.Printf("Failed to unpin %s: %v\n", cid, err)
 		} else {
 			unpinnedCount++
 		}
@@ -1092,4 +1866,5 @@ func deleteHandler(w http.ResponseWriter, r *http.Request) {
 		"chunks_purged": unpinnedCount,
 	})
 	fmt.Printf("[Web3 Delete] Purge Complete. %d chunks unpinned.\n", unpinnedCount)
+	auditEvent(r, "purge", "", auditOutcomeSuccess, fmt.Sprintf("%d of %d unregistered chunks unpinned", unpinnedCount, len(cids)))
 }
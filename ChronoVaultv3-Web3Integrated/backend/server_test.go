@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubPinner stands in for Pinata: every pinFileToIPFS call succeeds with a
+// fresh CIDv0, recorded in pinned.
+type stubPinner struct {
+	mu     sync.Mutex
+	pinned []string
+}
+
+func (p *stubPinner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/pinning/pinFileToIPFS" {
+		http.NotFound(w, r)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cid := "Qm" + strings.Repeat(string("123456789ABCDEFGH"[len(p.pinned)]), 44)
+	p.pinned = append(p.pinned, cid)
+	fmt.Fprintf(w, `{"IpfsHash":%q}`, cid)
+}
+
+// TestUploadRunUnpinsOrphans checks that chunks pinned for a vault which then
+// fails to register go onto the unpin queue, and that a registered vault's
+// chunks stay pinned.
+func TestUploadRunUnpinsOrphans(t *testing.T) {
+	savedCfg, savedJWT, savedVaults := cfg, pinataJWT, vaults
+	t.Cleanup(func() {
+		cfg, pinataJWT, vaults = savedCfg, savedJWT, savedVaults
+		unpins.mu.Lock()
+		unpins.path, unpins.state = "", unpinQueueFile{}
+		unpins.mu.Unlock()
+	})
+
+	tests := []struct {
+		name       string
+		registered bool
+	}{
+		{"vault registered", true},
+		{"registration fails", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinner := &stubPinner{}
+			srv := httptest.NewServer(pinner)
+			defer srv.Close()
+
+			c := *defaultConfig()
+			c.PinataAPIURL = srv.URL
+			c.ChunkSize = 1 << 10
+			cfg, pinataJWT = &c, "test-jwt"
+			vaults = &vaultStore{dir: t.TempDir(), records: make(map[string]*VaultRecord)}
+			unpins.mu.Lock()
+			unpins.path, unpins.state = filepath.Join(t.TempDir(), "unpin.json"), unpinQueueFile{}
+			unpins.mu.Unlock()
+
+			id, err := newVaultID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.registered {
+				// The ID is taken, so vaults.Create fails after pinning.
+				if err := vaults.Create(&VaultRecord{ID: id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data := make([]byte, 3000)
+			rand.Read(data)
+			plaintext, err := NewSecureBufferFrom(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer plaintext.Destroy()
+			u := &uploadRequest{plaintext: plaintext, rec: &VaultRecord{ID: id, FileName: "orphan.bin"}}
+
+			_, key, err := u.run(nil)
+			if key != nil {
+				key.Destroy()
+			}
+			if (err == nil) != tt.registered {
+				t.Fatalf("run: %v", err)
+			}
+			if len(pinner.pinned) < 2 {
+				t.Fatalf("pinned %d chunks, want several", len(pinner.pinned))
+			}
+
+			unpins.mu.Lock()
+			pending := unpins.state.Pending
+			unpins.mu.Unlock()
+			if tt.registered {
+				if len(pending) != 0 {
+					t.Fatalf("registered vault queued %d chunks for unpinning", len(pending))
+				}
+				return
+			}
+			if len(pending) != len(pinner.pinned) {
+				t.Fatalf("queued %d chunks for unpinning, pinned %d", len(pending), len(pinner.pinned))
+			}
+			for i, job := range pending {
+				if job.CID != pinner.pinned[i] || job.VaultID != id {
+					t.Errorf("queue entry %d = %s for vault %q, want %s for %q", i, job.CID, job.VaultID, pinner.pinned[i], id)
+				}
+			}
+		})
+	}
+}
+
+// TestVaultStoreOpenIsAllOrNothing checks that one unreadable record leaves
+// the store as it was instead of serving the records loaded before it.
+func TestVaultStoreOpenIsAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	written := &vaultStore{dir: dir, records: make(map[string]*VaultRecord)}
+	if err := written.Create(&VaultRecord{ID: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &vaultStore{records: make(map[string]*VaultRecord)}
+	if err := s.open(dir); err == nil {
+		t.Fatal("open succeeded with a corrupt record")
+	}
+	if s.dir != "" || len(s.records) != 0 {
+		t.Fatalf("failed open left dir %q and %d record(s)", s.dir, len(s.records))
+	}
+
+	if err := os.Remove(filepath.Join(dir, "corrupt.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.open(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("v1"); err != nil || s.dir != dir {
+		t.Fatalf("after open: dir %q, Get: %v", s.dir, err)
+	}
+}
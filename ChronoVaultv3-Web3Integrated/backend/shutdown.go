@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// --- Graceful Shutdown ---
+//
+// A deploy used to kill the process mid-upload. Chunks already pinned on
+// Pinata were left without a manifest, and the rollback list that
+// EncryptAndStore keeps in memory went with the process. On SIGTERM or
+// SIGINT the server now:
+//
+//  1. stops accepting HTTP and gRPC requests, and refuses new pipelines
+//  2. waits up to SHUTDOWN_TIMEOUT (default 25s) for the uploads in flight
+//  3. cancels any that are still running, so they stop pinning and queue
+//     what they pinned for unpinning, and gives them shutdownRollbackGrace
+//     to do so
+//  4. stops the rate limiter's cleanup goroutine
+//
+// The unpin queue is on disk, so a rollback queued before exit is carried
+// out by the next process. A second signal exits at once.
+
+const (
+	defaultShutdownTimeout = 25 * time.Second
+	shutdownRollbackGrace  = 10 * time.Second
+)
+
+// errShuttingDown is returned to uploads that are refused or cut short by
+// a shutdown.
+var errShuttingDown = errors.New("The server is shutting down")
+
+// pipelineTracker tracks the upload pipelines in flight.
+type pipelineTracker struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	running  int
+	draining bool
+	ctx      context.Context
+	abort    context.CancelFunc
+}
+
+var pipelines = newPipelineTracker()
+
+func newPipelineTracker() *pipelineTracker {
+	t := &pipelineTracker{}
+	t.ctx, t.abort = context.WithCancel(context.Background())
+	return t
+}
+
+// begin registers a pipeline. Its context is cancelled when shutdown stops
+// waiting for it, and done must be called once it has finished or rolled
+// back. It fails with errShuttingDown once draining has started.
+func (t *pipelineTracker) begin() (context.Context, func(), error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return nil, nil, errShuttingDown
+	}
+	t.running++
+	t.wg.Add(1)
+	var once sync.Once
+	return t.ctx, func() {
+		once.Do(func() {
+			t.mu.Lock()
+			t.running--
+			t.mu.Unlock()
+			t.wg.Done()
+		})
+	}, nil
+}
+
+// drain refuses new pipelines and waits up to timeout for the running ones,
+// then cancels those left and waits up to grace for their rollback. It
+// reports whether every pipeline finished.
+func (t *pipelineTracker) drain(timeout, grace time.Duration) bool {
+	t.mu.Lock()
+	t.draining = true
+	n := t.running
+	t.mu.Unlock()
+
+	idle := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(idle)
+	}()
+	if n > 0 {
+		fmt.Printf("[Shutdown] Waiting up to %v for %d upload(s)\n", timeout, n)
+	}
+	select {
+	case <-idle:
+		return true
+	case <-time.After(timeout):
+	}
+
+	t.mu.Lock()
+	n = t.running
+	t.mu.Unlock()
+	fmt.Printf("[Shutdown] Deadline reached, rolling back %d upload(s)\n", n)
+	t.abort()
+	select {
+	case <-idle:
+		return true
+	case <-time.After(grace):
+		return false
+	}
+}
+
+// waitForShutdown blocks until the HTTP server fails or a signal arrives,
+// then shuts everything down.
+func waitForShutdown(server *http.Server, grpcServer *grpc.Server, serveErr <-chan error) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case err := <-serveErr:
+		fmt.Printf("Error starting server: %v\n", err)
+		return
+	case sig := <-sigs:
+		fmt.Printf("\n🛑 %v received, shutting down\n", sig)
+	}
+	go func() {
+		<-sigs
+		fmt.Println("🛑 Second signal, exiting now")
+		os.Exit(1)
+	}()
+	shutdown(server, grpcServer)
+}
+
+func shutdown(server *http.Server, grpcServer *grpc.Server) {
+	timeout := cfg.ShutdownTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+shutdownRollbackGrace)
+	defer cancel()
+
+	// The servers finish the requests they have, which includes the
+	// synchronous uploads being drained below.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Printf("[Shutdown] HTTP server: %v\n", err)
+		}
+	}()
+	if grpcServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopGRPC(ctx, grpcServer)
+		}()
+	}
+
+	if pipelines.drain(timeout, shutdownRollbackGrace) {
+		fmt.Println("[Shutdown] No uploads in flight")
+	} else {
+		fmt.Println("[Shutdown] Some uploads did not roll back in time; their chunks may stay pinned")
+	}
+	wg.Wait()
+	limiter.Stop()
+	fmt.Println("👋 Server stopped")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Time-Lock Vaults ---
+//
+// An upload with unlock_at set never returns its data key. The key is wrapped
+// by the KeyProvider's KEK and escrowed in the vault record; /retrieve only
+// unwraps it once the trusted clock says unlock_at has passed.
+//
+// "Trusted" is the weak link: the host clock can be set forward by anyone
+// with root. TIME_SOURCE selects where "now" comes from:
+//
+//	local   host clock (default; fine when the operator is the trust anchor)
+//	https   median of the Date headers from TIME_SOURCE_URLS, authenticated
+//	        by TLS; a host clock that is merely wrong cannot open a vault
+//	fixed   TIME_SOURCE_FIXED (RFC 3339), a frozen clock for tests
+//
+// Every source fails closed: if the time cannot be established, the vault
+// stays locked.
+
+// TimeSource reports the current time from some authority.
+type TimeSource interface {
+	Name() string
+	Now() (time.Time, error)
+}
+
+var timeSource TimeSource = localTimeSource{}
+
+// initTimeSource selects the time source from time_source.
+func initTimeSource() {
+	switch strings.ToLower(cfg.TimeSource) {
+	case "", "local":
+		timeSource = localTimeSource{}
+	case "https":
+		timeSource = newHTTPSTimeSource(cfg.TimeSourceURLs)
+	case "fixed":
+		t, err := time.Parse(time.RFC3339, cfg.TimeSourceFixed)
+		if err != nil {
+			fmt.Printf("⚠️  FATAL: TIME_SOURCE_FIXED must be RFC 3339: %v — time-locked vaults will stay locked.\n", err)
+			timeSource = failedTimeSource{err: err}
+			return
+		}
+		timeSource = fixedTimeSource{t: t}
+	default:
+		err := fmt.Errorf("unknown TIME_SOURCE %q", cfg.TimeSource)
+		fmt.Printf("⚠️  FATAL: %v — time-locked vaults will stay locked.\n", err)
+		timeSource = failedTimeSource{err: err}
+		return
+	}
+	fmt.Printf("⏱️  Time source: %s\n", timeSource.Name())
+}
+
+type localTimeSource struct{}
+
+func (localTimeSource) Name() string            { return "local clock" }
+func (localTimeSource) Now() (time.Time, error) { return time.Now().UTC(), nil }
+
+type fixedTimeSource struct{ t time.Time }
+
+func (s fixedTimeSource) Name() string            { return "fixed (" + s.t.Format(time.RFC3339) + ")" }
+func (s fixedTimeSource) Now() (time.Time, error) { return s.t.UTC(), nil }
+
+type failedTimeSource struct{ err error }
+
+func (s failedTimeSource) Name() string            { return "unavailable" }
+func (s failedTimeSource) Now() (time.Time, error) { return time.Time{}, s.err }
+
+// httpsTimeSource asks several HTTPS servers for their Date header and takes
+// the median, so one bad server can't move the clock. Results are cached
+// briefly and never allowed to run backwards.
+type httpsTimeSource struct {
+	urls   []string
+	client *http.Client
+
+	mu        sync.Mutex
+	last      time.Time // authority time at fetchedAt
+	fetchedAt time.Time // host monotonic reading
+}
+
+const httpsTimeCacheTTL = 30 * time.Second
+
+func newHTTPSTimeSource(urls []string) *httpsTimeSource {
+	var clean []string
+	for _, u := range urls {
+		if u = strings.TrimSpace(u); strings.HasPrefix(u, "https://") {
+			clean = append(clean, u)
+		}
+	}
+	return &httpsTimeSource{urls: clean, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *httpsTimeSource) Name() string {
+	return fmt.Sprintf("https (%s)", strings.Join(s.urls, ", "))
+}
+
+func (s *httpsTimeSource) Now() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// time.Since uses the monotonic clock, which wall-clock changes can't move.
+	if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < httpsTimeCacheTTL {
+		return s.last.Add(time.Since(s.fetchedAt)), nil
+	}
+
+	var samples []time.Time
+	for _, u := range s.urls {
+		start := time.Now()
+		resp, err := s.client.Head(u)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		t, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			continue
+		}
+		// Date has one-second resolution; credit half the round trip.
+		samples = append(samples, t.Add(time.Since(start)/2))
+	}
+	if len(samples) == 0 {
+		return time.Time{}, fmt.Errorf("no time authority reachable (%d configured)", len(s.urls))
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Before(samples[j]) })
+	now := samples[len(samples)/2].UTC()
+
+	if !s.fetchedAt.IsZero() {
+		if floor := s.last.Add(time.Since(s.fetchedAt)); now.Before(floor) {
+			now = floor
+		}
+	}
+	s.last, s.fetchedAt = now, time.Now()
+	return now, nil
+}
+
+// --- Policy leaf ---
+
+// evalTime decides a time window leaf (see policy.go). unlock_at is a window
+// with only a lower bound.
+func (e *policyEnv) evalTime(res *PolicyResult, notBefore, notAfter *time.Time) {
+	if e.nowErr != nil {
+		fmt.Printf("[TimeLock] Time source %s failed: %v\n", timeSource.Name(), e.nowErr)
+		res.Result, res.Code, res.status = policyUnknown, "TIME_UNAVAILABLE", http.StatusServiceUnavailable
+		res.Detail = "trusted time source unavailable"
+		res.message = "Trusted time source unavailable — time-locked vault cannot be opened"
+		return
+	}
+	now := e.now
+	if notBefore != nil && now.Before(*notBefore) {
+		remaining := notBefore.Sub(now)
+		secs := int64((remaining + time.Second - 1) / time.Second)
+		res.Result, res.Code, res.status = policyFail, "VAULT_LOCKED", http.StatusLocked
+		res.Detail = "locked until " + notBefore.UTC().Format(time.RFC3339)
+		res.message = "Vault is time-locked"
+		res.retryAfter = secs
+		res.fields = map[string]interface{}{
+			"locked_until":      notBefore.UTC().Format(time.RFC3339),
+			"seconds_remaining": secs,
+			"server_time":       now.Format(time.RFC3339),
+		}
+		return
+	}
+	if notAfter != nil && !now.Before(*notAfter) {
+		res.Result, res.Code, res.status = policyFail, "WINDOW_CLOSED", http.StatusForbidden
+		res.Detail = "window closed at " + notAfter.UTC().Format(time.RFC3339)
+		res.message = "Vault's unlock window has closed"
+		res.fields = map[string]interface{}{
+			"closed_at":   notAfter.UTC().Format(time.RFC3339),
+			"server_time": now.Format(time.RFC3339),
+		}
+		return
+	}
+	res.Result, res.Detail = policyPass, "inside window at "+now.Format(time.RFC3339)
+}
+
+// parseUnlockAt accepts RFC 3339 or Unix seconds and requires a future time.
+func parseUnlockAt(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		secs, convErr := strconv.ParseInt(value, 10, 64)
+		if convErr != nil {
+			return time.Time{}, fmt.Errorf("unlock_at must be RFC 3339 or Unix seconds")
+		}
+		t = time.Unix(secs, 0)
+	}
+	now, err := timeSource.Now()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("trusted time source unavailable: %w", err)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("unlock_at must be in the future")
+	}
+	return t.UTC().Truncate(time.Second), nil
+}
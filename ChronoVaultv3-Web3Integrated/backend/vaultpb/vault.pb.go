@@ -0,0 +1,1506 @@
+// The ChronoVault gRPC API, served next to the HTTP server (see grpc.go).
+// Every call needs the same Supabase JWT as the HTTP API, sent as
+// "authorization: Bearer <token>" metadata.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: vaultpb/vault.proto
+
+package vaultpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Integrity is the outcome of checking original_hash.
+type Integrity int32
+
+const (
+	Integrity_INTEGRITY_UNSPECIFIED Integrity = 0
+	Integrity_INTEGRITY_UNAVAILABLE Integrity = 1 // no original_hash given
+	Integrity_INTEGRITY_VERIFIED    Integrity = 2
+	Integrity_INTEGRITY_MISMATCH    Integrity = 3
+)
+
+// Enum value maps for Integrity.
+var (
+	Integrity_name = map[int32]string{
+		0: "INTEGRITY_UNSPECIFIED",
+		1: "INTEGRITY_UNAVAILABLE",
+		2: "INTEGRITY_VERIFIED",
+		3: "INTEGRITY_MISMATCH",
+	}
+	Integrity_value = map[string]int32{
+		"INTEGRITY_UNSPECIFIED": 0,
+		"INTEGRITY_UNAVAILABLE": 1,
+		"INTEGRITY_VERIFIED":    2,
+		"INTEGRITY_MISMATCH":    3,
+	}
+)
+
+func (x Integrity) Enum() *Integrity {
+	p := new(Integrity)
+	*p = x
+	return p
+}
+
+func (x Integrity) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Integrity) Descriptor() protoreflect.EnumDescriptor {
+	return file_vaultpb_vault_proto_enumTypes[0].Descriptor()
+}
+
+func (Integrity) Type() protoreflect.EnumType {
+	return &file_vaultpb_vault_proto_enumTypes[0]
+}
+
+func (x Integrity) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Integrity.Descriptor instead.
+func (Integrity) EnumDescriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{0}
+}
+
+type UploadRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*UploadRequest_Header
+	//	*UploadRequest_Data
+	Payload       isUploadRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadRequest) Reset() {
+	*x = UploadRequest{}
+	mi := &file_vaultpb_vault_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRequest) ProtoMessage() {}
+
+func (x *UploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadRequest.ProtoReflect.Descriptor instead.
+func (*UploadRequest) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UploadRequest) GetPayload() isUploadRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetHeader() *UploadHeader {
+	if x != nil {
+		if x, ok := x.Payload.(*UploadRequest_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*UploadRequest_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+type isUploadRequest_Payload interface {
+	isUploadRequest_Payload()
+}
+
+type UploadRequest_Header struct {
+	Header *UploadHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type UploadRequest_Data struct {
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+func (*UploadRequest_Header) isUploadRequest_Payload() {}
+
+func (*UploadRequest_Data) isUploadRequest_Payload() {}
+
+// UploadHeader names the file and sets the vault's options. The options are
+// the /upload form fields of the same name and follow the same rules; lists
+// are the comma-separated fields.
+type UploadHeader struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	FileName string                 `protobuf:"bytes,1,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	// Exact size of the file in bytes, at most max_upload_size (10 MB by
+	// default).
+	Size               int64    `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	KemPublicKey       string   `protobuf:"bytes,3,opt,name=kem_public_key,json=kemPublicKey,proto3" json:"kem_public_key,omitempty"`
+	UnlockAt           string   `protobuf:"bytes,4,opt,name=unlock_at,json=unlockAt,proto3" json:"unlock_at,omitempty"`
+	Schedule           string   `protobuf:"bytes,5,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	ScheduleWindow     string   `protobuf:"bytes,6,opt,name=schedule_window,json=scheduleWindow,proto3" json:"schedule_window,omitempty"`
+	ScheduleTz         string   `protobuf:"bytes,7,opt,name=schedule_tz,json=scheduleTz,proto3" json:"schedule_tz,omitempty"`
+	Geofence           string   `protobuf:"bytes,8,opt,name=geofence,proto3" json:"geofence,omitempty"`
+	DeadmanCheckinDays *int32   `protobuf:"varint,9,opt,name=deadman_checkin_days,json=deadmanCheckinDays,proto3,oneof" json:"deadman_checkin_days,omitempty"`
+	DeadmanGraceDays   *int32   `protobuf:"varint,10,opt,name=deadman_grace_days,json=deadmanGraceDays,proto3,oneof" json:"deadman_grace_days,omitempty"`
+	Beneficiaries      []string `protobuf:"bytes,11,rep,name=beneficiaries,proto3" json:"beneficiaries,omitempty"`
+	ChainAfter         []string `protobuf:"bytes,12,rep,name=chain_after,json=chainAfter,proto3" json:"chain_after,omitempty"`
+	Approvers          []string `protobuf:"bytes,13,rep,name=approvers,proto3" json:"approvers,omitempty"`
+	ApprovalThreshold  *int32   `protobuf:"varint,14,opt,name=approval_threshold,json=approvalThreshold,proto3,oneof" json:"approval_threshold,omitempty"`
+	ApprovalWindow     string   `protobuf:"bytes,15,opt,name=approval_window,json=approvalWindow,proto3" json:"approval_window,omitempty"`
+	Policy             string   `protobuf:"bytes,16,opt,name=policy,proto3" json:"policy,omitempty"`
+	RetentionDays      *int32   `protobuf:"varint,17,opt,name=retention_days,json=retentionDays,proto3,oneof" json:"retention_days,omitempty"`
+	ExpiresAt          string   `protobuf:"bytes,18,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	OneTime            bool     `protobuf:"varint,19,opt,name=one_time,json=oneTime,proto3" json:"one_time,omitempty"`
+	DeliverAt          string   `protobuf:"bytes,20,opt,name=deliver_at,json=deliverAt,proto3" json:"deliver_at,omitempty"`
+	DeliverTo          []string `protobuf:"bytes,21,rep,name=deliver_to,json=deliverTo,proto3" json:"deliver_to,omitempty"`
+	PuzzleDelay        string   `protobuf:"bytes,22,opt,name=puzzle_delay,json=puzzleDelay,proto3" json:"puzzle_delay,omitempty"`
+	ApproverKeys       string   `protobuf:"bytes,23,opt,name=approver_keys,json=approverKeys,proto3" json:"approver_keys,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *UploadHeader) Reset() {
+	*x = UploadHeader{}
+	mi := &file_vaultpb_vault_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadHeader) ProtoMessage() {}
+
+func (x *UploadHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadHeader.ProtoReflect.Descriptor instead.
+func (*UploadHeader) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UploadHeader) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *UploadHeader) GetKemPublicKey() string {
+	if x != nil {
+		return x.KemPublicKey
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetUnlockAt() string {
+	if x != nil {
+		return x.UnlockAt
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetSchedule() string {
+	if x != nil {
+		return x.Schedule
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetScheduleWindow() string {
+	if x != nil {
+		return x.ScheduleWindow
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetScheduleTz() string {
+	if x != nil {
+		return x.ScheduleTz
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetGeofence() string {
+	if x != nil {
+		return x.Geofence
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetDeadmanCheckinDays() int32 {
+	if x != nil && x.DeadmanCheckinDays != nil {
+		return *x.DeadmanCheckinDays
+	}
+	return 0
+}
+
+func (x *UploadHeader) GetDeadmanGraceDays() int32 {
+	if x != nil && x.DeadmanGraceDays != nil {
+		return *x.DeadmanGraceDays
+	}
+	return 0
+}
+
+func (x *UploadHeader) GetBeneficiaries() []string {
+	if x != nil {
+		return x.Beneficiaries
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetChainAfter() []string {
+	if x != nil {
+		return x.ChainAfter
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetApprovers() []string {
+	if x != nil {
+		return x.Approvers
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetApprovalThreshold() int32 {
+	if x != nil && x.ApprovalThreshold != nil {
+		return *x.ApprovalThreshold
+	}
+	return 0
+}
+
+func (x *UploadHeader) GetApprovalWindow() string {
+	if x != nil {
+		return x.ApprovalWindow
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetRetentionDays() int32 {
+	if x != nil && x.RetentionDays != nil {
+		return *x.RetentionDays
+	}
+	return 0
+}
+
+func (x *UploadHeader) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetOneTime() bool {
+	if x != nil {
+		return x.OneTime
+	}
+	return false
+}
+
+func (x *UploadHeader) GetDeliverAt() string {
+	if x != nil {
+		return x.DeliverAt
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetDeliverTo() []string {
+	if x != nil {
+		return x.DeliverTo
+	}
+	return nil
+}
+
+func (x *UploadHeader) GetPuzzleDelay() string {
+	if x != nil {
+		return x.PuzzleDelay
+	}
+	return ""
+}
+
+func (x *UploadHeader) GetApproverKeys() string {
+	if x != nil {
+		return x.ApproverKeys
+	}
+	return ""
+}
+
+// UploadResponse is the JSON /upload returns.
+type UploadResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	VaultId         string                 `protobuf:"bytes,1,opt,name=vault_id,json=vaultId,proto3" json:"vault_id,omitempty"`
+	OriginalHash    string                 `protobuf:"bytes,2,opt,name=original_hash,json=originalHash,proto3" json:"original_hash,omitempty"`
+	RootHash        string                 `protobuf:"bytes,3,opt,name=root_hash,json=rootHash,proto3" json:"root_hash,omitempty"`
+	FileName        string                 `protobuf:"bytes,4,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	ManifestContent string                 `protobuf:"bytes,5,opt,name=manifest_content,json=manifestContent,proto3" json:"manifest_content,omitempty"`
+	// The raw AES-256 data key. Empty when the server withholds it, or when it
+	// travels wrapped or sealed in the manifest (see key_wrap).
+	EncryptionKey   []byte                 `protobuf:"bytes,6,opt,name=encryption_key,json=encryptionKey,proto3" json:"encryption_key,omitempty"`
+	KeyWrap         string                 `protobuf:"bytes,7,opt,name=key_wrap,json=keyWrap,proto3" json:"key_wrap,omitempty"`
+	UnlockAt        *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=unlock_at,json=unlockAt,proto3" json:"unlock_at,omitempty"`
+	ExpiresAt       *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	NextWindow      *Window                `protobuf:"bytes,10,opt,name=next_window,json=nextWindow,proto3" json:"next_window,omitempty"`
+	PuzzleSquarings uint64                 `protobuf:"varint,11,opt,name=puzzle_squarings,json=puzzleSquarings,proto3" json:"puzzle_squarings,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *UploadResponse) Reset() {
+	*x = UploadResponse{}
+	mi := &file_vaultpb_vault_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadResponse) ProtoMessage() {}
+
+func (x *UploadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadResponse.ProtoReflect.Descriptor instead.
+func (*UploadResponse) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UploadResponse) GetVaultId() string {
+	if x != nil {
+		return x.VaultId
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetOriginalHash() string {
+	if x != nil {
+		return x.OriginalHash
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetRootHash() string {
+	if x != nil {
+		return x.RootHash
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetManifestContent() string {
+	if x != nil {
+		return x.ManifestContent
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetEncryptionKey() []byte {
+	if x != nil {
+		return x.EncryptionKey
+	}
+	return nil
+}
+
+func (x *UploadResponse) GetKeyWrap() string {
+	if x != nil {
+		return x.KeyWrap
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetUnlockAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UnlockAt
+	}
+	return nil
+}
+
+func (x *UploadResponse) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *UploadResponse) GetNextWindow() *Window {
+	if x != nil {
+		return x.NextWindow
+	}
+	return nil
+}
+
+func (x *UploadResponse) GetPuzzleSquarings() uint64 {
+	if x != nil {
+		return x.PuzzleSquarings
+	}
+	return 0
+}
+
+// RetrieveRequest carries the /retrieve form.
+type RetrieveRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	RootHash string                 `protobuf:"bytes,1,opt,name=root_hash,json=rootHash,proto3" json:"root_hash,omitempty"`
+	Manifest string                 `protobuf:"bytes,2,opt,name=manifest,proto3" json:"manifest,omitempty"`
+	// Checked against the plaintext when set.
+	OriginalHash string `protobuf:"bytes,3,opt,name=original_hash,json=originalHash,proto3" json:"original_hash,omitempty"`
+	// The data key, raw or hex. Not needed when the server holds the key or
+	// the manifest wraps it.
+	Key []byte `protobuf:"bytes,4,opt,name=key,proto3" json:"key,omitempty"`
+	// The hybrid private key file, for manifests wrapped to a kem_public_key.
+	KemPrivateKey []byte `protobuf:"bytes,5,opt,name=kem_private_key,json=kemPrivateKey,proto3" json:"kem_private_key,omitempty"`
+	// A signed device location, for geofenced vaults.
+	LocationAttestation string `protobuf:"bytes,6,opt,name=location_attestation,json=locationAttestation,proto3" json:"location_attestation,omitempty"`
+	LocationSignature   string `protobuf:"bytes,7,opt,name=location_signature,json=locationSignature,proto3" json:"location_signature,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *RetrieveRequest) Reset() {
+	*x = RetrieveRequest{}
+	mi := &file_vaultpb_vault_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RetrieveRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RetrieveRequest) ProtoMessage() {}
+
+func (x *RetrieveRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RetrieveRequest.ProtoReflect.Descriptor instead.
+func (*RetrieveRequest) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RetrieveRequest) GetRootHash() string {
+	if x != nil {
+		return x.RootHash
+	}
+	return ""
+}
+
+func (x *RetrieveRequest) GetManifest() string {
+	if x != nil {
+		return x.Manifest
+	}
+	return ""
+}
+
+func (x *RetrieveRequest) GetOriginalHash() string {
+	if x != nil {
+		return x.OriginalHash
+	}
+	return ""
+}
+
+func (x *RetrieveRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *RetrieveRequest) GetKemPrivateKey() []byte {
+	if x != nil {
+		return x.KemPrivateKey
+	}
+	return nil
+}
+
+func (x *RetrieveRequest) GetLocationAttestation() string {
+	if x != nil {
+		return x.LocationAttestation
+	}
+	return ""
+}
+
+func (x *RetrieveRequest) GetLocationSignature() string {
+	if x != nil {
+		return x.LocationSignature
+	}
+	return ""
+}
+
+type RetrieveResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*RetrieveResponse_Header
+	//	*RetrieveResponse_Data
+	Payload       isRetrieveResponse_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RetrieveResponse) Reset() {
+	*x = RetrieveResponse{}
+	mi := &file_vaultpb_vault_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RetrieveResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RetrieveResponse) ProtoMessage() {}
+
+func (x *RetrieveResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RetrieveResponse.ProtoReflect.Descriptor instead.
+func (*RetrieveResponse) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RetrieveResponse) GetPayload() isRetrieveResponse_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *RetrieveResponse) GetHeader() *RetrieveHeader {
+	if x != nil {
+		if x, ok := x.Payload.(*RetrieveResponse_Header); ok {
+			return x.Header
+		}
+	}
+	return nil
+}
+
+func (x *RetrieveResponse) GetData() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*RetrieveResponse_Data); ok {
+			return x.Data
+		}
+	}
+	return nil
+}
+
+type isRetrieveResponse_Payload interface {
+	isRetrieveResponse_Payload()
+}
+
+type RetrieveResponse_Header struct {
+	Header *RetrieveHeader `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type RetrieveResponse_Data struct {
+	Data []byte `protobuf:"bytes,2,opt,name=data,proto3,oneof"`
+}
+
+func (*RetrieveResponse_Header) isRetrieveResponse_Payload() {}
+
+func (*RetrieveResponse_Data) isRetrieveResponse_Payload() {}
+
+type RetrieveHeader struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	FileName  string                 `protobuf:"bytes,1,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Integrity Integrity              `protobuf:"varint,2,opt,name=integrity,proto3,enum=chronovault.v1.Integrity" json:"integrity,omitempty"`
+	// Vaults that unlocked because this one did (see chain_after).
+	ChainReleased []string `protobuf:"bytes,3,rep,name=chain_released,json=chainReleased,proto3" json:"chain_released,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RetrieveHeader) Reset() {
+	*x = RetrieveHeader{}
+	mi := &file_vaultpb_vault_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RetrieveHeader) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RetrieveHeader) ProtoMessage() {}
+
+func (x *RetrieveHeader) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RetrieveHeader.ProtoReflect.Descriptor instead.
+func (*RetrieveHeader) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RetrieveHeader) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *RetrieveHeader) GetIntegrity() Integrity {
+	if x != nil {
+		return x.Integrity
+	}
+	return Integrity_INTEGRITY_UNSPECIFIED
+}
+
+func (x *RetrieveHeader) GetChainReleased() []string {
+	if x != nil {
+		return x.ChainReleased
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VaultId       string                 `protobuf:"bytes,1,opt,name=vault_id,json=vaultId,proto3" json:"vault_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_vaultpb_vault_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DeleteRequest) GetVaultId() string {
+	if x != nil {
+		return x.VaultId
+	}
+	return ""
+}
+
+type GetVaultRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	VaultId       string                 `protobuf:"bytes,1,opt,name=vault_id,json=vaultId,proto3" json:"vault_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetVaultRequest) Reset() {
+	*x = GetVaultRequest{}
+	mi := &file_vaultpb_vault_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetVaultRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetVaultRequest) ProtoMessage() {}
+
+func (x *GetVaultRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetVaultRequest.ProtoReflect.Descriptor instead.
+func (*GetVaultRequest) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetVaultRequest) GetVaultId() string {
+	if x != nil {
+		return x.VaultId
+	}
+	return ""
+}
+
+type ListVaultsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Page size, 1-200; 0 means 50.
+	Limit int32 `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	// next_cursor from the previous page.
+	Cursor         string `protobuf:"bytes,2,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	IncludeDeleted bool   `protobuf:"varint,3,opt,name=include_deleted,json=includeDeleted,proto3" json:"include_deleted,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ListVaultsRequest) Reset() {
+	*x = ListVaultsRequest{}
+	mi := &file_vaultpb_vault_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVaultsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVaultsRequest) ProtoMessage() {}
+
+func (x *ListVaultsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVaultsRequest.ProtoReflect.Descriptor instead.
+func (*ListVaultsRequest) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListVaultsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListVaultsRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *ListVaultsRequest) GetIncludeDeleted() bool {
+	if x != nil {
+		return x.IncludeDeleted
+	}
+	return false
+}
+
+type ListVaultsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vaults        []*Vault               `protobuf:"bytes,1,rep,name=vaults,proto3" json:"vaults,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVaultsResponse) Reset() {
+	*x = ListVaultsResponse{}
+	mi := &file_vaultpb_vault_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVaultsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVaultsResponse) ProtoMessage() {}
+
+func (x *ListVaultsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVaultsResponse.ProtoReflect.Descriptor instead.
+func (*ListVaultsResponse) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListVaultsResponse) GetVaults() []*Vault {
+	if x != nil {
+		return x.Vaults
+	}
+	return nil
+}
+
+func (x *ListVaultsResponse) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+// Vault is a vault's metadata. It never includes key material.
+type Vault struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Id           string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	FileName     string                 `protobuf:"bytes,2,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	RootHash     string                 `protobuf:"bytes,3,opt,name=root_hash,json=rootHash,proto3" json:"root_hash,omitempty"`
+	OriginalHash string                 `protobuf:"bytes,4,opt,name=original_hash,json=originalHash,proto3" json:"original_hash,omitempty"`
+	CreatedAt    *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	Chunks       int32                  `protobuf:"varint,6,opt,name=chunks,proto3" json:"chunks,omitempty"`
+	// The conditions set on the vault, in upload-field terms.
+	Locks         []string               `protobuf:"bytes,7,rep,name=locks,proto3" json:"locks,omitempty"`
+	KeyWithheld   bool                   `protobuf:"varint,8,opt,name=key_withheld,json=keyWithheld,proto3" json:"key_withheld,omitempty"`
+	UnlockAt      *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=unlock_at,json=unlockAt,proto3" json:"unlock_at,omitempty"`
+	NextWindow    *Window                `protobuf:"bytes,10,opt,name=next_window,json=nextWindow,proto3" json:"next_window,omitempty"`
+	UnlockedAt    *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=unlocked_at,json=unlockedAt,proto3" json:"unlocked_at,omitempty"`
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	ConsumedAt    *timestamppb.Timestamp `protobuf:"bytes,13,opt,name=consumed_at,json=consumedAt,proto3" json:"consumed_at,omitempty"`
+	LegalHold     bool                   `protobuf:"varint,14,opt,name=legal_hold,json=legalHold,proto3" json:"legal_hold,omitempty"`
+	Deletion      *Deletion              `protobuf:"bytes,15,opt,name=deletion,proto3" json:"deletion,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Vault) Reset() {
+	*x = Vault{}
+	mi := &file_vaultpb_vault_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Vault) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Vault) ProtoMessage() {}
+
+func (x *Vault) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Vault.ProtoReflect.Descriptor instead.
+func (*Vault) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Vault) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Vault) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *Vault) GetRootHash() string {
+	if x != nil {
+		return x.RootHash
+	}
+	return ""
+}
+
+func (x *Vault) GetOriginalHash() string {
+	if x != nil {
+		return x.OriginalHash
+	}
+	return ""
+}
+
+func (x *Vault) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Vault) GetChunks() int32 {
+	if x != nil {
+		return x.Chunks
+	}
+	return 0
+}
+
+func (x *Vault) GetLocks() []string {
+	if x != nil {
+		return x.Locks
+	}
+	return nil
+}
+
+func (x *Vault) GetKeyWithheld() bool {
+	if x != nil {
+		return x.KeyWithheld
+	}
+	return false
+}
+
+func (x *Vault) GetUnlockAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UnlockAt
+	}
+	return nil
+}
+
+func (x *Vault) GetNextWindow() *Window {
+	if x != nil {
+		return x.NextWindow
+	}
+	return nil
+}
+
+func (x *Vault) GetUnlockedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UnlockedAt
+	}
+	return nil
+}
+
+func (x *Vault) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *Vault) GetConsumedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ConsumedAt
+	}
+	return nil
+}
+
+func (x *Vault) GetLegalHold() bool {
+	if x != nil {
+		return x.LegalHold
+	}
+	return false
+}
+
+func (x *Vault) GetDeletion() *Deletion {
+	if x != nil {
+		return x.Deletion
+	}
+	return nil
+}
+
+// Window is the current or next unlock window of a schedule.
+type Window struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Opens         *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=opens,proto3" json:"opens,omitempty"`
+	Closes        *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=closes,proto3" json:"closes,omitempty"`
+	Open          bool                   `protobuf:"varint,3,opt,name=open,proto3" json:"open,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Window) Reset() {
+	*x = Window{}
+	mi := &file_vaultpb_vault_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Window) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Window) ProtoMessage() {}
+
+func (x *Window) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Window.ProtoReflect.Descriptor instead.
+func (*Window) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Window) GetOpens() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Opens
+	}
+	return nil
+}
+
+func (x *Window) GetCloses() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Closes
+	}
+	return nil
+}
+
+func (x *Window) GetOpen() bool {
+	if x != nil {
+		return x.Open
+	}
+	return false
+}
+
+// Deletion tracks a crypto-shred and the unpinning of its chunks.
+type Deletion struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	At    *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=at,proto3" json:"at,omitempty"`
+	// "retention", "burn-after-read" or "owner".
+	Reason         string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	KeyShredded    bool   `protobuf:"varint,3,opt,name=key_shredded,json=keyShredded,proto3" json:"key_shredded,omitempty"`
+	ChunksTotal    int32  `protobuf:"varint,4,opt,name=chunks_total,json=chunksTotal,proto3" json:"chunks_total,omitempty"`
+	ChunksUnpinned int32  `protobuf:"varint,5,opt,name=chunks_unpinned,json=chunksUnpinned,proto3" json:"chunks_unpinned,omitempty"`
+	// Chunks that could not be unpinned.
+	ChunksFailed  []string               `protobuf:"bytes,6,rep,name=chunks_failed,json=chunksFailed,proto3" json:"chunks_failed,omitempty"`
+	CompletedAt   *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=completed_at,json=completedAt,proto3" json:"completed_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Deletion) Reset() {
+	*x = Deletion{}
+	mi := &file_vaultpb_vault_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Deletion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Deletion) ProtoMessage() {}
+
+func (x *Deletion) ProtoReflect() protoreflect.Message {
+	mi := &file_vaultpb_vault_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Deletion.ProtoReflect.Descriptor instead.
+func (*Deletion) Descriptor() ([]byte, []int) {
+	return file_vaultpb_vault_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Deletion) GetAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.At
+	}
+	return nil
+}
+
+func (x *Deletion) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Deletion) GetKeyShredded() bool {
+	if x != nil {
+		return x.KeyShredded
+	}
+	return false
+}
+
+func (x *Deletion) GetChunksTotal() int32 {
+	if x != nil {
+		return x.ChunksTotal
+	}
+	return 0
+}
+
+func (x *Deletion) GetChunksUnpinned() int32 {
+	if x != nil {
+		return x.ChunksUnpinned
+	}
+	return 0
+}
+
+func (x *Deletion) GetChunksFailed() []string {
+	if x != nil {
+		return x.ChunksFailed
+	}
+	return nil
+}
+
+func (x *Deletion) GetCompletedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CompletedAt
+	}
+	return nil
+}
+
+var File_vaultpb_vault_proto protoreflect.FileDescriptor
+
+const file_vaultpb_vault_proto_rawDesc = "" +
+	"\n" +
+	"\x13vaultpb/vault.proto\x12\x0echronovault.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"h\n" +
+	"\rUploadRequest\x126\n" +
+	"\x06header\x18\x01 \x01(\v2\x1c.chronovault.v1.UploadHeaderH\x00R\x06header\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04dataB\t\n" +
+	"\apayload\"\x8e\a\n" +
+	"\fUploadHeader\x12\x1b\n" +
+	"\tfile_name\x18\x01 \x01(\tR\bfileName\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12$\n" +
+	"\x0ekem_public_key\x18\x03 \x01(\tR\fkemPublicKey\x12\x1b\n" +
+	"\tunlock_at\x18\x04 \x01(\tR\bunlockAt\x12\x1a\n" +
+	"\bschedule\x18\x05 \x01(\tR\bschedule\x12'\n" +
+	"\x0fschedule_window\x18\x06 \x01(\tR\x0escheduleWindow\x12\x1f\n" +
+	"\vschedule_tz\x18\a \x01(\tR\n" +
+	"scheduleTz\x12\x1a\n" +
+	"\bgeofence\x18\b \x01(\tR\bgeofence\x125\n" +
+	"\x14deadman_checkin_days\x18\t \x01(\x05H\x00R\x12deadmanCheckinDays\x88\x01\x01\x121\n" +
+	"\x12deadman_grace_days\x18\n" +
+	" \x01(\x05H\x01R\x10deadmanGraceDays\x88\x01\x01\x12$\n" +
+	"\rbeneficiaries\x18\v \x03(\tR\rbeneficiaries\x12\x1f\n" +
+	"\vchain_after\x18\f \x03(\tR\n" +
+	"chainAfter\x12\x1c\n" +
+	"\tapprovers\x18\r \x03(\tR\tapprovers\x122\n" +
+	"\x12approval_threshold\x18\x0e \x01(\x05H\x02R\x11approvalThreshold\x88\x01\x01\x12'\n" +
+	"\x0fapproval_window\x18\x0f \x01(\tR\x0eapprovalWindow\x12\x16\n" +
+	"\x06policy\x18\x10 \x01(\tR\x06policy\x12*\n" +
+	"\x0eretention_days\x18\x11 \x01(\x05H\x03R\rretentionDays\x88\x01\x01\x12\x1d\n" +
+	"\n" +
+	"expires_at\x18\x12 \x01(\tR\texpiresAt\x12\x19\n" +
+	"\bone_time\x18\x13 \x01(\bR\aoneTime\x12\x1d\n" +
+	"\n" +
+	"deliver_at\x18\x14 \x01(\tR\tdeliverAt\x12\x1d\n" +
+	"\n" +
+	"deliver_to\x18\x15 \x03(\tR\tdeliverTo\x12!\n" +
+	"\fpuzzle_delay\x18\x16 \x01(\tR\vpuzzleDelay\x12#\n" +
+	"\rapprover_keys\x18\x17 \x01(\tR\fapproverKeysB\x17\n" +
+	"\x15_deadman_checkin_daysB\x15\n" +
+	"\x13_deadman_grace_daysB\x15\n" +
+	"\x13_approval_thresholdB\x11\n" +
+	"\x0f_retention_days\"\xcf\x03\n" +
+	"\x0eUploadResponse\x12\x19\n" +
+	"\bvault_id\x18\x01 \x01(\tR\avaultId\x12#\n" +
+	"\roriginal_hash\x18\x02 \x01(\tR\foriginalHash\x12\x1b\n" +
+	"\troot_hash\x18\x03 \x01(\tR\brootHash\x12\x1b\n" +
+	"\tfile_name\x18\x04 \x01(\tR\bfileName\x12)\n" +
+	"\x10manifest_content\x18\x05 \x01(\tR\x0fmanifestContent\x12%\n" +
+	"\x0eencryption_key\x18\x06 \x01(\fR\rencryptionKey\x12\x19\n" +
+	"\bkey_wrap\x18\a \x01(\tR\akeyWrap\x127\n" +
+	"\tunlock_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\bunlockAt\x129\n" +
+	"\n" +
+	"expires_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x127\n" +
+	"\vnext_window\x18\n" +
+	" \x01(\v2\x16.chronovault.v1.WindowR\n" +
+	"nextWindow\x12)\n" +
+	"\x10puzzle_squarings\x18\v \x01(\x04R\x0fpuzzleSquarings\"\x8b\x02\n" +
+	"\x0fRetrieveRequest\x12\x1b\n" +
+	"\troot_hash\x18\x01 \x01(\tR\brootHash\x12\x1a\n" +
+	"\bmanifest\x18\x02 \x01(\tR\bmanifest\x12#\n" +
+	"\roriginal_hash\x18\x03 \x01(\tR\foriginalHash\x12\x10\n" +
+	"\x03key\x18\x04 \x01(\fR\x03key\x12&\n" +
+	"\x0fkem_private_key\x18\x05 \x01(\fR\rkemPrivateKey\x121\n" +
+	"\x14location_attestation\x18\x06 \x01(\tR\x13locationAttestation\x12-\n" +
+	"\x12location_signature\x18\a \x01(\tR\x11locationSignature\"m\n" +
+	"\x10RetrieveResponse\x128\n" +
+	"\x06header\x18\x01 \x01(\v2\x1e.chronovault.v1.RetrieveHeaderH\x00R\x06header\x12\x14\n" +
+	"\x04data\x18\x02 \x01(\fH\x00R\x04dataB\t\n" +
+	"\apayload\"\x8d\x01\n" +
+	"\x0eRetrieveHeader\x12\x1b\n" +
+	"\tfile_name\x18\x01 \x01(\tR\bfileName\x127\n" +
+	"\tintegrity\x18\x02 \x01(\x0e2\x19.chronovault.v1.IntegrityR\tintegrity\x12%\n" +
+	"\x0echain_released\x18\x03 \x03(\tR\rchainReleased\"*\n" +
+	"\rDeleteRequest\x12\x19\n" +
+	"\bvault_id\x18\x01 \x01(\tR\avaultId\",\n" +
+	"\x0fGetVaultRequest\x12\x19\n" +
+	"\bvault_id\x18\x01 \x01(\tR\avaultId\"j\n" +
+	"\x11ListVaultsRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\x02 \x01(\tR\x06cursor\x12'\n" +
+	"\x0finclude_deleted\x18\x03 \x01(\bR\x0eincludeDeleted\"d\n" +
+	"\x12ListVaultsResponse\x12-\n" +
+	"\x06vaults\x18\x01 \x03(\v2\x15.chronovault.v1.VaultR\x06vaults\x12\x1f\n" +
+	"\vnext_cursor\x18\x02 \x01(\tR\n" +
+	"nextCursor\"\xfe\x04\n" +
+	"\x05Vault\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1b\n" +
+	"\tfile_name\x18\x02 \x01(\tR\bfileName\x12\x1b\n" +
+	"\troot_hash\x18\x03 \x01(\tR\brootHash\x12#\n" +
+	"\roriginal_hash\x18\x04 \x01(\tR\foriginalHash\x129\n" +
+	"\n" +
+	"created_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x12\x16\n" +
+	"\x06chunks\x18\x06 \x01(\x05R\x06chunks\x12\x14\n" +
+	"\x05locks\x18\a \x03(\tR\x05locks\x12!\n" +
+	"\fkey_withheld\x18\b \x01(\bR\vkeyWithheld\x127\n" +
+	"\tunlock_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\bunlockAt\x127\n" +
+	"\vnext_window\x18\n" +
+	" \x01(\v2\x16.chronovault.v1.WindowR\n" +
+	"nextWindow\x12;\n" +
+	"\vunlocked_at\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"unlockedAt\x129\n" +
+	"\n" +
+	"expires_at\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x12;\n" +
+	"\vconsumed_at\x18\r \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"consumedAt\x12\x1d\n" +
+	"\n" +
+	"legal_hold\x18\x0e \x01(\bR\tlegalHold\x124\n" +
+	"\bdeletion\x18\x0f \x01(\v2\x18.chronovault.v1.DeletionR\bdeletion\"\x82\x01\n" +
+	"\x06Window\x120\n" +
+	"\x05opens\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x05opens\x122\n" +
+	"\x06closes\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x06closes\x12\x12\n" +
+	"\x04open\x18\x03 \x01(\bR\x04open\"\xa1\x02\n" +
+	"\bDeletion\x12*\n" +
+	"\x02at\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x02at\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\x12!\n" +
+	"\fkey_shredded\x18\x03 \x01(\bR\vkeyShredded\x12!\n" +
+	"\fchunks_total\x18\x04 \x01(\x05R\vchunksTotal\x12'\n" +
+	"\x0fchunks_unpinned\x18\x05 \x01(\x05R\x0echunksUnpinned\x12#\n" +
+	"\rchunks_failed\x18\x06 \x03(\tR\fchunksFailed\x12=\n" +
+	"\fcompleted_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\vcompletedAt*q\n" +
+	"\tIntegrity\x12\x19\n" +
+	"\x15INTEGRITY_UNSPECIFIED\x10\x00\x12\x19\n" +
+	"\x15INTEGRITY_UNAVAILABLE\x10\x01\x12\x16\n" +
+	"\x12INTEGRITY_VERIFIED\x10\x02\x12\x16\n" +
+	"\x12INTEGRITY_MISMATCH\x10\x032\x83\x03\n" +
+	"\fVaultService\x12I\n" +
+	"\x06Upload\x12\x1d.chronovault.v1.UploadRequest\x1a\x1e.chronovault.v1.UploadResponse(\x01\x12O\n" +
+	"\bRetrieve\x12\x1f.chronovault.v1.RetrieveRequest\x1a .chronovault.v1.RetrieveResponse0\x01\x12>\n" +
+	"\x06Delete\x12\x1d.chronovault.v1.DeleteRequest\x1a\x15.chronovault.v1.Vault\x12B\n" +
+	"\bGetVault\x12\x1f.chronovault.v1.GetVaultRequest\x1a\x15.chronovault.v1.Vault\x12S\n" +
+	"\n" +
+	"ListVaults\x12!.chronovault.v1.ListVaultsRequest\x1a\".chronovault.v1.ListVaultsResponseB\x15Z\x13chronovault/vaultpbb\x06proto3"
+
+var (
+	file_vaultpb_vault_proto_rawDescOnce sync.Once
+	file_vaultpb_vault_proto_rawDescData []byte
+)
+
+func file_vaultpb_vault_proto_rawDescGZIP() []byte {
+	file_vaultpb_vault_proto_rawDescOnce.Do(func() {
+		file_vaultpb_vault_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_vaultpb_vault_proto_rawDesc), len(file_vaultpb_vault_proto_rawDesc)))
+	})
+	return file_vaultpb_vault_proto_rawDescData
+}
+
+var file_vaultpb_vault_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_vaultpb_vault_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_vaultpb_vault_proto_goTypes = []any{
+	(Integrity)(0),                // 0: chronovault.v1.Integrity
+	(*UploadRequest)(nil),         // 1: chronovault.v1.UploadRequest
+	(*UploadHeader)(nil),          // 2: chronovault.v1.UploadHeader
+	(*UploadResponse)(nil),        // 3: chronovault.v1.UploadResponse
+	(*RetrieveRequest)(nil),       // 4: chronovault.v1.RetrieveRequest
+	(*RetrieveResponse)(nil),      // 5: chronovault.v1.RetrieveResponse
+	(*RetrieveHeader)(nil),        // 6: chronovault.v1.RetrieveHeader
+	(*DeleteRequest)(nil),         // 7: chronovault.v1.DeleteRequest
+	(*GetVaultRequest)(nil),       // 8: chronovault.v1.GetVaultRequest
+	(*ListVaultsRequest)(nil),     // 9: chronovault.v1.ListVaultsRequest
+	(*ListVaultsResponse)(nil),    // 10: chronovault.v1.ListVaultsResponse
+	(*Vault)(nil),                 // 11: chronovault.v1.Vault
+	(*Window)(nil),                // 12: chronovault.v1.Window
+	(*Deletion)(nil),              // 13: chronovault.v1.Deletion
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_vaultpb_vault_proto_depIdxs = []int32{
+	2,  // 0: chronovault.v1.UploadRequest.header:type_name -> chronovault.v1.UploadHeader
+	14, // 1: chronovault.v1.UploadResponse.unlock_at:type_name -> google.protobuf.Timestamp
+	14, // 2: chronovault.v1.UploadResponse.expires_at:type_name -> google.protobuf.Timestamp
+	12, // 3: chronovault.v1.UploadResponse.next_window:type_name -> chronovault.v1.Window
+	6,  // 4: chronovault.v1.RetrieveResponse.header:type_name -> chronovault.v1.RetrieveHeader
+	0,  // 5: chronovault.v1.RetrieveHeader.integrity:type_name -> chronovault.v1.Integrity
+	11, // 6: chronovault.v1.ListVaultsResponse.vaults:type_name -> chronovault.v1.Vault
+	14, // 7: chronovault.v1.Vault.created_at:type_name -> google.protobuf.Timestamp
+	14, // 8: chronovault.v1.Vault.unlock_at:type_name -> google.protobuf.Timestamp
+	12, // 9: chronovault.v1.Vault.next_window:type_name -> chronovault.v1.Window
+	14, // 10: chronovault.v1.Vault.unlocked_at:type_name -> google.protobuf.Timestamp
+	14, // 11: chronovault.v1.Vault.expires_at:type_name -> google.protobuf.Timestamp
+	14, // 12: chronovault.v1.Vault.consumed_at:type_name -> google.protobuf.Timestamp
+	13, // 13: chronovault.v1.Vault.deletion:type_name -> chronovault.v1.Deletion
+	14, // 14: chronovault.v1.Window.opens:type_name -> google.protobuf.Timestamp
+	14, // 15: chronovault.v1.Window.closes:type_name -> google.protobuf.Timestamp
+	14, // 16: chronovault.v1.Deletion.at:type_name -> google.protobuf.Timestamp
+	14, // 17: chronovault.v1.Deletion.completed_at:type_name -> google.protobuf.Timestamp
+	1,  // 18: chronovault.v1.VaultService.Upload:input_type -> chronovault.v1.UploadRequest
+	4,  // 19: chronovault.v1.VaultService.Retrieve:input_type -> chronovault.v1.RetrieveRequest
+	7,  // 20: chronovault.v1.VaultService.Delete:input_type -> chronovault.v1.DeleteRequest
+	8,  // 21: chronovault.v1.VaultService.GetVault:input_type -> chronovault.v1.GetVaultRequest
+	9,  // 22: chronovault.v1.VaultService.ListVaults:input_type -> chronovault.v1.ListVaultsRequest
+	3,  // 23: chronovault.v1.VaultService.Upload:output_type -> chronovault.v1.UploadResponse
+	5,  // 24: chronovault.v1.VaultService.Retrieve:output_type -> chronovault.v1.RetrieveResponse
+	11, // 25: chronovault.v1.VaultService.Delete:output_type -> chronovault.v1.Vault
+	11, // 26: chronovault.v1.VaultService.GetVault:output_type -> chronovault.v1.Vault
+	10, // 27: chronovault.v1.VaultService.ListVaults:output_type -> chronovault.v1.ListVaultsResponse
+	23, // [23:28] is the sub-list for method output_type
+	18, // [18:23] is the sub-list for method input_type
+	18, // [18:18] is the sub-list for extension type_name
+	18, // [18:18] is the sub-list for extension extendee
+	0,  // [0:18] is the sub-list for field type_name
+}
+
+func init() { file_vaultpb_vault_proto_init() }
+func file_vaultpb_vault_proto_init() {
+	if File_vaultpb_vault_proto != nil {
+		return
+	}
+	file_vaultpb_vault_proto_msgTypes[0].OneofWrappers = []any{
+		(*UploadRequest_Header)(nil),
+		(*UploadRequest_Data)(nil),
+	}
+	file_vaultpb_vault_proto_msgTypes[1].OneofWrappers = []any{}
+	file_vaultpb_vault_proto_msgTypes[4].OneofWrappers = []any{
+		(*RetrieveResponse_Header)(nil),
+		(*RetrieveResponse_Data)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_vaultpb_vault_proto_rawDesc), len(file_vaultpb_vault_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_vaultpb_vault_proto_goTypes,
+		DependencyIndexes: file_vaultpb_vault_proto_depIdxs,
+		EnumInfos:         file_vaultpb_vault_proto_enumTypes,
+		MessageInfos:      file_vaultpb_vault_proto_msgTypes,
+	}.Build()
+	File_vaultpb_vault_proto = out.File
+	file_vaultpb_vault_proto_goTypes = nil
+	file_vaultpb_vault_proto_depIdxs = nil
+}
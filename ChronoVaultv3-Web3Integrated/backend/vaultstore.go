@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Vault Registry ---
+//
+// Until now the server was stateless: everything about a vault lived in the
+// artifacts handed back to the client. Server-enforced policies (time locks,
+// escrowed keys) need state the client cannot edit, so every upload now gets
+// a VaultRecord persisted as one JSON file per vault under VAULT_DATA_DIR
+// (default "vault_data"). Files are written via temp-file + rename so a crash
+// never leaves a half-written record.
+//
+// The manifest carries the vault's ID in a "# Vault-ID:" header, covered by
+// the manifest signature when signing is configured.
+
+const manifestVaultIDPrefix = "# Vault-ID: "
+
+// VaultRecord is the server-side state of one vault.
+type VaultRecord struct {
+	ID           string    `json:"id"`
+	Owner        string    `json:"owner"`
+	OwnerEmail   string    `json:"owner_email,omitempty"`
+	FileName     string    `json:"file_name"`
+	RootHash     string    `json:"root_hash"`
+	OriginalHash string    `json:"original_hash"`
+	CIDs         []string  `json:"cids"`
+	CreatedAt    time.Time `json:"created_at"`
+	Manifest     string    `json:"manifest"` // as issued, including signature
+
+	// Server-enforced policies escrow the data key (wrapped by the
+	// KeyProvider's KEK); /retrieve only releases it once every policy passes.
+	// Time lock: not before UnlockAt.
+	UnlockAt    *time.Time `json:"unlock_at,omitempty"`
+	EscrowedKey []byte     `json:"escrowed_key,omitempty"`
+
+	// Recurring windows: only inside one of Schedule's windows.
+	Schedule *UnlockSchedule `json:"schedule,omitempty"`
+
+	// Geo-lock: evaluated by /retrieve against device or IP location.
+	GeoFence *GeoFence `json:"geofence,omitempty"`
+
+	// Dead man's switch: the owner keeps the key, and an escrowed copy goes
+	// to beneficiaries if check-ins stop.
+	DeadMan *DeadManSwitch `json:"deadman,omitempty"`
+
+	// Chains: sealed until every vault in Chain.DependsOn is unlocked.
+	Chain       *ChainLink `json:"chain,omitempty"`
+	UnlockedAt  *time.Time `json:"unlocked_at,omitempty"` // first successful unlock
+	UnlockedVia string     `json:"unlocked_via,omitempty"`
+
+	// Approvals: sealed until enough approvers sign off (see approval.go).
+	Approval *ApprovalPolicy `json:"approval,omitempty"`
+
+	// Scheduled delivery: recipients are emailed a single-use retrieval
+	// link at Delivery.At (see delivery.go).
+	Delivery *Delivery `json:"delivery,omitempty"`
+
+	// Sharing: other users the owner has granted access to (see access.go).
+	Grants []Grant `json:"grants,omitempty"`
+
+	// Declarative unlock policy, ANDed with the locks above (see policy.go),
+	// and the biometric checks passed against this vault.
+	Policy  json.RawMessage       `json:"policy,omitempty"`
+	Factors map[string]FactorPass `json:"factors,omitempty"`
+
+	// Burn-after-read: the first successful retrieve consumes the vault.
+	// ClaimToken/ClaimUntil hold the in-flight retrieve's lease.
+	OneTime    bool       `json:"one_time,omitempty"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+	ClaimToken string     `json:"claim_token,omitempty"`
+	ClaimUntil *time.Time `json:"claim_until,omitempty"`
+
+	// Retention: ExpiresAt is the per-vault expiry; tenant policy may bring
+	// it forward (see retention.go). Deletion is set once the vault has been
+	// shredded, by the reaper or by a one-time read.
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Deletion  *DeletionRecord `json:"deletion,omitempty"`
+
+	// Legal hold: while set, nothing may delete, shred or re-key the vault
+	// (see hold.go). HoldHistory keeps lifted holds.
+	LegalHold   *LegalHold  `json:"legal_hold,omitempty"`
+	HoldHistory []LegalHold `json:"hold_history,omitempty"`
+}
+
+// KeyWithheld reports whether the client never received the data key, so
+// /retrieve must use the escrowed copy.
+func (rec *VaultRecord) KeyWithheld() bool {
+	if rec.OneTime {
+		return true // even after the escrowed key is destroyed
+	}
+	return rec.EscrowedKey != nil && (rec.UnlockAt != nil || rec.Schedule != nil || rec.GeoFence != nil || rec.Chain != nil || rec.Approval != nil || rec.Policy != nil)
+}
+
+var errVaultNotFound = errors.New("vault not found")
+
+type vaultStore struct {
+	mu      sync.RWMutex
+	dir     string
+	records map[string]*VaultRecord
+}
+
+var vaults = &vaultStore{records: make(map[string]*VaultRecord)}
+
+// initVaultStore loads every record from disk into memory. A record that
+// can't be loaded stops startup: serving the rest would make its vault look
+// unregistered, and an unregistered manifest can be deleted by anyone.
+func initVaultStore() {
+	dir := cfg.VaultDataDir
+	if err := vaults.open(dir); err != nil {
+		fmt.Printf("⚠️  FATAL: vault registry unavailable: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("🗄️  Vault registry: %d record(s) in %s\n", len(vaults.records), dir)
+}
+
+func (s *vaultStore) open(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// Load everything before touching s, so a failure leaves it as it was.
+	records := make(map[string]*VaultRecord)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.Name(), err)
+		}
+		var rec VaultRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("parse %s: %w", e.Name(), err)
+		}
+		records[rec.ID] = &rec
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir, s.records = dir, records
+	return nil
+}
+
+// Get returns a copy of the record so callers can't mutate shared state.
+func (s *vaultStore) Get(id string) (*VaultRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return nil, errVaultNotFound
+	}
+	cp := *rec
+	return &cp, nil
+}
+
+// Create persists a new record.
+func (s *vaultStore) Create(rec *VaultRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.records[rec.ID]; exists {
+		return fmt.Errorf("vault %s already exists", rec.ID)
+	}
+	if err := s.persist(rec); err != nil {
+		return err
+	}
+	cp := *rec
+	s.records[rec.ID] = &cp
+	return nil
+}
+
+// Update applies fn to the record and persists the result atomically with
+// respect to every other Update. If fn returns an error nothing is written.
+func (s *vaultStore) Update(id string, fn func(*VaultRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return errVaultNotFound
+	}
+	cp := *rec
+	if err := fn(&cp); err != nil {
+		return err
+	}
+	if err := s.persist(&cp); err != nil {
+		return err
+	}
+	s.records[id] = &cp
+	return nil
+}
+
+// Delete removes a record from memory and disk.
+func (s *vaultStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[id]; !ok {
+		return errVaultNotFound
+	}
+	if s.dir != "" {
+		if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	delete(s.records, id)
+	return nil
+}
+
+// List returns copies of all records, oldest first.
+func (s *vaultStore) List() []*VaultRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*VaultRecord, 0, len(s.records))
+	for _, rec := range s.records {
+		cp := *rec
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out
+}
+
+// persist must be called with s.mu held.
+func (s *vaultStore) persist(rec *VaultRecord) error {
+	if s.dir == "" {
+		return fmt.Errorf("vault registry not initialised")
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, rec.ID+".json"), data, 0600)
+}
+
+// writeFileAtomic writes to a temp file in the same directory, fsyncs it and
+// renames it over path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newVaultID returns a random 128-bit hex identifier.
+func newVaultID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("CSPRNG failure generating vault ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// isValidVaultID guards file paths built from client-supplied IDs.
+func isValidVaultID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// manifestVaultID returns the Vault-ID header, or "" for legacy manifests.
+func manifestVaultID(manifest string) string {
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, manifestVaultIDPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, manifestVaultIDPrefix))
+		}
+	}
+	return ""
+}
+
+// vaultByManifest finds the live vault whose chunks are exactly those of
+// manifest, or nil.
+func vaultByManifest(manifest string) *VaultRecord {
+	cids := manifestCIDs(manifest)
+	if len(cids) == 0 {
+		return nil
+	}
+	for _, rec := range vaults.List() {
+		if rec.Deletion == nil && slices.Equal(rec.CIDs, cids) {
+			return rec
+		}
+	}
+	return nil
+}
+
+// vaultByRootHash finds the vault with this Merkle root, or nil.
+func vaultByRootHash(rootHash string) *VaultRecord {
+	for _, rec := range vaults.List() {
+		if rec.RootHash == rootHash {
+			return rec
+		}
+	}
+	return nil
+}
+
+// manifestCIDs returns the chunk CIDs of a manifest in order.
+func manifestCIDs(manifest string) []string {
+	var cids []string
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cids = append(cids, line)
+	}
+	return cids
+}
@@ -2,27 +2,22 @@ package main
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
 // --- BLOCKCHAIN CONFIGURATION ---
-// We use a public free RPC for Sepolia so you don't have to create an Alchemy account yet.
-const RPC_URL = "https://ethereum-sepolia-rpc.publicnode.com"
-
-// DO NOT SHARE THIS PRIVATE KEY. This is your startup's master wallet that pays gas for users.
-const MASTER_KEY = "2191282A6ef15219DBf46f1BeD33185d5e8B9517"
-
-// The V2 Contract address you deployed earlier
-const CONTRACT_ADDRESS = "0x551Df3762c81604EAfFb4A82A7d0ff9F71CFF5bF"
+// rpc_url and contract_address pick the network and contract (see
+// config.go). The master wallet that pays gas for users is the key
+// provider's: eth_private_key with the env provider, or a key that never
+// leaves the token with KEY_PROVIDER=pkcs11.
 
 // The exact ABI definition for the secureVault function from your V2 Smart Contract
 const contractABI = `[{"inputs":[{"internalType":"string","name":"_fileName","type":"string"},{"internalType":"string","name":"_category","type":"string"},{"internalType":"string","name":"_originalHash","type":"string"},{"internalType":"string","name":"_rootHash","type":"string"},{"internalType":"string","name":"_manifestCID","type":"string"}],"name":"secureVault","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
@@ -30,26 +25,33 @@ const contractABI = `[{"inputs":[{"internalType":"string","name":"_fileName","ty
 func AnchorToBlockchain(fileName, category, originalHash, rootHash, manifestCID string) (string, error) {
 	fmt.Println("⛓️ [Ledger] Initiating Master Wallet Transaction...")
 
+	// outcome names the step in progress, so an early return records
+	// where the anchoring failed.
+	started, outcome := time.Now(), "rpc_error"
+	defer func() {
+		metricAnchors.inc(outcome)
+		result := "error"
+		if outcome == "success" {
+			result = "ok"
+		}
+		metricAnchorDuration.observe(time.Since(started).Seconds(), result)
+	}()
+
 	// 1. Connect to the Ethereum Network
-	client, err := ethclient.Dial(RPC_URL)
+	client, err := ethclient.Dial(cfg.RPCURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to connect to Ethereum RPC: %v", err)
 	}
 
-	// 2. Load the Master Wallet Private Key
-	privateKey, err := crypto.HexToECDSA(MASTER_KEY)
+	// 2. Resolve the Master Wallet address (the key itself stays in the provider)
+	outcome = "wallet_unavailable"
+	fromAddress, err := keyProvider.EthereumAddress()
 	if err != nil {
-		return "", fmt.Errorf("invalid private key: %v", err)
-	}
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return "", fmt.Errorf("error casting public key to ECDSA")
+		return "", fmt.Errorf("master wallet unavailable: %v", err)
 	}
 
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-
 	// 3. Get Network Gas Price and Account Nonce
+	outcome = "rpc_error"
 	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
 	if err != nil {
 		return "", err
@@ -60,6 +62,7 @@ func AnchorToBlockchain(fileName, category, originalHash, rootHash, manifestCID
 	}
 
 	// 4. Pack the Smart Contract Arguments
+	outcome = "encode_error"
 	parsedABI, err := abi.JSON(strings.NewReader(contractABI))
 	if err != nil {
 		return "", err
@@ -70,23 +73,32 @@ func AnchorToBlockchain(fileName, category, originalHash, rootHash, manifestCID
 	}
 
 	// 5. Create the Transaction
-	toAddress := common.HexToAddress(CONTRACT_ADDRESS)
+	toAddress := common.HexToAddress(cfg.ContractAddress)
 	tx := types.NewTransaction(nonce, toAddress, big.NewInt(0), uint64(3000000), gasPrice, data)
+	outcome = "rpc_error"
 	chainID, err := client.NetworkID(context.Background())
 	if err != nil {
 		return "", err
 	}
 
-	// 6. Sign and Send the Transaction
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
+	// 6. Sign (via the key provider) and Send the Transaction
+	outcome = "sign_error"
+	signer := types.NewEIP155Signer(chainID)
+	sig, err := keyProvider.SignEthereum(signer.Hash(tx).Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %v", err)
+	}
+	signedTx, err := tx.WithSignature(signer, sig)
 	if err != nil {
 		return "", err
 	}
+	outcome = "send_error"
 	err = client.SendTransaction(context.Background(), signedTx)
 	if err != nil {
 		return "", err
 	}
 
+	outcome = "success"
 	txHash := signedTx.Hash().Hex()
 	fmt.Printf("✅ [Ledger] Anchored to Sepolia! TX Hash: %s\n", txHash)
 
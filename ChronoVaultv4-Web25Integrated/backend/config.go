@@ -0,0 +1,474 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// --- Configuration ---
+//
+// Every setting of the server and the CLI lives in one typed Config. Each
+// has a key (e.g. "chunk_size"), read from these sources, later ones
+// winning:
+//
+//  1. the default in defaultConfig
+//  2. the config file: -config, else CHRONOVAULT_CONFIG, else
+//     chronovault.json when it exists. A flat JSON object of key: value
+//  3. the file's profile: the "profiles" object holds one set of keys per
+//     environment, and -profile, CHRONOVAULT_PROFILE or the file's
+//     "profile" key picks one
+//  4. the environment variable named after the key in upper case
+//     (CHUNK_SIZE)
+//  5. a flag before the command, with dashes for underscores
+//     (-chunk-size 512KB)
+//
+// The result is validated before any command runs, and a bad value stops
+// the process. The server prints the effective configuration at startup,
+// with secrets redacted and the source of each value; "chronovault config"
+// prints it without starting anything.
+
+const (
+	maxChunkSize        = 4 << 20 // upper bound for chunk_size
+	defaultConfigFile   = "chronovault.json"
+	configRedacted      = "[redacted]"
+	configSourceDefault = "default"
+)
+
+// Config is the effective configuration. Its tags name each setting's key;
+// ",secret" keeps the value out of the dump.
+type Config struct {
+	// HTTP server and storage
+	HTTPAddr      string   `config:"http_addr"`
+	MaxUploadSize byteSize `config:"max_upload_size"`
+	StoreFolder   string   `config:"store_folder"`
+	ChunkSize     byteSize `config:"chunk_size"`
+	PinataAPIURL  string   `config:"pinata_api_url"`
+	MetricsToken  string   `config:"metrics_token,secret"`
+	MetricsAddr   string   `config:"metrics_addr"`
+
+	// On-chain anchoring
+	RPCURL          string `config:"rpc_url"`
+	ContractAddress string `config:"contract_address"`
+	EthPrivateKey   string `config:"eth_private_key,secret"`
+
+	// Vault registry. An empty registry is Postgres for the server, and
+	// no registry at all for the CLI simulation (see registry.go).
+	Registry    string `config:"registry"`
+	DatabaseURL string `config:"database_url,secret"`
+	SQLitePath  string `config:"sqlite_path"`
+
+	// Keys
+	KeyProvider            string `config:"key_provider"`
+	VaultKEK               string `config:"vault_kek,secret"`
+	ManifestSigningKey     string `config:"manifest_signing_key,secret"`
+	RequireSignedManifests bool   `config:"require_signed_manifests"`
+	PKCS11Module           string `config:"pkcs11_module"`
+	PKCS11TokenLabel       string `config:"pkcs11_token_label"`
+	PKCS11PIN              string `config:"pkcs11_pin,secret"`
+	PKCS11KEKLabel         string `config:"pkcs11_kek_label"`
+	PKCS11SigningKeyLabel  string `config:"pkcs11_signing_key_label"`
+	PKCS11EthKeyLabel      string `config:"pkcs11_eth_key_label"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		HTTPAddr:      ":8080",
+		MaxUploadSize: 10 << 20,
+		StoreFolder:   "shredded_store",
+		ChunkSize:     256 << 10,
+		PinataAPIURL:  "https://api.pinata.cloud",
+
+		// A public free RPC for Sepolia, so no Alchemy account is needed yet.
+		RPCURL: "https://ethereum-sepolia-rpc.publicnode.com",
+		// The V2 contract deployed earlier.
+		ContractAddress: "0x551Df3762c81604EAfFb4A82A7d0ff9F71CFF5bF",
+
+		SQLitePath: "chronovault.db",
+
+		KeyProvider:           "env",
+		PKCS11KEKLabel:        "chronovault-kek",
+		PKCS11SigningKeyLabel: "chronovault-manifest",
+		PKCS11EthKeyLabel:     "chronovault-eth",
+	}
+}
+
+// normalize tidies values that are easy to write more than one way.
+func (c *Config) normalize() {
+	c.PinataAPIURL = strings.TrimRight(c.PinataAPIURL, "/")
+	c.EthPrivateKey = strings.TrimPrefix(strings.TrimSpace(c.EthPrivateKey), "0x")
+}
+
+// validate reports every invalid setting at once.
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(key, v string, allowed ...string) {
+		for _, a := range allowed {
+			if strings.EqualFold(v, a) {
+				return
+			}
+		}
+		check(false, "%s must be one of %s, not %q", key, strings.Join(allowed, ", "), v)
+	}
+	absURL := func(key, v string, schemes ...string) {
+		u, err := url.Parse(v)
+		ok := err == nil && u.Host != ""
+		if ok {
+			ok = false
+			for _, s := range schemes {
+				ok = ok || u.Scheme == s
+			}
+		}
+		check(ok, "%s must be a %s URL", key, strings.Join(schemes, " or "))
+	}
+	hexKey := func(key, v string) {
+		if v != "" {
+			b, err := hex.DecodeString(strings.TrimSpace(v))
+			check(err == nil && len(b) == 32, "%s must be 32 hex-encoded bytes", key)
+		}
+	}
+
+	check(c.HTTPAddr != "", "http_addr is required")
+	check(c.MetricsAddr != c.HTTPAddr, "metrics_addr must differ from http_addr")
+	check(c.MaxUploadSize > 0 && c.MaxUploadSize <= 1<<30, "max_upload_size must be between 1 byte and 1GB")
+	check(c.StoreFolder != "", "store_folder is required")
+	check(c.ChunkSize >= 1<<10 && c.ChunkSize <= maxChunkSize, "chunk_size must be between 1KB and %v", byteSize(maxChunkSize))
+	absURL("pinata_api_url", c.PinataAPIURL, "https", "http")
+
+	absURL("rpc_url", c.RPCURL, "https", "http", "wss", "ws")
+	check(common.IsHexAddress(c.ContractAddress), "contract_address must be a 0x-prefixed Ethereum address")
+	hexKey("eth_private_key", c.EthPrivateKey)
+
+	if c.Registry != "" {
+		oneOf("registry", c.Registry, "postgres", "sqlite", "memory")
+	}
+	if strings.Contains(c.DatabaseURL, "://") { // key=value DSNs are left to lib/pq
+		absURL("database_url", c.DatabaseURL, "postgres", "postgresql")
+	}
+	check(c.SQLitePath != "", "sqlite_path is required")
+
+	oneOf("key_provider", c.KeyProvider, "env", "pkcs11")
+	hexKey("vault_kek", c.VaultKEK)
+	hexKey("manifest_signing_key", c.ManifestSigningKey)
+	if strings.EqualFold(c.KeyProvider, "pkcs11") {
+		check(c.PKCS11Module != "" && c.PKCS11TokenLabel != "" && c.PKCS11PIN != "",
+			"pkcs11_module, pkcs11_token_label and pkcs11_pin are required with key_provider pkcs11")
+	}
+
+	return errors.Join(errs...)
+}
+
+// cfg is the configuration every command runs with. It holds the defaults
+// until initConfig loads the real one.
+var cfg = defaultConfig()
+
+// configInfo records how cfg was loaded, for printConfig.
+var configInfo struct {
+	file    string
+	profile string
+	sources map[string]string // key -> where its value came from
+}
+
+// initConfig loads cfg from the global flags at the start of args and
+// returns the rest. An invalid configuration ends the process.
+func initConfig(args []string, usage func()) []string {
+	fs := flag.NewFlagSet("chronovault", flag.ExitOnError)
+	fs.Usage = usage
+	file := fs.String("config", "", "config file (default $CHRONOVAULT_CONFIG or "+defaultConfigFile+")")
+	profile := fs.String("profile", "", "profile in the config file (default $CHRONOVAULT_PROFILE)")
+	var flags [][2]string
+	for _, f := range defaultConfig().fields() {
+		key := f.key
+		fs.Func(strings.ReplaceAll(key, "_", "-"), "overrides "+strings.ToUpper(key), func(v string) error {
+			flags = append(flags, [2]string{key, v})
+			return nil
+		})
+	}
+	fs.Parse(args)
+
+	c, err := loadConfig(*file, *profile, flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	cfg = c
+	return fs.Args()
+}
+
+// loadConfig layers the sources described above over the defaults.
+// flags are key/value pairs in command-line order.
+func loadConfig(file, profile string, flags [][2]string) (*Config, error) {
+	c := defaultConfig()
+	list := c.fields()
+	fields := map[string]configField{}
+	for _, f := range list {
+		fields[f.key] = f
+	}
+	sources := map[string]string{}
+	set := func(key, value, source string) error {
+		f, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if err := f.set(value); err != nil {
+			return fmt.Errorf("%s (from %s): %w", key, source, err)
+		}
+		sources[key] = source
+		return nil
+	}
+
+	if file == "" {
+		file = os.Getenv("CHRONOVAULT_CONFIG")
+	}
+	if file == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			file = defaultConfigFile
+		}
+	}
+	var profiles map[string]map[string]json.RawMessage
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if raw, ok := doc["profiles"]; ok {
+			if err := json.Unmarshal(raw, &profiles); err != nil {
+				return nil, fmt.Errorf("%s: profiles: %w", file, err)
+			}
+			delete(doc, "profiles")
+		}
+		if raw, ok := doc["profile"]; ok {
+			var name string
+			if err := json.Unmarshal(raw, &name); err != nil {
+				return nil, fmt.Errorf("%s: profile must be a string", file)
+			}
+			if profile == "" && os.Getenv("CHRONOVAULT_PROFILE") == "" {
+				profile = name
+			}
+			delete(doc, "profile")
+		}
+		if err := applyConfigJSON(doc, "file", set); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	if profile == "" {
+		profile = os.Getenv("CHRONOVAULT_PROFILE")
+	}
+	if profile != "" {
+		keys, ok := profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("profile %q is not defined in %s", profile, orNone(file))
+		}
+		if err := applyConfigJSON(keys, "profile "+profile, set); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	for _, f := range list {
+		if v := os.Getenv(strings.ToUpper(f.key)); v != "" {
+			if err := set(f.key, v, "env"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, kv := range flags {
+		if err := set(kv[0], kv[1], "flag"); err != nil {
+			return nil, err
+		}
+	}
+
+	c.normalize()
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	configInfo.file, configInfo.profile, configInfo.sources = file, profile, sources
+	return c, nil
+}
+
+// applyConfigJSON sets each key of doc. Values may be JSON strings, numbers,
+// booleans or lists of strings.
+func applyConfigJSON(doc map[string]json.RawMessage, source string, set func(key, value, source string) error) error {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		raw := doc[key]
+		var v string
+		var list []string
+		var scalar interface{}
+		switch {
+		case json.Unmarshal(raw, &v) == nil:
+		case json.Unmarshal(raw, &list) == nil:
+			v = strings.Join(list, ",")
+		case json.Unmarshal(raw, &scalar) == nil && scalar != nil:
+			if _, ok := scalar.(map[string]interface{}); ok {
+				return fmt.Errorf("%s: want a string, number, boolean or list", key)
+			}
+			if _, ok := scalar.([]interface{}); ok {
+				return fmt.Errorf("%s: want a list of strings", key)
+			}
+			v = strings.TrimSpace(string(raw))
+		default:
+			return fmt.Errorf("%s: want a string, number, boolean or list", key)
+		}
+		if err := set(key, v, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printConfig writes the effective configuration, one setting per line
+// with where its value came from. Secrets show only whether they are set.
+func printConfig(w io.Writer) {
+	fmt.Fprintf(w, "⚙️  Configuration (file: %s, profile: %s)\n", orNone(configInfo.file), orNone(configInfo.profile))
+	for _, f := range cfg.fields() {
+		v := f.String()
+		if f.secret && v != "" {
+			v = configRedacted
+		}
+		if v == "" {
+			v = `""`
+		}
+		source := configInfo.sources[f.key]
+		if source == "" {
+			source = configSourceDefault
+		}
+		fmt.Fprintf(w, "   %-26s %-44s %s\n", f.key, v, source)
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// --- Fields ---
+
+// configField is one tagged field of a Config.
+type configField struct {
+	key    string
+	secret bool
+	ptr    interface{}
+}
+
+func (c *Config) fields() []configField {
+	v := reflect.ValueOf(c).Elem()
+	var out []configField
+	for i := 0; i < v.NumField(); i++ {
+		tag := v.Type().Field(i).Tag.Get("config")
+		if tag == "" {
+			continue
+		}
+		key, opt, _ := strings.Cut(tag, ",")
+		out = append(out, configField{key: key, secret: opt == "secret", ptr: v.Field(i).Addr().Interface()})
+	}
+	return out
+}
+
+func (f configField) set(s string) error {
+	s = strings.TrimSpace(s)
+	var err error
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = s
+	case *bool:
+		*p, err = strconv.ParseBool(s)
+	case *int:
+		*p, err = strconv.Atoi(s)
+	case *uint64:
+		*p, err = strconv.ParseUint(s, 10, 64)
+	case *float64:
+		*p, err = strconv.ParseFloat(s, 64)
+	case *time.Duration:
+		*p, err = time.ParseDuration(s)
+	case *byteSize:
+		*p, err = parseByteSize(s)
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %T", f.ptr)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q", s)
+	}
+	return nil
+}
+
+func (f configField) String() string {
+	switch p := f.ptr.(type) {
+	case *string:
+		return *p
+	case *[]string:
+		return strings.Join(*p, ",")
+	default:
+		return fmt.Sprint(reflect.ValueOf(p).Elem().Interface())
+	}
+}
+
+// byteSize is a size in bytes. It reads plain numbers and KB, MB or GB
+// (powers of 1024).
+type byteSize int64
+
+func parseByteSize(s string) (byteSize, error) {
+	units := []struct {
+		suffix string
+		n      int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, mult = strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/mult {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return byteSize(n * mult), nil
+}
+
+func (b byteSize) String() string {
+	switch {
+	case b >= 1<<30 && b%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", b>>30)
+	case b >= 1<<20 && b%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", b>>20)
+	case b >= 1<<10 && b%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", b>>10)
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
@@ -36,8 +36,9 @@ func EncryptAndStore(originalData []byte, filename string, vaultTier string) {
 
 	// 4. Shred and Store Chunks
 	var chunkHashes []string
-	for i := 0; i < len(encryptedData); i += ChunkSize {
-		end := i + ChunkSize
+	chunkSize := int(cfg.ChunkSize)
+	for i := 0; i < len(encryptedData); i += chunkSize {
+		end := i + chunkSize
 		if end > len(encryptedData) {
 			end = len(encryptedData)
 		}
@@ -47,9 +48,10 @@ func EncryptAndStore(originalData []byte, filename string, vaultTier string) {
 		hash := HashData(chunk)
 
 		// Write to "Network" (Disk)
-		path := filepath.Join(StoreFolder, hash)
+		path := filepath.Join(cfg.StoreFolder, hash)
 		err := os.WriteFile(path, chunk, 0644)
 		Check(err)
+		metricChunksStored.inc()
 
 		chunkHashes = append(chunkHashes, hash)
 	}
@@ -67,5 +69,10 @@ func EncryptAndStore(originalData []byte, filename string, vaultTier string) {
 	for _, h := range chunkHashes {
 		manifestContent += h + "\n"
 	}
+	if signed, err := signManifest(manifestContent); err != nil {
+		fmt.Printf("[Enc] ⚠️ Manifest signing failed, saving unsigned: %v\n", err)
+	} else {
+		manifestContent = signed
+	}
 	os.WriteFile("manifest_"+filename, []byte(manifestContent), 0644)
 }
@@ -9,8 +9,6 @@ import (
 	"net/http"
 )
 
-const PinataAPI = "https://api.pinata.cloud/pinning/pinFileToIPFS"
-
 type PinataResponse struct {
 	IpfsHash string `json:"IpfsHash"`
 }
@@ -19,6 +17,9 @@ type PinataResponse struct {
 func PushToSwarm(encryptedData []byte, filename string, jwt string) (string, error) {
 	fmt.Println("🌐 [Swarm] Pushing encrypted artifact to IPFS via Pinata...")
 
+	outcome := "error"
+	defer func() { metricIPFSPushes.inc(outcome) }()
+
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
@@ -31,7 +32,7 @@ func PushToSwarm(encryptedData []byte, filename string, jwt string) (string, err
 	writer.Close()
 
 	// Build the HTTP POST request to Pinata
-	req, err := http.NewRequest("POST", PinataAPI, body)
+	req, err := http.NewRequest("POST", cfg.PinataAPIURL+"/pinning/pinFileToIPFS", body)
 	if err != nil {
 		return "", err
 	}
@@ -58,6 +59,7 @@ func PushToSwarm(encryptedData []byte, filename string, jwt string) (string, err
 	var pinataResp PinataResponse
 	json.NewDecoder(resp.Body).Decode(&pinataResp)
 
+	outcome = "ok"
 	fmt.Printf("✅ [Swarm] Artifact secured on IPFS! CID: %s\n", pinataResp.IpfsHash)
 	return pinataResp.IpfsHash, nil
 }
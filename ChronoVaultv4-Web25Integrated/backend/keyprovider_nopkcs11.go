@@ -0,0 +1,10 @@
+//go:build !pkcs11
+
+package main
+
+import "fmt"
+
+// newPKCS11KeyProvider is a stub for builds without cgo / the pkcs11 tag.
+func newPKCS11KeyProvider() (KeyProvider, error) {
+	return nil, fmt.Errorf("this binary was built without PKCS#11 support (rebuild with -tags pkcs11)")
+}
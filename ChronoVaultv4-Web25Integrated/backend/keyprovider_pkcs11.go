@@ -0,0 +1,328 @@
+//go:build pkcs11
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/miekg/pkcs11"
+)
+
+// --- PKCS#11 Provider ---
+//
+// Configuration (all via environment):
+//
+//	PKCS11_MODULE             path to the vendor library, e.g.
+//	                          /usr/lib/softhsm/libsofthsm2.so
+//	PKCS11_TOKEN_LABEL        label of the token holding the keys
+//	PKCS11_PIN                user PIN for that token
+//	PKCS11_KEK_LABEL          AES-256 secret key   (default "chronovault-kek")
+//	PKCS11_SIGNING_KEY_LABEL  EC P-256 key pair    (default "chronovault-manifest")
+//	PKCS11_ETH_KEY_LABEL      EC secp256k1 key pair (default "chronovault-eth")
+//
+// Keys are looked up by CKA_LABEL and must be created non-extractable on the
+// token; the server only ever holds object handles.
+
+type pkcs11KeyProvider struct {
+	mu      sync.Mutex // a PKCS#11 session must not be used concurrently
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+
+	kek        pkcs11.ObjectHandle
+	signKey    pkcs11.ObjectHandle
+	verifyKey  pkcs11.ObjectHandle
+	hasKEK     bool
+	hasSignKey bool
+
+	ethKey     pkcs11.ObjectHandle
+	ethPubKey  []byte // uncompressed secp256k1 point from CKA_EC_POINT
+	ethAddress common.Address
+	hasEthKey  bool
+}
+
+func newPKCS11KeyProvider() (KeyProvider, error) {
+	module := cfg.PKCS11Module
+	tokenLabel := cfg.PKCS11TokenLabel
+	pin := cfg.PKCS11PIN
+	if module == "" || tokenLabel == "" || pin == "" {
+		return nil, fmt.Errorf("PKCS11_MODULE, PKCS11_TOKEN_LABEL and PKCS11_PIN must all be set")
+	}
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("PKCS#11 initialize failed: %w", err)
+	}
+
+	p := &pkcs11KeyProvider{ctx: ctx}
+	if err := p.open(tokenLabel, pin); err != nil {
+		p.Close()
+		return nil, err
+	}
+
+	var err error
+	kekLabel := cfg.PKCS11KEKLabel
+	if p.kek, p.hasKEK, err = p.findObject(pkcs11.CKO_SECRET_KEY, kekLabel); err != nil {
+		p.Close()
+		return nil, err
+	}
+	signLabel := cfg.PKCS11SigningKeyLabel
+	if p.signKey, p.hasSignKey, err = p.findObject(pkcs11.CKO_PRIVATE_KEY, signLabel); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if p.hasSignKey {
+		var ok bool
+		if p.verifyKey, ok, err = p.findObject(pkcs11.CKO_PUBLIC_KEY, signLabel); err != nil || !ok {
+			p.Close()
+			return nil, fmt.Errorf("public half of %q not found on token", signLabel)
+		}
+	}
+
+	ethLabel := cfg.PKCS11EthKeyLabel
+	if p.ethKey, p.hasEthKey, err = p.findObject(pkcs11.CKO_PRIVATE_KEY, ethLabel); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if p.hasEthKey {
+		if err := p.loadEthPublicKey(ethLabel); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+
+	fmt.Printf("🔐 PKCS#11 token %q opened (KEK: %v, manifest key: %v, wallet: %v)\n", tokenLabel, p.hasKEK, p.hasSignKey, p.hasEthKey)
+	return p, nil
+}
+
+// open finds the slot whose token carries tokenLabel and logs in to it.
+func (p *pkcs11KeyProvider) open(tokenLabel, pin string) error {
+	slots, err := p.ctx.GetSlotList(true)
+	if err != nil {
+		return fmt.Errorf("PKCS#11 slot list failed: %w", err)
+	}
+	for _, slot := range slots {
+		info, err := p.ctx.GetTokenInfo(slot)
+		if err != nil || info.Label != tokenLabel {
+			continue
+		}
+		session, err := p.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return fmt.Errorf("PKCS#11 open session failed: %w", err)
+		}
+		p.session = session
+		if err := p.ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+			return fmt.Errorf("PKCS#11 login failed: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no PKCS#11 token labelled %q", tokenLabel)
+}
+
+func (p *pkcs11KeyProvider) findObject(class uint, label string) (pkcs11.ObjectHandle, bool, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := p.ctx.FindObjectsInit(p.session, template); err != nil {
+		return 0, false, fmt.Errorf("PKCS#11 find %q failed: %w", label, err)
+	}
+	defer p.ctx.FindObjectsFinal(p.session)
+
+	handles, _, err := p.ctx.FindObjects(p.session, 2)
+	if err != nil {
+		return 0, false, fmt.Errorf("PKCS#11 find %q failed: %w", label, err)
+	}
+	switch len(handles) {
+	case 0:
+		return 0, false, nil
+	case 1:
+		return handles[0], true, nil
+	default:
+		return 0, false, fmt.Errorf("label %q is ambiguous on token", label)
+	}
+}
+
+func (p *pkcs11KeyProvider) Name() string { return "pkcs11" }
+
+func (p *pkcs11KeyProvider) WrapKey(dataKey []byte) ([]byte, error) {
+	if !p.hasKEK {
+		return nil, fmt.Errorf("PKCS#11 KEK: %w", errKeyUnavailable)
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("CSPRNG failure generating nonce: %w", err)
+	}
+	params := pkcs11.NewGCMParams(nonce, kekAAD, 128)
+	defer params.Free()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}
+	if err := p.ctx.EncryptInit(p.session, mech, p.kek); err != nil {
+		return nil, fmt.Errorf("PKCS#11 wrap init failed: %w", err)
+	}
+	sealed, err := p.ctx.Encrypt(p.session, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 wrap failed: %w", err)
+	}
+	return append(nonce, sealed...), nil
+}
+
+func (p *pkcs11KeyProvider) UnwrapKey(wrapped []byte) ([]byte, error) {
+	if !p.hasKEK {
+		return nil, fmt.Errorf("PKCS#11 KEK: %w", errKeyUnavailable)
+	}
+	if len(wrapped) < 12 {
+		return nil, fmt.Errorf("wrapped key is truncated")
+	}
+	params := pkcs11.NewGCMParams(wrapped[:12], kekAAD, 128)
+	defer params.Free()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}
+	if err := p.ctx.DecryptInit(p.session, mech, p.kek); err != nil {
+		return nil, fmt.Errorf("PKCS#11 unwrap init failed: %w", err)
+	}
+	dataKey, err := p.ctx.Decrypt(p.session, wrapped[12:])
+	if err != nil {
+		return nil, fmt.Errorf("key unwrap failed — wrong KEK or corrupted escrow")
+	}
+	return dataKey, nil
+}
+
+// SignManifest hashes locally and lets the token sign the digest with
+// CKM_ECDSA, which already returns the raw r||s form.
+func (p *pkcs11KeyProvider) SignManifest(data []byte) ([]byte, error) {
+	if !p.hasSignKey {
+		return nil, fmt.Errorf("PKCS#11 manifest key: %w", errKeyUnavailable)
+	}
+	digest := sha256.Sum256(data)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.ctx.SignInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, p.signKey); err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign init failed: %w", err)
+	}
+	sig, err := p.ctx.Sign(p.session, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign failed: %w", err)
+	}
+	return sig, nil
+}
+
+func (p *pkcs11KeyProvider) VerifyManifest(data, sig []byte) error {
+	if !p.hasSignKey {
+		return fmt.Errorf("PKCS#11 manifest key: %w", errKeyUnavailable)
+	}
+	digest := sha256.Sum256(data)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.ctx.VerifyInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, p.verifyKey); err != nil {
+		return fmt.Errorf("PKCS#11 verify init failed: %w", err)
+	}
+	if err := p.ctx.Verify(p.session, digest[:], sig); err != nil {
+		return fmt.Errorf("invalid manifest signature")
+	}
+	return nil
+}
+
+// loadEthPublicKey reads the wallet's public point so signatures can be given
+// a recovery ID and the sender address is known without touching the key.
+func (p *pkcs11KeyProvider) loadEthPublicKey(label string) error {
+	pubHandle, ok, err := p.findObject(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil || !ok {
+		return fmt.Errorf("public half of %q not found on token", label)
+	}
+	attrs, err := p.ctx.GetAttributeValue(p.session, pubHandle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil || len(attrs) != 1 {
+		return fmt.Errorf("failed to read CKA_EC_POINT for %q: %v", label, err)
+	}
+	// CKA_EC_POINT is a DER OCTET STRING wrapping the uncompressed point.
+	var point []byte
+	if _, err := asn1.Unmarshal(attrs[0].Value, &point); err != nil {
+		point = attrs[0].Value
+	}
+	pub, err := crypto.UnmarshalPubkey(point)
+	if err != nil {
+		return fmt.Errorf("%q is not a secp256k1 key: %v", label, err)
+	}
+	p.ethPubKey = crypto.FromECDSAPub(pub)
+	p.ethAddress = crypto.PubkeyToAddress(*pub)
+	return nil
+}
+
+func (p *pkcs11KeyProvider) EthereumAddress() (common.Address, error) {
+	if !p.hasEthKey {
+		return common.Address{}, fmt.Errorf("PKCS#11 wallet key: %w", errKeyUnavailable)
+	}
+	return p.ethAddress, nil
+}
+
+// SignEthereum has the token produce r||s, normalises s to the lower half of
+// the curve order (EIP-2) and finds the recovery ID by trial recovery.
+func (p *pkcs11KeyProvider) SignEthereum(hash []byte) ([]byte, error) {
+	if !p.hasEthKey {
+		return nil, fmt.Errorf("PKCS#11 wallet key: %w", errKeyUnavailable)
+	}
+
+	p.mu.Lock()
+	if err := p.ctx.SignInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)}, p.ethKey); err != nil {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("PKCS#11 sign init failed: %w", err)
+	}
+	raw, err := p.ctx.Sign(p.session, hash)
+	p.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 sign failed: %w", err)
+	}
+	if len(raw) != 64 {
+		return nil, fmt.Errorf("unexpected secp256k1 signature length: %d", len(raw))
+	}
+
+	n := crypto.S256().Params().N
+	s := new(big.Int).SetBytes(raw[32:])
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	sig := make([]byte, 65)
+	copy(sig[:32], raw[:32])
+	s.FillBytes(sig[32:64])
+
+	for v := byte(0); v < 2; v++ {
+		sig[64] = v
+		if pub, err := crypto.Ecrecover(hash, sig); err == nil && bytes.Equal(pub, p.ethPubKey) {
+			return sig, nil
+		}
+	}
+	return nil, fmt.Errorf("could not determine recovery ID for token signature")
+}
+
+func (p *pkcs11KeyProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session != 0 {
+		p.ctx.Logout(p.session)
+		p.ctx.CloseSession(p.session)
+		p.session = 0
+	}
+	p.ctx.Finalize()
+	p.ctx.Destroy()
+	return nil
+}
@@ -1,18 +1,18 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"os"
+	"time"
 )
 
-// --- Shared Configuration & Structs ---
-
-const (
-	ChunkSize   = 256 * 1024 // 256KB chunks
-	StoreFolder = "shredded_store"
-)
+// --- Shared Structs ---
+//
+// Settings such as the chunk size and the store folder live in cfg
+// (see config.go).
 
 // MerkleNode is used by both encrypt and decrypt
 type MerkleNode struct {
@@ -23,21 +23,49 @@ type MerkleNode struct {
 // --- Main Entry Point ---
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "server" || os.Args[1] == "web") {
+	args := initConfig(os.Args[1:], printUsage)
+	if len(args) > 0 && (args[0] == "server" || args[0] == "web") {
 		startServer()
 		return
 	}
+	if len(args) > 0 && args[0] == "config" {
+		printConfig(os.Stdout)
+		return
+	}
+	if len(args) > 0 && args[0] == "vaults" {
+		owner := "cli"
+		if len(args) > 1 {
+			owner = args[1]
+		}
+		if err := runVaultList(owner); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	runSimulation()
 }
 
+func printUsage() {
+	fmt.Println("Usage: chronovault [-config file] [-profile name] [-<setting> value ...] [command]")
+	fmt.Println()
+	fmt.Println("  (none)            run the local encrypt/restore simulation")
+	fmt.Println("  server | web      start the HTTP server")
+	fmt.Println("  config            print the effective configuration, secrets redacted")
+	fmt.Println("  vaults [owner]    list an owner's vaults and their audit trails")
+	fmt.Println()
+	fmt.Println("Any setting can be given as a flag before the command, e.g. -chunk-size 512KB;")
+	fmt.Println("`chronovault config` lists them.")
+}
+
 func runSimulation() {
 	// Define the file to work on
 	inputFile := "original.txt"
 
 	// 1. Prepare Environment
-	os.RemoveAll(StoreFolder)
-	os.Mkdir(StoreFolder, 0755)
+	os.RemoveAll(cfg.StoreFolder)
+	os.Mkdir(cfg.StoreFolder, 0755)
 
 	// Create a dummy file if it doesn't exist
 	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
@@ -46,6 +74,8 @@ func runSimulation() {
 	}
 
 	fmt.Println("=== STARTING DECENTRALIZED STORAGE PIPELINE ===")
+	initKeyProvider()
+	defer keyProvider.Close()
 
 	// 2. Read Input File
 	fmt.Printf("[Main] Reading input file: %s\n", inputFile)
@@ -55,11 +85,48 @@ func runSimulation() {
 	// 3. Trigger Encryption Pipeline (defined in encrypt.go)
 	EncryptAndStore(originalData, inputFile, "standard")
 
+	// Track the vault when a registry is configured (REGISTRY=sqlite needs
+	// no database server)
+	var vault *VaultRow
+	if cfg.Registry != "" {
+		initRegistry()
+		defer registry.Close()
+		vault = registerLocalVault(inputFile, "standard")
+	}
+
 	fmt.Println("\n------------------------------------------------")
 	fmt.Println("   (Network Simulation: Transferring files...)")
 
 	// 4. Trigger Decryption Pipeline (defined in decrypt.go)
 	DecryptAndRestore(inputFile)
+	if vault != nil {
+		registry.RecordRetrieval(context.Background(), vault.RootHash, time.Now().UTC())
+		recordEvent(context.Background(), vault.RootHash, vault.OwnerID, "retrieve", "simulation")
+	}
+}
+
+// registerLocalVault registers the artifacts EncryptAndStore wrote for
+// filename under the "cli" owner.
+func registerLocalVault(filename, tier string) *VaultRow {
+	originalHash, _ := os.ReadFile(fmt.Sprintf("hash_%s.txt", filename))
+	rootHash, _ := os.ReadFile(fmt.Sprintf("roothash_%s.txt", filename))
+	manifest, _ := os.ReadFile("manifest_" + filename)
+	vault := &VaultRow{
+		OwnerID:      "cli",
+		FileName:     filename,
+		Tier:         tier,
+		RootHash:     string(rootHash),
+		OriginalHash: string(originalHash),
+		Manifest:     string(manifest),
+		Chunks:       manifestChunks(string(manifest)),
+	}
+	if err := registry.CreateVault(context.Background(), vault); err != nil {
+		fmt.Printf("[Main] Vault registry write failed: %v\n", err)
+		return nil
+	}
+	fmt.Printf("[Main] Vault #%d registered (%s registry)\n", vault.ID, registry.Name())
+	recordEvent(context.Background(), vault.RootHash, vault.OwnerID, "upload", fmt.Sprintf("%s, %s tier, %d chunks", filename, tier, len(vault.Chunks)))
+	return vault
 }
 
 // --- Shared Helper Functions ---
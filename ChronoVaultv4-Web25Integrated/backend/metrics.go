@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Metrics ---
+//
+// GET /metrics serves the counters and histograms below in the Prometheus
+// text format (version 0.0.4), so the pipeline can be watched without
+// reading the console. The README lists every metric and its labels; keep
+// it in step when adding one here. Label values are always from a small
+// fixed set: never put a user ID, file name or CID in a label.
+//
+// The endpoint is never open to whoever can reach the server. With
+// metrics_addr set it gets a listener of its own, meant for a private
+// interface; otherwise it is only served on the main listener when
+// metrics_token is set. metrics_token, when set, is required on either:
+// scrapes send "Authorization: Bearer <token>".
+//
+// The other ChronoVault backends carry a copy of this file. Apart from the
+// metric definitions and the error responses the copies are identical, so
+// a fix to one belongs in all of them.
+
+var (
+	metricUploadDuration = newHistogram("chronovault_upload_duration_seconds",
+		"Time to encrypt, shred and register an upload.", durationBuckets, "outcome")
+	metricRetrieveDuration = newHistogram("chronovault_retrieve_duration_seconds",
+		"Time to answer a retrieve, from form parsing to the decrypted file.", durationBuckets, "outcome")
+	metricBytes = newCounter("chronovault_bytes_processed_total",
+		"Plaintext bytes encrypted by uploads or decrypted by retrieves.", "operation")
+	metricChunksStored = newCounter("chronovault_chunks_stored_total",
+		"Encrypted chunks written to the store folder.")
+
+	metricIPFSPushes = newCounter("chronovault_ipfs_pushes_total",
+		"Artifacts pushed to IPFS by PushToSwarm.", "outcome")
+
+	metricAnchors = newCounter("chronovault_anchor_transactions_total",
+		"AnchorToBlockchain calls, by the step that failed or success.", "outcome")
+	metricAnchorDuration = newHistogram("chronovault_anchor_duration_seconds",
+		"Time to build, sign and send an anchoring transaction.", durationBuckets, "outcome")
+
+	metricAIProcess = newHistogram("chronovault_ai_process_duration_seconds",
+		"Run time of the Python biometric processes, console interaction included.", aiBuckets, "process", "outcome")
+)
+
+var (
+	durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	aiBuckets       = []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+)
+
+// outcomeLabel is "ok" for a nil error and "error" otherwise.
+func outcomeLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// observeAIProcess records how long a Python process ran and passes its
+// Wait error through.
+func observeAIProcess(process string, started time.Time, err error) error {
+	metricAIProcess.observe(time.Since(started).Seconds(), process, outcomeLabel(err))
+	return err
+}
+
+// registerMetrics serves /metrics as described at the top of this file.
+func registerMetrics() {
+	switch {
+	case cfg.MetricsAddr != "":
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", metricsHandler)
+		server := &http.Server{Addr: cfg.MetricsAddr, Handler: mux, ReadTimeout: 10 * time.Second, WriteTimeout: 10 * time.Second}
+		fmt.Printf("[Metrics] Serving /metrics on %s\n", cfg.MetricsAddr)
+		go func() {
+			if err := server.ListenAndServe(); err != nil {
+				fmt.Printf("[Metrics] Listener on %s stopped: %v\n", cfg.MetricsAddr, err)
+			}
+		}()
+	case cfg.MetricsToken != "":
+		http.HandleFunc("/metrics", metricsHandler)
+	default:
+		fmt.Println("[Metrics] /metrics is off: set metrics_addr or metrics_token to serve it")
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cfg.MetricsToken != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.MetricsToken)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	writeMetrics(w)
+}
+
+// --- Registry ---
+
+type metricFamily interface {
+	write(w io.Writer)
+}
+
+var (
+	metricsMu       sync.Mutex
+	metricsFamilies []metricFamily
+)
+
+func registerMetric(m metricFamily) {
+	metricsMu.Lock()
+	metricsFamilies = append(metricsFamilies, m)
+	metricsMu.Unlock()
+}
+
+func writeMetrics(w io.Writer) {
+	metricsMu.Lock()
+	families := append([]metricFamily(nil), metricsFamilies...)
+	metricsMu.Unlock()
+	for _, m := range families {
+		m.write(w)
+	}
+}
+
+// series is one set of label values, joined with labelSep.
+const labelSep = "\xff"
+
+func seriesKey(labels []string, values []string) string {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: %d label values for %d labels", len(values), len(labels)))
+	}
+	return strings.Join(values, labelSep)
+}
+
+// formatLabels renders {a="x",b="y"}, with extra appended (e.g. le).
+func formatLabels(labels []string, key string, extra ...string) string {
+	var pairs []string
+	if len(labels) > 0 {
+		for i, v := range strings.Split(key, labelSep) {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(v))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// --- Counter ---
+
+type counter struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+func newCounter(name, help string, labels ...string) *counter {
+	c := &counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	if len(labels) == 0 {
+		c.values[""] = 0 // an unlabelled counter is exported from the start
+	}
+	registerMetric(c)
+	return c
+}
+
+func (c *counter) inc(labelValues ...string) { c.add(1, labelValues...) }
+
+func (c *counter) add(v float64, labelValues ...string) {
+	key := seriesKey(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key), formatFloat(c.values[key]))
+	}
+}
+
+// --- Histogram ---
+
+type histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64 // upper bounds, ascending; +Inf is implied
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogram {
+	h := &histogram{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	registerMetric(h)
+	return h
+}
+
+func (h *histogram) observe(v float64, labelValues ...string) {
+	key := seriesKey(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key), s.count)
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// --- Vault Registry ---
+//
+// Vault metadata (owner, tier, hashes, manifest), each vault's ordered
+// chunk list and its audit trail live in a database.
+// Handlers only see the VaultRepository interface. REGISTRY picks the
+// implementation:
+//
+//	postgres  postgresRepository (default) at DATABASE_URL. If that is unset
+//	          the server continues in Offline Mode on SQLite; if it is set
+//	          but Postgres can't be opened, the server exits.
+//	sqlite    sqliteRepository (sqlite.go): an embedded database file at
+//	          SQLITE_PATH, for single-node installs with no external service
+//	memory    memoryRepository: nothing persists. Only used when selected;
+//	          a database that can't be opened stops the server instead.
+//
+// Both databases migrate their schema on startup.
+//
+// The tables live in their own "chronovault" schema, clear of anything the
+// frontend keeps in Supabase's public schema. Migrations are append-only: add
+// a new entry to migrations, never edit an applied one. Each runs in its own
+// transaction under an advisory lock, so several servers starting at once
+// apply it only once.
+
+// VaultRow is a registered vault.
+type VaultRow struct {
+	ID           int64
+	OwnerID      string
+	FileName     string
+	Tier         string
+	RootHash     string
+	OriginalHash string
+	Manifest     string
+	CreatedAt    time.Time
+	Chunks       []string // chunk hashes in manifest order
+
+	RetrieveCount   int
+	LastRetrievedAt *time.Time
+}
+
+// AuditEvent is one entry in a vault's audit trail.
+type AuditEvent struct {
+	ID       int64
+	RootHash string
+	Actor    string // user id, or "anonymous"
+	Action   string // "upload", "retrieve"
+	Detail   string
+	At       time.Time
+}
+
+// VaultRepository stores and looks up vaults.
+type VaultRepository interface {
+	Name() string
+	// CreateVault inserts v and its chunks, and fills in ID and CreatedAt.
+	CreateVault(ctx context.Context, v *VaultRow) error
+	// VaultByRootHash returns errVaultNotFound when no vault has the root.
+	VaultByRootHash(ctx context.Context, rootHash string) (*VaultRow, error)
+	// VaultsByOwner lists an owner's vaults, newest first, without chunks.
+	VaultsByOwner(ctx context.Context, ownerID string) ([]*VaultRow, error)
+	RecordRetrieval(ctx context.Context, rootHash string, at time.Time) error
+	// RecordEvent appends e to the audit trail and fills in ID (and At, if
+	// zero).
+	RecordEvent(ctx context.Context, e *AuditEvent) error
+	// Events returns a vault's audit trail, oldest first.
+	Events(ctx context.Context, rootHash string) ([]AuditEvent, error)
+	Close() error
+}
+
+var (
+	errVaultNotFound = errors.New("vault not found")
+	errVaultExists   = errors.New("a vault with this root hash already exists")
+)
+
+var registry VaultRepository = newMemoryRepository()
+
+// initRegistry opens and migrates the registry selected by REGISTRY. With no
+// DATABASE_URL the Postgres registry falls back to SQLite. A database that
+// can't be opened stops the process: the vaults it holds would otherwise
+// silently go missing.
+func initRegistry() {
+	ctx := context.Background()
+	var repo VaultRepository
+	var err error
+	switch kind := strings.ToLower(cfg.Registry); kind {
+	case "", "postgres":
+		if cfg.DatabaseURL != "" {
+			if repo, err = openPostgresRepository(ctx, cfg.DatabaseURL); err != nil {
+				err = fmt.Errorf("Postgres at DATABASE_URL: %w", err)
+				break
+			}
+			fmt.Printf("✅ Vault registry: Postgres, schema at migration %d\n", migrations[len(migrations)-1].version)
+			break
+		}
+		fmt.Printf("⚠️ Warning: DATABASE_URL is not set, continuing in Offline Mode on SQLite (%s)\n", cfg.SQLitePath)
+		fallthrough
+	case "sqlite":
+		if repo, err = openSQLiteRepository(ctx, cfg.SQLitePath); err != nil {
+			err = fmt.Errorf("SQLite: %w", err)
+			break
+		}
+		fmt.Printf("✅ Vault registry: SQLite at %s, schema at migration %d\n", cfg.SQLitePath, sqliteMigrations[len(sqliteMigrations)-1].version)
+	case "memory":
+		repo = newMemoryRepository()
+		fmt.Println("⚠️ Warning: Vault registry is in memory; nothing persists across restarts.")
+	default:
+		err = fmt.Errorf("unknown REGISTRY %q (want postgres, sqlite or memory)", kind)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: vault registry: %v\n", err)
+		os.Exit(1)
+	}
+	registry = repo
+}
+
+// recordEvent appends to the audit trail, logging rather than failing the
+// request when the registry can't be written.
+func recordEvent(ctx context.Context, rootHash, actor, action, detail string) {
+	if actor == "" {
+		actor = "anonymous"
+	}
+	e := &AuditEvent{RootHash: rootHash, Actor: actor, Action: action, Detail: detail}
+	if err := registry.RecordEvent(ctx, e); err != nil {
+		fmt.Printf("[Registry] Audit event %q for %.10s... not recorded: %v\n", action, rootHash, err)
+	}
+}
+
+// manifestChunks returns the chunk hashes of a manifest in order.
+func manifestChunks(manifest string) []string {
+	var chunks []string
+	for _, line := range strings.Split(manifest, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		chunks = append(chunks, line)
+	}
+	return chunks
+}
+
+// --- Postgres ---
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+var migrations = []migration{
+	{1, "vaults and chunks", `
+CREATE TABLE chronovault.vaults (
+	id                bigserial PRIMARY KEY,
+	owner_id          text        NOT NULL,
+	file_name         text        NOT NULL,
+	tier              text        NOT NULL DEFAULT 'standard',
+	root_hash         text        NOT NULL UNIQUE,
+	original_hash     text        NOT NULL,
+	manifest          text        NOT NULL,
+	tx_hash           text,
+	created_at        timestamptz NOT NULL DEFAULT now(),
+	retrieve_count    integer     NOT NULL DEFAULT 0,
+	last_retrieved_at timestamptz
+);
+CREATE INDEX vaults_owner_created_idx ON chronovault.vaults (owner_id, created_at DESC);
+
+CREATE TABLE chronovault.chunks (
+	vault_id bigint  NOT NULL REFERENCES chronovault.vaults (id) ON DELETE CASCADE,
+	seq      integer NOT NULL,
+	hash     text    NOT NULL,
+	PRIMARY KEY (vault_id, seq)
+);
+CREATE INDEX chunks_hash_idx ON chronovault.chunks (hash);
+`},
+	{2, "audit events", `
+CREATE TABLE chronovault.audit_events (
+	id        bigserial PRIMARY KEY,
+	root_hash text        NOT NULL,
+	actor     text        NOT NULL,
+	action    text        NOT NULL,
+	detail    text        NOT NULL DEFAULT '',
+	at        timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX audit_events_root_idx ON chronovault.audit_events (root_hash, id);
+`},
+	{3, "drop unused tx_hash", `
+ALTER TABLE chronovault.vaults DROP COLUMN tx_hash;
+`},
+}
+
+// migrationLockID keys the advisory lock that serialises migrations.
+const migrationLockID = 0x43565f4d49475254 // "CV_MIGRT"
+
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func openPostgresRepository(ctx context.Context, uri string) (*postgresRepository, error) {
+	if uri == "" {
+		return nil, fmt.Errorf("DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping: %w", err)
+	}
+	repo := &postgresRepository{db: db}
+	if err := repo.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// migrate applies every migration newer than the schema's version.
+func (p *postgresRepository) migrate(ctx context.Context) error {
+	if _, err := p.db.ExecContext(ctx, `CREATE SCHEMA IF NOT EXISTS chronovault;
+CREATE TABLE IF NOT EXISTS chronovault.schema_migrations (
+	version    integer PRIMARY KEY,
+	name       text        NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`); err != nil {
+		return fmt.Errorf("migrations table: %w", err)
+	}
+	for _, m := range migrations {
+		if err := p.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (p *postgresRepository) applyMigration(ctx context.Context, m migration) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(migrationLockID)); err != nil {
+		return err
+	}
+	var applied bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM chronovault.schema_migrations WHERE version = $1)`, m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO chronovault.schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name); err != nil {
+		return err
+	}
+	fmt.Printf("[Registry] Applied migration %d: %s\n", m.version, m.name)
+	return tx.Commit()
+}
+
+func (p *postgresRepository) Name() string { return "postgres" }
+
+func (p *postgresRepository) CreateVault(ctx context.Context, v *VaultRow) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO chronovault.vaults (owner_id, file_name, tier, root_hash, original_hash, manifest)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at`,
+		v.OwnerID, v.FileName, v.Tier, v.RootHash, v.OriginalHash, v.Manifest,
+	).Scan(&v.ID, &v.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" { // unique_violation
+		return errVaultExists
+	}
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema("chronovault", "chunks", "vault_id", "seq", "hash"))
+	if err != nil {
+		return err
+	}
+	for i, h := range v.Chunks {
+		if _, err := stmt.ExecContext(ctx, v.ID, i, h); err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const vaultColumns = `id, owner_id, file_name, tier, root_hash, original_hash, manifest,
+	created_at, retrieve_count, last_retrieved_at`
+
+func scanVault(row interface{ Scan(...interface{}) error }) (*VaultRow, error) {
+	v := &VaultRow{}
+	var last sql.NullTime
+	err := row.Scan(&v.ID, &v.OwnerID, &v.FileName, &v.Tier, &v.RootHash, &v.OriginalHash, &v.Manifest,
+		&v.CreatedAt, &v.RetrieveCount, &last)
+	if err != nil {
+		return nil, err
+	}
+	if last.Valid {
+		v.LastRetrievedAt = &last.Time
+	}
+	return v, nil
+}
+
+func (p *postgresRepository) VaultByRootHash(ctx context.Context, rootHash string) (*VaultRow, error) {
+	v, err := scanVault(p.db.QueryRowContext(ctx, `SELECT `+vaultColumns+` FROM chronovault.vaults WHERE root_hash = $1`, rootHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errVaultNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT hash FROM chronovault.chunks WHERE vault_id = $1 ORDER BY seq`, v.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		v.Chunks = append(v.Chunks, h)
+	}
+	return v, rows.Err()
+}
+
+func (p *postgresRepository) VaultsByOwner(ctx context.Context, ownerID string) ([]*VaultRow, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT `+vaultColumns+` FROM chronovault.vaults WHERE owner_id = $1 ORDER BY created_at DESC, id DESC`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*VaultRow
+	for rows.Next() {
+		v, err := scanVault(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresRepository) RecordRetrieval(ctx context.Context, rootHash string, at time.Time) error {
+	return p.updateOne(ctx, `UPDATE chronovault.vaults SET retrieve_count = retrieve_count + 1, last_retrieved_at = $2 WHERE root_hash = $1`, rootHash, at)
+}
+
+func (p *postgresRepository) RecordEvent(ctx context.Context, e *AuditEvent) error {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	return p.db.QueryRowContext(ctx, `
+INSERT INTO chronovault.audit_events (root_hash, actor, action, detail, at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id`,
+		e.RootHash, e.Actor, e.Action, e.Detail, e.At,
+	).Scan(&e.ID)
+}
+
+func (p *postgresRepository) Events(ctx context.Context, rootHash string) ([]AuditEvent, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT id, root_hash, actor, action, detail, at FROM chronovault.audit_events WHERE root_hash = $1 ORDER BY id`, rootHash)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// scanEvents reads and closes rows of audit events.
+func scanEvents(rows *sql.Rows) ([]AuditEvent, error) {
+	defer rows.Close()
+	var out []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.RootHash, &e.Actor, &e.Action, &e.Detail, &e.At); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresRepository) updateOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := p.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errVaultNotFound
+	}
+	return err
+}
+
+func (p *postgresRepository) Close() error { return p.db.Close() }
+
+// --- In-Memory Stand-in ---
+
+type memoryRepository struct {
+	mu     sync.Mutex
+	nextID int64
+	byRoot map[string]*VaultRow
+	events []AuditEvent
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{byRoot: make(map[string]*VaultRow)}
+}
+
+func (m *memoryRepository) Name() string { return "memory" }
+
+func (m *memoryRepository) CreateVault(ctx context.Context, v *VaultRow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byRoot[v.RootHash]; ok {
+		return errVaultExists
+	}
+	m.nextID++
+	v.ID, v.CreatedAt = m.nextID, time.Now().UTC()
+	cp := *v
+	cp.Chunks = append([]string(nil), v.Chunks...)
+	m.byRoot[v.RootHash] = &cp
+	return nil
+}
+
+func (m *memoryRepository) VaultByRootHash(ctx context.Context, rootHash string) (*VaultRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.byRoot[rootHash]
+	if !ok {
+		return nil, errVaultNotFound
+	}
+	cp := *v
+	cp.Chunks = append([]string(nil), v.Chunks...)
+	return &cp, nil
+}
+
+func (m *memoryRepository) VaultsByOwner(ctx context.Context, ownerID string) ([]*VaultRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*VaultRow
+	for _, v := range m.byRoot {
+		if v.OwnerID == ownerID {
+			cp := *v
+			cp.Chunks = nil
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out, nil
+}
+
+func (m *memoryRepository) update(rootHash string, fn func(v *VaultRow)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.byRoot[rootHash]
+	if !ok {
+		return errVaultNotFound
+	}
+	fn(v)
+	return nil
+}
+
+func (m *memoryRepository) RecordRetrieval(ctx context.Context, rootHash string, at time.Time) error {
+	return m.update(rootHash, func(v *VaultRow) {
+		v.RetrieveCount++
+		v.LastRetrievedAt = &at
+	})
+}
+
+func (m *memoryRepository) RecordEvent(ctx context.Context, e *AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	e.ID = int64(len(m.events)) + 1
+	m.events = append(m.events, *e)
+	return nil
+}
+
+func (m *memoryRepository) Events(ctx context.Context, rootHash string) ([]AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []AuditEvent
+	for _, e := range m.events {
+		if e.RootHash == rootHash {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryRepository) Close() error { return nil }
+
+// runVaultList prints an owner's vaults and their audit trails from the
+// configured registry.
+func runVaultList(owner string) error {
+	initRegistry()
+	defer registry.Close()
+	ctx := context.Background()
+	vaults, err := registry.VaultsByOwner(ctx, owner)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%d vault(s) for %s in the %s registry\n", len(vaults), owner, registry.Name())
+	for _, v := range vaults {
+		fmt.Printf("\n#%d %s (%s tier), created %s\n", v.ID, v.FileName, v.Tier, v.CreatedAt.Format(time.RFC3339))
+		fmt.Printf("   root %s, retrieved %d time(s)\n", v.RootHash, v.RetrieveCount)
+		events, err := registry.Events(ctx, v.RootHash)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			fmt.Printf("   %s  %-8s by %s  %s\n", e.At.Format(time.RFC3339), e.Action, e.Actor, e.Detail)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testVaultRepository runs the VaultRepository contract against repo. Rows
+// are created under a unique owner, so it also runs against a shared
+// database; cleanup, if any, is the caller's.
+func testVaultRepository(t *testing.T, repo VaultRepository) *VaultRow {
+	t.Helper()
+	ctx := context.Background()
+	suffix := fmt.Sprintf("%d", time.Now().UnixNano())
+	owner := "registry-test-" + suffix
+	chunks := []string{HashData([]byte("a" + suffix)), HashData([]byte("b" + suffix)), HashData([]byte("c" + suffix))}
+	v := &VaultRow{
+		OwnerID:      owner,
+		FileName:     "check.txt",
+		Tier:         "standard",
+		RootHash:     BuildMerkleTree(chunks).Hash,
+		OriginalHash: HashData([]byte(suffix)),
+		Manifest:     "# Filename: check.txt\n# Vault Security Tier: standard\n" + strings.Join(chunks, "\n") + "\n",
+		Chunks:       chunks,
+	}
+
+	t.Run("create", func(t *testing.T) {
+		if err := repo.CreateVault(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+		if v.ID == 0 || v.CreatedAt.IsZero() {
+			t.Fatal("create did not assign id and created_at")
+		}
+		dup := &VaultRow{OwnerID: owner, FileName: "dup", RootHash: v.RootHash, Manifest: v.Manifest}
+		if err := repo.CreateVault(ctx, dup); !errors.Is(err, errVaultExists) {
+			t.Fatalf("duplicate root hash: got %v, want errVaultExists", err)
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		got, err := repo.VaultByRootHash(ctx, v.RootHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.OwnerID != owner || got.Manifest != v.Manifest || strings.Join(got.Chunks, ",") != strings.Join(chunks, ",") {
+			t.Fatalf("got %+v, want %+v", got, v)
+		}
+		if _, err := repo.VaultByRootHash(ctx, "missing-"+suffix); !errors.Is(err, errVaultNotFound) {
+			t.Fatalf("missing root hash: got %v, want errVaultNotFound", err)
+		}
+	})
+
+	t.Run("retrieval", func(t *testing.T) {
+		at := time.Now().UTC().Truncate(time.Microsecond)
+		if err := repo.RecordRetrieval(ctx, v.RootHash, at); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.RecordRetrieval(ctx, "missing-"+suffix, at); !errors.Is(err, errVaultNotFound) {
+			t.Fatalf("missing root hash: got %v, want errVaultNotFound", err)
+		}
+		list, err := repo.VaultsByOwner(ctx, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 {
+			t.Fatalf("listed %d vaults, want 1", len(list))
+		}
+		if got := list[0]; got.RetrieveCount != 1 || got.LastRetrievedAt == nil || !got.LastRetrievedAt.Equal(at) {
+			t.Fatalf("retrieve count %d at %v, want 1 at %v", got.RetrieveCount, got.LastRetrievedAt, at)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		for _, action := range []string{"upload", "retrieve"} {
+			e := &AuditEvent{RootHash: v.RootHash, Actor: owner, Action: action}
+			if err := repo.RecordEvent(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+			if e.ID == 0 || e.At.IsZero() {
+				t.Fatal("record event did not assign id and time")
+			}
+		}
+		events, err := repo.Events(ctx, v.RootHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].Action != "upload" || events[1].Action != "retrieve" || events[1].Actor != owner {
+			t.Fatalf("unexpected trail %+v", events)
+		}
+	})
+	return v
+}
+
+func TestMemoryRepository(t *testing.T) {
+	testVaultRepository(t, newMemoryRepository())
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	// The name needs escaping in the DSN, and the file must land under it.
+	path := filepath.Join(t.TempDir(), "chrono vault?#100%.db")
+	repo, err := openSQLiteRepository(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	v := testVaultRepository(t, repo)
+	repo.Close()
+
+	// Reopening applies no migrations twice and keeps the data.
+	repo, err = openSQLiteRepository(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if _, err := repo.VaultByRootHash(context.Background(), v.RootHash); err != nil {
+		t.Fatalf("after reopen: %v", err)
+	}
+}
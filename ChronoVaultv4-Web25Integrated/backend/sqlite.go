@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// --- SQLite ---
+//
+// sqliteRepository keeps the registry in a single file with the pure-Go
+// modernc.org/sqlite driver, so the binary still needs no cgo and no database
+// server. The schema mirrors the Postgres one. SQLite has no schemas or
+// advisory locks, so the applied version is kept in PRAGMA user_version and
+// every transaction starts IMMEDIATE, which takes the write lock up front.
+// Two processes migrating one file at once therefore apply each migration
+// only once.
+//
+// One connection is shared: SQLite allows a single writer, and the busy
+// timeout covers other processes that have the file open.
+
+var sqliteMigrations = []migration{
+	{1, "vaults and chunks", `
+CREATE TABLE vaults (
+	id                INTEGER  PRIMARY KEY AUTOINCREMENT,
+	owner_id          TEXT     NOT NULL,
+	file_name         TEXT     NOT NULL,
+	tier              TEXT     NOT NULL DEFAULT 'standard',
+	root_hash         TEXT     NOT NULL UNIQUE,
+	original_hash     TEXT     NOT NULL,
+	manifest          TEXT     NOT NULL,
+	tx_hash           TEXT,
+	created_at        DATETIME NOT NULL,
+	retrieve_count    INTEGER  NOT NULL DEFAULT 0,
+	last_retrieved_at DATETIME
+);
+CREATE INDEX vaults_owner_created_idx ON vaults (owner_id, created_at DESC);
+
+CREATE TABLE chunks (
+	vault_id INTEGER NOT NULL REFERENCES vaults (id) ON DELETE CASCADE,
+	seq      INTEGER NOT NULL,
+	hash     TEXT    NOT NULL,
+	PRIMARY KEY (vault_id, seq)
+);
+CREATE INDEX chunks_hash_idx ON chunks (hash);
+`},
+	{2, "audit events", `
+CREATE TABLE audit_events (
+	id        INTEGER  PRIMARY KEY AUTOINCREMENT,
+	root_hash TEXT     NOT NULL,
+	actor     TEXT     NOT NULL,
+	action    TEXT     NOT NULL,
+	detail    TEXT     NOT NULL DEFAULT '',
+	at        DATETIME NOT NULL
+);
+CREATE INDEX audit_events_root_idx ON audit_events (root_hash, id);
+`},
+	{3, "drop unused tx_hash", `
+ALTER TABLE vaults DROP COLUMN tx_hash;
+`},
+}
+
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+func openSQLiteRepository(ctx context.Context, path string) (*sqliteRepository, error) {
+	// _time_format=sqlite stores times as sortable text that the driver
+	// parses back into time.Time for DATETIME columns.
+	q := url.Values{}
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Set("_time_format", "sqlite")
+	q.Set("_txlock", "immediate")
+	dsn := url.URL{Scheme: "file", Path: path, RawQuery: q.Encode()}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	repo := &sqliteRepository{db: db}
+	if err := repo.migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+// migrate applies every migration newer than user_version.
+func (s *sqliteRepository) migrate(ctx context.Context) error {
+	for _, m := range sqliteMigrations {
+		if err := s.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteRepository) applyMigration(ctx context.Context, m migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version >= m.version {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	// PRAGMA takes no bound parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, m.version)); err != nil {
+		return err
+	}
+	fmt.Printf("[Registry] Applied SQLite migration %d: %s\n", m.version, m.name)
+	return tx.Commit()
+}
+
+func (s *sqliteRepository) Name() string { return "sqlite" }
+
+func (s *sqliteRepository) CreateVault(ctx context.Context, v *VaultRow) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	createdAt := time.Now().UTC()
+	res, err := tx.ExecContext(ctx, `
+INSERT INTO vaults (owner_id, file_name, tier, root_hash, original_hash, manifest, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		v.OwnerID, v.FileName, v.Tier, v.RootHash, v.OriginalHash, v.Manifest, createdAt)
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) && liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return errVaultExists
+	}
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO chunks (vault_id, seq, hash) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, h := range v.Chunks {
+		if _, err := stmt.ExecContext(ctx, id, i, h); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	v.ID, v.CreatedAt = id, createdAt
+	return nil
+}
+
+func (s *sqliteRepository) VaultByRootHash(ctx context.Context, rootHash string) (*VaultRow, error) {
+	v, err := scanVault(s.db.QueryRowContext(ctx, `SELECT `+vaultColumns+` FROM vaults WHERE root_hash = ?`, rootHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errVaultNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT hash FROM chunks WHERE vault_id = ? ORDER BY seq`, v.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		v.Chunks = append(v.Chunks, h)
+	}
+	return v, rows.Err()
+}
+
+func (s *sqliteRepository) VaultsByOwner(ctx context.Context, ownerID string) ([]*VaultRow, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+vaultColumns+` FROM vaults WHERE owner_id = ? ORDER BY created_at DESC, id DESC`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*VaultRow
+	for rows.Next() {
+		v, err := scanVault(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteRepository) RecordRetrieval(ctx context.Context, rootHash string, at time.Time) error {
+	return s.updateOne(ctx, `UPDATE vaults SET retrieve_count = retrieve_count + 1, last_retrieved_at = ? WHERE root_hash = ?`, at.UTC(), rootHash)
+}
+
+func (s *sqliteRepository) updateOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errVaultNotFound
+	}
+	return err
+}
+
+func (s *sqliteRepository) RecordEvent(ctx context.Context, e *AuditEvent) error {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO audit_events (root_hash, actor, action, detail, at) VALUES (?, ?, ?, ?, ?)`,
+		e.RootHash, e.Actor, e.Action, e.Detail, e.At.UTC())
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *sqliteRepository) Events(ctx context.Context, rootHash string) ([]AuditEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, root_hash, actor, action, detail, at FROM audit_events WHERE root_hash = ? ORDER BY id`, rootHash)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+func (s *sqliteRepository) Close() error { return s.db.Close() }